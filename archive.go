@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// archiveDir holds archived collections, one directory per archiving:
+// .archive/<timestamp>/<collection>.
+const archiveDir = ".archive"
+
+// archiveStamp formats archive timestamps so they sort in time order.
+const archiveStamp = "20060102T150405.000000000Z"
+
+// ArchiveCollection moves a collection out of the active namespace into
+// the archive, by renaming its directory in each data directory. Archived
+// collections aren't listed by Collections and can be brought back with
+// UnarchiveCollection. Its history and trash stay where they are.
+func (d *Driver) ArchiveCollection(collection string) (err error) {
+	defer wrapOp("ArchiveCollection", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to archive!")
+	}
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if err := d.checkPath(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	archiveMutex := d.getOrCreateMutex(archiveDir)
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+
+	paths := d.collectionPaths(collection)
+	if len(paths) == 0 {
+		return fmt.Errorf("collection %s: %w", collection, ErrNotFound)
+	}
+
+	stamp := time.Now().UTC().Format(archiveStamp)
+
+	if d.dryRun {
+		d.dryRunf("archive collection %s as %s", collection, stamp)
+		return nil
+	}
+
+	for root, names := range paths {
+		for _, name := range names {
+			dst := filepath.Join(root, archiveDir, stamp, name)
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(filepath.Join(root, name), dst); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.unindex(collection, "")
+	d.access.forget(collection, "")
+	d.partitions.forget(collection, "")
+	d.names.forget(collection)
+	d.forgetDirs(collection)
+	d.uncache(collection, "")
+
+	d.log.Debugf("Archived collection %s as %s", collection, stamp)
+	return nil
+}
+
+// UnarchiveCollection moves the most recently archived copy of a collection
+// back into place. It fails with ErrAlreadyExists if the collection has been
+// recreated since.
+func (d *Driver) UnarchiveCollection(collection string) (err error) {
+	defer wrapOp("UnarchiveCollection", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to unarchive!")
+	}
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if err := d.checkPath(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	archiveMutex := d.getOrCreateMutex(archiveDir)
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+
+	if len(d.collectionPaths(collection)) > 0 {
+		return fmt.Errorf("collection %s: %w", collection, ErrAlreadyExists)
+	}
+
+	// Every data directory archived its part under the same stamp; the
+	// latest stamp holding the collection anywhere wins.
+	var stamps []string
+	for _, root := range d.roots() {
+		entries, err := os.ReadDir(filepath.Join(root, archiveDir))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, entry := range entries {
+			if len(d.archivedPaths(root, entry.Name(), collection)) > 0 {
+				stamps = append(stamps, entry.Name())
+			}
+		}
+	}
+
+	if len(stamps) == 0 {
+		return fmt.Errorf("archived collection %s: %w", collection, ErrNotFound)
+	}
+	sort.Strings(stamps)
+	stamp := stamps[len(stamps)-1]
+
+	if d.dryRun {
+		d.dryRunf("unarchive collection %s from %s", collection, stamp)
+		return nil
+	}
+
+	for _, root := range d.roots() {
+		for _, name := range d.archivedPaths(root, stamp, collection) {
+			dst := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(filepath.Join(root, archiveDir, stamp, name), dst); err != nil {
+				return err
+			}
+		}
+
+		// Drop the stamp directory once empty; leftovers of other
+		// collections archived at the same instant keep it.
+		os.Remove(filepath.Join(root, archiveDir, stamp))
+	}
+	d.names.forget(collection)
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return err
+	}
+	for _, resource := range resources {
+		if err := d.reindexRecord(collection, resource); err != nil {
+			return err
+		}
+	}
+
+	d.log.Debugf("Unarchived collection %s from %s", collection, stamp)
+	return nil
+}
+
+// collectionPaths returns, per data directory, the names relative to it of
+// what stores a collection: its directory and, in single-file mode, its
+// collection file.
+func (d *Driver) collectionPaths(collection string) map[string][]string {
+	paths := make(map[string][]string)
+
+	for _, root := range d.roots() {
+		for _, name := range []string{collection, collection + ".json"} {
+			if name != collection && !d.singleFile {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+				paths[root] = append(paths[root], name)
+			}
+		}
+	}
+
+	return paths
+}
+
+// archivedPaths is collectionPaths for the copy of a collection archived in
+// root under stamp.
+func (d *Driver) archivedPaths(root, stamp, collection string) []string {
+	var names []string
+	for _, name := range []string{collection, collection + ".json"} {
+		if name != collection && !d.singleFile {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, archiveDir, stamp, name)); err == nil {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestArchiveAndUnarchiveCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+
+	if err := d.ArchiveCollection("fish"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Errorf("Read from an archived collection = %v, want not exist", err)
+	}
+	if collections, err := d.Collections(); err != nil || !slices.Equal(collections, []string{"sharks"}) {
+		t.Errorf("Collections = %v, %v, want the archive left out", collections, err)
+	}
+
+	if err := d.UnarchiveCollection("fish"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("Read after UnarchiveCollection = %+v, %v", got, err)
+	}
+}
+
+func TestUnarchiveLatestCopy(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	if err := d.ArchiveCollection("fish"); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	if err := d.UnarchiveCollection("fish"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("UnarchiveCollection over a recreated collection = %v, want ErrAlreadyExists", err)
+	}
+
+	if err := d.ArchiveCollection("fish"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UnarchiveCollection("fish"); err != nil {
+		t.Fatal(err)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("UnarchiveCollection restored %+v, %v, want the latest copy", got, err)
+	}
+}
+
+func TestArchiveErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.ArchiveCollection("birds"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ArchiveCollection of a missing collection = %v, want ErrNotFound", err)
+	}
+	if err := d.UnarchiveCollection("birds"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UnarchiveCollection of an unarchived collection = %v, want ErrNotFound", err)
+	}
+	if err := d.ArchiveCollection(archiveDir); !errors.Is(err, ErrReservedName) {
+		t.Errorf("ArchiveCollection of the archive = %v, want ErrReservedName", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// blobExt is the extension of binary blobs stored next to a record as
+// <resource>.<field>.bin. ReadAll and ListResources don't treat them as
+// records.
+const blobExt = ".bin"
+
+// WriteBlob stores data as the named binary field of a record. Blobs are
+// kept outside the record's JSON and are removed along with the record by
+// Delete.
+func (d *Driver) WriteBlob(collection, resource, field string, data []byte) (err error) {
+	defer wrapOp("WriteBlob", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	if err := checkField(field); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if d.dryRun {
+		d.dryRunf("write blob %s of %s/%s", field, collection, resource)
+		return nil
+	}
+
+	if err := d.checkDatabase(); err != nil {
+		return err
+	}
+
+	path := d.blobPath(collection, resource, field)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := d.writeFileAtomic(path, data); err != nil {
+		return err
+	}
+
+	d.log.Debugf("Successfully wrote blob %s of %s/%s", field, collection, resource)
+	return nil
+}
+
+// ReadBlob returns the named binary field of a record.
+func (d *Driver) ReadBlob(collection, resource, field string) (_ []byte, err error) {
+	defer wrapOp("ReadBlob", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read blob!")
+	}
+
+	if resource == "" {
+		return nil, fmt.Errorf("Missing resource - unable to read blob (no name)!")
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return nil, err
+	}
+
+	if err := checkField(field); err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return os.ReadFile(d.blobPath(collection, resource, field))
+}
+
+// blobPath returns the file a blob is stored in, next to the record's file
+// in whichever data directory holds it.
+func (d *Driver) blobPath(collection, resource, field string) string {
+	return strings.TrimSuffix(d.recordFile(collection, resource), ".json") + "." + field + blobExt
+}
+
+// checkField validates a blob field name. Fields can't contain dots, so the
+// blobs of "a" and "a.b" can be told apart.
+func checkField(field string) error {
+	if field == "" || strings.ContainsAny(field, "./\\") {
+		return fmt.Errorf("blob field %q: %w", field, ErrInvalidName)
+	}
+
+	return nil
+}
+
+// sidecarFiles returns the names of the files kept next to the record
+// resource in dir, which go wherever the record goes: its blobs and its
+// metadata.
+func sidecarFiles(dir, resource string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		field, ok := strings.CutPrefix(entry.Name(), resource+".")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if entry.Name() == resource+metaExt {
+			names = append(names, entry.Name())
+			continue
+		}
+		if field, ok = strings.CutSuffix(field, blobExt); ok && checkField(field) == nil {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWriteAndReadBlob(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	photo := []byte{0x89, 'P', 'N', 'G', 0}
+	if err := d.WriteBlob("fish", "nemo", "photo", photo); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.ReadBlob("fish", "nemo", "photo")
+	if err != nil || !slices.Equal(got, photo) {
+		t.Errorf("ReadBlob = %v, %v, want %v", got, err, photo)
+	}
+
+	if names, err := d.ListResources("fish"); err != nil || !slices.Equal(names, []string{"nemo"}) {
+		t.Errorf("ListResources with a blob = %v, %v", names, err)
+	}
+
+	if _, err := d.ReadBlob("fish", "nemo", "voice"); !os.IsNotExist(err) {
+		t.Errorf("ReadBlob of a missing field = %v, want not exist", err)
+	}
+}
+
+func TestBlobInvalidField(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, field := range []string{"", "a.b", "a/b", `a\b`} {
+		if err := d.WriteBlob("fish", "nemo", field, nil); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("WriteBlob with field %q = %v, want ErrInvalidName", field, err)
+		}
+	}
+}
+
+func TestBlobsFollowTheirRecord(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.WriteBlob("fish", "nemo", "photo", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadBlob("fish", "nemo", "photo"); !os.IsNotExist(err) {
+		t.Errorf("ReadBlob after Delete = %v, want not exist", err)
+	}
+
+	if err := d.Restore("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.ReadBlob("fish", "nemo", "photo"); err != nil || string(got) != "png" {
+		t.Errorf("ReadBlob after Restore = %q, %v", got, err)
+	}
+}
+
+func TestDeleteRemovesBlobs(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.WriteBlob("fish", "nemo", "photo", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(d.dir, "fish")); err == nil && len(entries) != 0 {
+		t.Errorf("files left after Delete: %v", entries)
+	}
+}
+
+func TestRebalanceMovesBlobs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	a, b := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	d := openTestDriver(t, dir, &Options{DataDirs: []string{a}})
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		if err := d.WriteBlob("fish", name, "photo", []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	d = openTestDriver(t, dir, &Options{DataDirs: []string{a, b}})
+	if _, err := d.Rebalance(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		home := filepath.Dir(d.homeFile("fish", name))
+		if !isFile(filepath.Join(home, name+".photo"+blobExt)) {
+			t.Errorf("blob of %s isn't next to the record after Rebalance", name)
+		}
+		if got, err := d.ReadBlob("fish", name, "photo"); err != nil || string(got) != name {
+			t.Errorf("ReadBlob %s = %q, %v", name, got, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordCache keeps the content of recently read records in memory, up to
+// size records, dropping the least recently used first. Writes and deletes
+// made through the driver drop the records they change; changes made to the
+// files by other means are only noticed with Options.CacheCheckModTime.
+type recordCache struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[cacheKey]*list.Element
+
+	// version counts forget calls, so a read that raced a write doesn't
+	// store the content it read before the write.
+	version uint64
+}
+
+type cacheKey struct {
+	collection, resource string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	b       []byte
+	modTime time.Time
+}
+
+func newRecordCache(size int) *recordCache {
+	return &recordCache{size: size, order: list.New(), entries: make(map[cacheKey]*list.Element)}
+}
+
+// get returns a copy of a cached record with the modification time its file
+// had when it was read, or false and the version to pass to put after
+// reading it from disk.
+func (c *recordCache) get(collection, resource string) ([]byte, time.Time, uint64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[cacheKey{collection, resource}]
+	if !ok {
+		return nil, time.Time{}, c.version, false
+	}
+
+	c.order.MoveToFront(e)
+	entry := e.Value.(*cacheEntry)
+	return bytes.Clone(entry.b), entry.modTime, c.version, true
+}
+
+// put caches a record read from disk, unless something was forgotten since
+// get returned version.
+func (c *recordCache) put(collection, resource string, b []byte, modTime time.Time, version uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	key := cacheKey{collection, resource}
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.b, entry.modTime = bytes.Clone(b), modTime
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, b: bytes.Clone(b), modTime: modTime})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// forget drops a record or, when resource is empty, every record of a
+// collection and its sub-collections.
+func (c *recordCache) forget(collection, resource string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.version++
+
+	if resource != "" {
+		if e, ok := c.entries[cacheKey{collection, resource}]; ok {
+			c.order.Remove(e)
+			delete(c.entries, e.Value.(*cacheEntry).key)
+		}
+		return
+	}
+
+	for key, e := range c.entries {
+		if key.collection == collection || strings.HasPrefix(key.collection, collection+"/") {
+			c.order.Remove(e)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// uncache drops changed records from the cache, if there is one.
+func (d *Driver) uncache(collection, resource string) {
+	if d.cache != nil {
+		d.cache.forget(collection, resource)
+	}
+}
+
+// readRecord returns the content of a record, from the cache when CacheSize
+// is set and it holds the record. With CacheCheckModTime a cached record is
+// only used while its file keeps the modification time it had when read.
+// The caller must hold the collection mutex.
+func (d *Driver) readRecord(collection, resource string) ([]byte, error) {
+	if d.cache == nil {
+		return d.loadRecord(collection, resource)
+	}
+
+	// Taken before reading, so a change made during the read leaves an old
+	// time with the new content, which only costs another read.
+	var modTime time.Time
+	if d.cacheModTime {
+		var err error
+		if modTime, err = d.modTime(collection, resource); err != nil {
+			return d.loadRecord(collection, resource)
+		}
+	}
+
+	b, cachedTime, version, ok := d.cache.get(collection, resource)
+	if ok && (!d.cacheModTime || cachedTime.Equal(modTime)) {
+		return b, nil
+	}
+
+	b, err := d.loadRecord(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache.put(collection, resource, b, modTime, version)
+	return b, nil
+}
+
+// WarmCache reads every record of a collection into the cache, so the
+// first reads after startup don't go to disk. Records beyond CacheSize
+// push out the ones read before them. Without CacheSize it does nothing.
+func (d *Driver) WarmCache(collection string) (err error) {
+	defer wrapOp("WarmCache", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if d.cache == nil {
+		return nil
+	}
+
+	if err := d.checkPath(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if _, err := d.readRecord(collection, resource); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	d.log.Debugf("Warmed the cache with %d records from %s", len(resources), collection)
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeBehind changes a record's file without going through the driver.
+func writeBehind(t *testing.T, d *Driver, collection, resource, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(d.dir, collection, resource+".json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 2})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached records are served from memory, so a change behind the
+	// driver's back isn't seen.
+	writeBehind(t, d, "fish", "nemo", `{"name":"changed"}`)
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("cached Read = %+v, %v, want nemo", got, err)
+	}
+
+	// Writes and deletes through the driver drop the cached copy.
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read after Write = %+v, %v, want age 2", got, err)
+	}
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Errorf("Read after Delete = %v, want a not-exist error", err)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 2})
+	for _, name := range []string{"nemo", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+
+	var got fish
+	for _, name := range []string{"nemo", "dory", "nemo", "marlin"} {
+		if err := d.Read("fish", name, &got); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := d.cache.order.Len(); n != 2 {
+		t.Errorf("cache holds %d records, want 2", n)
+	}
+
+	// dory was used least recently, so it went to make room for marlin.
+	// nemo is checked first: reading dory again caches it.
+	for _, tt := range []struct{ name, want string }{{"nemo", "nemo"}, {"dory", "changed"}} {
+		writeBehind(t, d, "fish", tt.name, `{"name":"changed"}`)
+		if err := d.Read("fish", tt.name, &got); err != nil || got.Name != tt.want {
+			t.Errorf("Read fish/%s = %+v, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 10})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	if err := d.WarmCache("fish"); err != nil {
+		t.Fatal(err)
+	}
+	writeBehind(t, d, "fish", "nemo", `{"name":"changed"}`)
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("Read after WarmCache = %+v, %v, want the cached nemo", got, err)
+	}
+
+	if err := d.WarmCache("sharks"); !os.IsNotExist(err) {
+		t.Errorf("WarmCache of a missing collection = %v, want a not-exist error", err)
+	}
+}
+
+func TestWarmCacheWithoutCache(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.WarmCache("sharks"); err != nil {
+		t.Errorf("WarmCache without CacheSize = %v, want nil", err)
+	}
+}
+
+func TestRecordCache(t *testing.T) {
+	c := newRecordCache(10)
+
+	b := []byte("nemo")
+	_, _, version, _ := c.get("fish", "nemo")
+	c.put("fish", "nemo", b, time.Time{}, version)
+	b[0] = 'N'
+
+	// The cache keeps its own copy and hands out copies.
+	got, _, _, ok := c.get("fish", "nemo")
+	if !ok || string(got) != "nemo" {
+		t.Fatalf("get = %q, %v, want nemo", got, ok)
+	}
+	got[0] = 'N'
+	if got, _, _, _ := c.get("fish", "nemo"); string(got) != "nemo" {
+		t.Errorf("changing a returned record changed the cache: %q", got)
+	}
+
+	// A read racing a forget doesn't store what it read.
+	_, _, version, _ = c.get("fish", "dory")
+	c.forget("fish", "nemo")
+	c.put("fish", "dory", []byte("dory"), time.Time{}, version)
+	if _, _, _, ok := c.get("fish", "dory"); ok {
+		t.Error("put after a forget cached the record")
+	}
+
+	// Forgetting a collection drops its sub-collections too.
+	_, _, version, _ = c.get("fish", "nemo")
+	c.put("fish", "nemo", []byte("nemo"), time.Time{}, version)
+	c.put("fish/reef", "marlin", []byte("marlin"), time.Time{}, version)
+	c.put("fishes", "bruce", []byte("bruce"), time.Time{}, version)
+	c.forget("fish", "")
+	for _, key := range []cacheKey{{"fish", "nemo"}, {"fish/reef", "marlin"}} {
+		if _, _, _, ok := c.get(key.collection, key.resource); ok {
+			t.Errorf("%s/%s still cached after forgetting fish", key.collection, key.resource)
+		}
+	}
+	if _, _, _, ok := c.get("fishes", "bruce"); !ok {
+		t.Error("forgetting fish dropped fishes/bruce")
+	}
+}
+
+func TestCacheCheckModTime(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 10, CacheCheckModTime: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	path := filepath.Join(d.dir, "fish", "nemo.json")
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A change that keeps the modification time goes unnoticed, which
+	// shows the read still comes from the cache.
+	writeBehind(t, d, "fish", "nemo", `{"name":"same time"}`)
+	if err := os.Chtimes(path, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("Read with an unchanged mtime = %+v, %v, want the cached nemo", got, err)
+	}
+
+	later := fi.ModTime().Add(time.Second)
+	writeBehind(t, d, "fish", "nemo", `{"name":"changed"}`)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "changed" {
+		t.Errorf("Read after an outside change = %+v, %v, want changed", got, err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "errors"
+
+// ErrClosed is returned by operations started after Close.
+var ErrClosed = errors.New("driver is closed")
+
+// Close waits for the operations in flight, including locks taken with
+// LockCollection, to finish and makes every later operation fail with
+// ErrClosed, then closes the Events channel. The files on disk are left as
+// they are. Calling Close again does nothing.
+func (d *Driver) Close() error {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mutex.Unlock()
+
+	d.active.Wait()
+
+	d.indexMutex.Lock()
+	d.indexes = nil
+	d.indexMutex.Unlock()
+
+	d.events.close()
+
+	d.log.Debugf("Closed the database at %s", d.dir)
+	return nil
+}
+
+// begin registers an operation with Close, failing with ErrClosed once Close
+// has been called. done must be called when the operation finishes. The
+// closed check and the registration happen under d.mutex, so Close either
+// sees the operation and waits for it or the operation sees Close and never
+// starts. Steps of a registered operation must not call begin again, or
+// Close could fail them halfway: use the unexported helpers instead.
+func (d *Driver) begin() (done func(), err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	d.active.Add(1)
+	return d.active.Done, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseRejectsNewOperations(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); !errors.Is(err, ErrClosed) {
+		t.Errorf("Read after Close = %v, want ErrClosed", err)
+	}
+	if err := d.Write("fish", "nemo", fish{Name: "nemo"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write after Close = %v, want ErrClosed", err)
+	}
+	if _, err := d.ReadAll("fish"); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadAll after Close = %v, want ErrClosed", err)
+	}
+	if err := d.WriteBlob("fish", "nemo", "photo", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteBlob after Close = %v, want ErrClosed", err)
+	}
+	if err := d.Sync(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Sync after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseWaitsForLockHolders(t *testing.T) {
+	d := newTestDriver(t, nil)
+	unlock := d.LockCollection("fish")
+
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a collection lock was held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't return after the lock was released")
+	}
+}
+
+func TestCloseLetsOperationsInFlightFinish(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	unlock := d.LockCollection("fish")
+
+	// Each of these registers with Close, then waits for the lock and lists
+	// the collection once it has it.
+	ops := map[string]func() error{
+		"ReadAllOrdered": func() error { _, err := d.ReadAllOrdered("fish"); return err },
+		"ReadAllMap":     func() error { _, err := d.ReadAllMap("fish"); return err },
+		"CountWhere": func() error {
+			_, err := CountWhere(d, "fish", func(f fish) bool { return true })
+			return err
+		},
+		"Reindex": func() error { return d.Reindex("fish") },
+	}
+	results := make(map[string]chan error)
+	for name, op := range ops {
+		result := make(chan error, 1)
+		results[name] = result
+		go func() { result <- op() }()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	unlock()
+
+	for name, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("%s in flight during Close = %v, want nil", name, err)
+		}
+	}
+	<-closed
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Codec decodes records stored in a format other than JSON, such as files
+// from before a migration to JSON. Records in a codec's format are found by
+// their extension and are converted to JSON on read, so Read, ReadAll and
+// the rest of the API see them like any other record. Writes always store
+// JSON and remove the record's copies in other formats.
+type Codec interface {
+	// Ext is the file extension of the format, including the dot.
+	Ext() string
+
+	// Unmarshal decodes data into v, like json.Unmarshal.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Detector is implemented by codecs that can recognize their format from
+// its first bytes. Such codecs also decode records stored under the .json
+// extension whose content isn't JSON.
+type Detector interface {
+	Detect(data []byte) bool
+}
+
+// codecFor returns the codec registered for the extension of name.
+func (d *Driver) codecFor(name string) (Codec, bool) {
+	for _, codec := range d.codecs {
+		if strings.HasSuffix(name, codec.Ext()) {
+			return codec, true
+		}
+	}
+
+	return nil, false
+}
+
+// recordName is the package-level recordName extended to files in the
+// formats of the registered codecs.
+func (d *Driver) recordName(entry os.DirEntry) (string, bool) {
+	if name, ok := recordName(entry); ok || entry.IsDir() || internalFile(entry.Name()) {
+		return name, ok
+	}
+
+	if codec, ok := d.codecFor(entry.Name()); ok {
+		return strings.TrimSuffix(entry.Name(), codec.Ext()), true
+	}
+
+	return "", false
+}
+
+// decodeFile converts the content of a record file named name to JSON,
+// using the codec its extension or content calls for. JSON is returned as
+// is.
+func (d *Driver) decodeFile(name string, b []byte) ([]byte, error) {
+	codec, ok := d.codecFor(name)
+	if !ok {
+		if len(d.codecs) == 0 || json.Valid(b) {
+			return b, nil
+		}
+
+		for _, c := range d.codecs {
+			if detector, isDetector := c.(Detector); isDetector && detector.Detect(b) {
+				codec, ok = c, true
+				break
+			}
+		}
+		if !ok {
+			return b, nil
+		}
+	}
+
+	var v interface{}
+	if err := codec.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", name, err)
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("converting %s to JSON: %w", name, err)
+	}
+
+	if !bytes.HasSuffix(out, []byte("\n")) && d.trailingNewline {
+		out = append(out, '\n')
+	}
+	return out, nil
+}
+
+// readEncoded reads a record kept in the format of one of the registered
+// codecs, converted to JSON.
+func (d *Driver) readEncoded(collection, resource string) ([]byte, error) {
+	for _, root := range d.roots() {
+		for _, codec := range d.codecs {
+			path := filepath.Join(root, collection, resource+codec.Ext())
+
+			b, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			return d.decodeFile(path, b)
+		}
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: d.recordFile(collection, resource), Err: fs.ErrNotExist}
+}
+
+// removeEncoded deletes the copies of a record in the formats of the
+// registered codecs, after it was written as JSON. The caller must hold the
+// collection mutex.
+func (d *Driver) removeEncoded(collection, resource string) error {
+	for _, root := range d.roots() {
+		for _, codec := range d.codecs {
+			err := os.Remove(filepath.Join(root, collection, resource+codec.Ext()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteEncoded is deleteIn for the copies of a record in the formats of
+// the registered codecs, reporting whether there were any.
+func (d *Driver) deleteEncoded(collection, resource string) (bool, error) {
+	found := false
+
+	for _, root := range d.roots() {
+		for _, codec := range d.codecs {
+			rel := filepath.Join(collection, resource+codec.Ext())
+			if !isFile(filepath.Join(root, rel)) {
+				continue
+			}
+			found = true
+
+			var err error
+			switch {
+			case d.dryRun:
+				d.dryRunf("delete %s", rel)
+			case d.softDelete:
+				err = d.moveToTrash(root, rel)
+			default:
+				err = os.Remove(filepath.Join(root, rel))
+			}
+			if err != nil {
+				return found, err
+			}
+		}
+	}
+
+	return found, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// kvCodec decodes records stored as "key=value" lines.
+type kvCodec struct{}
+
+func (kvCodec) Ext() string { return ".kv" }
+
+func (kvCodec) Unmarshal(data []byte, v interface{}) error {
+	m := make(map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return errors.New("line without =")
+		}
+		m[key] = value
+	}
+
+	*v.(*interface{}) = m
+	return nil
+}
+
+func (kvCodec) Detect(data []byte) bool {
+	return !bytes.HasPrefix(data, []byte("{")) && bytes.Contains(data, []byte("="))
+}
+
+func TestCodecs(t *testing.T) {
+	d := newTestDriver(t, &Options{Codecs: []Codec{kvCodec{}}})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "dory.kv"), []byte("name=dory\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "dory", &got); err != nil || got.Name != "dory" {
+		t.Errorf("Read of a .kv record = %+v, %v", got, err)
+	}
+
+	records, err := d.ReadAllOrdered("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"dory", "nemo"}) {
+		t.Errorf("ReadAllOrdered = %v", got)
+	}
+
+	// Writing converts the record to JSON.
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory", Age: 1})
+	if _, err := os.Stat(filepath.Join(d.dir, "fish", "dory.kv")); !os.IsNotExist(err) {
+		t.Errorf("Write kept the .kv copy: %v", err)
+	}
+	if err := d.Read("fish", "dory", &got); err != nil || got.Age != 1 {
+		t.Errorf("Read after the rewrite = %+v, %v", got, err)
+	}
+}
+
+func TestCodecsDetectContent(t *testing.T) {
+	d := newTestDriver(t, &Options{Codecs: []Codec{kvCodec{}}})
+	if err := os.MkdirAll(filepath.Join(d.dir, "fish"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "nemo.json"), []byte("name=nemo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("Read of a .json file in another format = %+v, %v", got, err)
+	}
+}
+
+func TestCodecsDelete(t *testing.T) {
+	d := newTestDriver(t, &Options{Codecs: []Codec{kvCodec{}}})
+	if err := os.MkdirAll(filepath.Join(d.dir, "fish"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "dory.kv"), []byte("name=dory\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "fish", "dory.kv")); !os.IsNotExist(err) {
+		t.Errorf("Delete kept the .kv record: %v", err)
+	}
+}
+
+type jsonCodec struct{ kvCodec }
+
+func (jsonCodec) Ext() string { return ".json" }
+
+func TestCodecsInvalid(t *testing.T) {
+	for _, codecs := range [][]Codec{{nil}, {jsonCodec{}}} {
+		opts := &Options{Logger: discardLogger(), Codecs: codecs}
+		if _, err := New(filepath.Join(t.TempDir(), "db"), opts); err == nil {
+			t.Errorf("New with codecs %v succeeded", codecs)
+		}
+	}
+}
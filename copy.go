@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CopyCollection copies every record of src, along with its blobs and
+// sub-collections, into a new collection dst. With Options.UseHardLinks the
+// copies are hard links to the source files where the filesystem allows it.
+func (d *Driver) CopyCollection(src, dst string) (err error) {
+	defer wrapOp("CopyCollection", src, "", &err)
+
+	src, dst = d.key(src), d.key(dst)
+
+	if src == "" || dst == "" {
+		return fmt.Errorf("Missing collection - unable to copy!")
+	}
+
+	for _, name := range []string{src, dst} {
+		if isReserved(name) {
+			return fmt.Errorf("collection %s: %w", name, ErrReservedName)
+		}
+		if err := d.checkPath(name); err != nil {
+			return err
+		}
+	}
+
+	if src == dst {
+		return fmt.Errorf("collection %s: %w", dst, ErrAlreadyExists)
+	}
+
+	// Same fixed order as RenameCollection, so the two can't deadlock.
+	first, second := src, dst
+	if second < first {
+		first, second = second, first
+	}
+	deadline := d.deadline()
+	for _, name := range []string{first, second} {
+		unlock, err := d.acquire(name, name == src, deadline)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	var pairs [][2]string
+	for _, root := range d.roots() {
+		if _, err := os.Stat(filepath.Join(root, dst)); err == nil {
+			return fmt.Errorf("collection %s: %w", dst, ErrAlreadyExists)
+		}
+		if fi, err := os.Stat(filepath.Join(root, src)); err == nil && fi.IsDir() {
+			pairs = append(pairs, [2]string{filepath.Join(root, src), filepath.Join(root, dst)})
+		}
+	}
+
+	if d.singleFile {
+		if _, err := os.Stat(d.packedFile(dst)); err == nil {
+			return fmt.Errorf("collection %s: %w", dst, ErrAlreadyExists)
+		}
+		if _, err := os.Stat(d.packedFile(src)); err == nil {
+			pairs = append(pairs, [2]string{d.packedFile(src), d.packedFile(dst)})
+		}
+	}
+
+	if len(pairs) == 0 {
+		return fmt.Errorf("collection %s: %w", src, ErrNotFound)
+	}
+
+	if d.dryRun {
+		d.dryRunf("copy collection %s to %s", src, dst)
+		return nil
+	}
+
+	for _, pair := range pairs {
+		if err := d.copyTree(pair[0], pair[1]); err != nil {
+			return err
+		}
+	}
+	d.names.forget(dst)
+
+	d.log.Debugf("Copied collection %s to %s", src, dst)
+	return nil
+}
+
+// Snapshot copies the records of every collection into dir, which must not
+// exist yet, as a database New can open on its own. Records spread over
+// DataDirs are gathered into dir; trash, history and archives are left out.
+// Each collection is read-locked while it is copied, so the snapshot of a
+// collection is consistent but collections may be from different moments.
+// With Options.UseHardLinks the copies are hard links where the filesystem
+// allows it.
+func (d *Driver) Snapshot(dir string) (err error) {
+	defer wrapOp("Snapshot", "", "", &err)
+
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("snapshot %s: %w", dir, ErrAlreadyExists)
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		d.dryRunf("snapshot %d collections to %s", len(collections), dir)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := d.copyTree(filepath.Join(d.dir, metaFile), filepath.Join(dir, metaFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, collection := range collections {
+		if err := d.snapshotCollection(collection, dir); err != nil {
+			return err
+		}
+	}
+
+	d.log.Debugf("Snapshot of %s written to %s", d.dir, dir)
+	return nil
+}
+
+func (d *Driver) snapshotCollection(collection, dir string) error {
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, root := range d.roots() {
+		err := d.copyTree(filepath.Join(root, collection), filepath.Join(dir, collection))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if d.singleFile {
+		err := d.copyTree(d.packedFile(collection), filepath.Join(dir, collection+".json"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyTree copies the file or directory src to dst, skipping temp files.
+// Existing files under dst are replaced.
+func (d *Driver) copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+
+		return d.copyFile(path, target)
+	})
+}
+
+// copyFile copies a single file. With Options.UseHardLinks it links dst to
+// src instead, falling back to copying the bytes when linking fails, e.g.
+// across filesystems. Sharing the inode is safe because the driver never
+// rewrites a record in place: writes go to a temp file renamed over the
+// old name, which leaves the other link untouched.
+func (d *Driver) copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if d.hardLinks {
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
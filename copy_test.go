@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCopyCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish/reef", "marlin", fish{Name: "marlin"})
+
+	if err := d.CopyCollection("fish", "backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAll("backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fishNames(t, records), []string{"dory", "nemo"}; !slices.Equal(got, want) {
+		t.Errorf("copied records = %v, want %v", got, want)
+	}
+	if got := rawRecord(t, d, "backup/reef", "marlin"); got != rawRecord(t, d, "fish/reef", "marlin") {
+		t.Errorf("copied sub-collection record = %s", got)
+	}
+
+	// The copy is independent of the source.
+	mustWrite(t, d, "backup", "nemo", fish{Name: "nemo", Age: 2})
+	var f fish
+	if err := d.Read("fish", "nemo", &f); err != nil || f.Age != 0 {
+		t.Errorf("source after writing the copy = %+v, %v", f, err)
+	}
+}
+
+func TestCopyCollectionErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+
+	tests := []struct {
+		src, dst string
+		want     error
+	}{
+		{"fish", "fish", ErrAlreadyExists},
+		{"fish", "sharks", ErrAlreadyExists},
+		{"whales", "backup", ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := d.CopyCollection(tt.src, tt.dst); !errors.Is(err, tt.want) {
+			t.Errorf("CopyCollection(%q, %q) = %v, want %v", tt.src, tt.dst, err, tt.want)
+		}
+	}
+
+	if err := d.CopyCollection("", "backup"); err == nil {
+		t.Error("CopyCollection with no source succeeded")
+	}
+	if resources, err := d.ListResources("sharks"); err != nil || !slices.Equal(resources, []string{"bruce"}) {
+		t.Errorf("existing destination holds %v, %v, want [bruce]", resources, err)
+	}
+}
+
+func TestCopyCollectionHardLinks(t *testing.T) {
+	d := newTestDriver(t, &Options{UseHardLinks: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	if err := d.CopyCollection("fish", "backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.Stat(filepath.Join(d.dir, "fish", "nemo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := os.Stat(filepath.Join(d.dir, "backup", "nemo.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(src, dst) {
+		t.Error("copy isn't a hard link to the source")
+	}
+
+	// Writes replace the file rather than changing the shared inode.
+	mustWrite(t, d, "backup", "nemo", fish{Name: "nemo", Age: 2})
+	var f fish
+	if err := d.Read("fish", "nemo", &f); err != nil || f.Age != 0 {
+		t.Errorf("source after writing the linked copy = %+v, %v", f, err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	d := newTestDriver(t, &Options{DataDirs: []string{filepath.Join(t.TempDir(), "data")}})
+	for _, name := range []string{"nemo", "dory", "marlin", "bruce"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+	mustWrite(t, d, "fish", "anchor", fish{Name: "anchor"})
+	if err := d.Delete("fish", "anchor"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "snapshot")
+	if err := d.Snapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records from every data dir end up in the snapshot, which opens as a
+	// database of its own without the trash.
+	snap := openTestDriver(t, dir, nil)
+	records, err := snap.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fishNames(t, records), []string{"bruce", "dory", "marlin", "nemo"}; !slices.Equal(got, want) {
+		t.Errorf("snapshot records = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, trashDir)); !os.IsNotExist(err) {
+		t.Errorf("snapshot has a trash directory: %v", err)
+	}
+
+	if err := d.Snapshot(dir); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Snapshot to an existing dir = %v, want ErrAlreadyExists", err)
+	}
+}
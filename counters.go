@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+)
+
+// counterField is the field of a counter record holding its value.
+const counterField = "value"
+
+// Counters keeps named int64 counters in one collection, one record per
+// counter. Updates take the counter's record lock, like Increment, so
+// concurrent Inc calls never lose an update. Counters that were never
+// incremented read as zero.
+type Counters struct {
+	d          *Driver
+	collection string
+}
+
+// NewCounters returns the counters stored in collection of d.
+func NewCounters(d *Driver, collection string) *Counters {
+	return &Counters{d: d, collection: collection}
+}
+
+// Inc adds delta, which may be negative, to a counter and returns the new
+// value. It fails instead of overflowing.
+func (c *Counters) Inc(name string, delta int64) (_ int64, err error) {
+	defer wrapOp("Inc", c.collection, name, &err)
+
+	var n int64
+
+	err = c.d.updateRecord(c.collection, name, true, func(doc map[string]interface{}) error {
+		old, err := counterValue(doc)
+		if err != nil {
+			return fmt.Errorf("counter %s/%s: %w", c.collection, name, err)
+		}
+
+		n = old + delta
+		if (delta > 0 && n < old) || (delta < 0 && n > old) {
+			return fmt.Errorf("counter %s/%s would overflow adding %d to %d", c.collection, name, delta, old)
+		}
+
+		doc[counterField] = json.Number(strconv.FormatInt(n, 10))
+		return nil
+	})
+
+	return n, err
+}
+
+// Get returns the value of a counter.
+func (c *Counters) Get(name string) (_ int64, err error) {
+	defer wrapOp("Get", c.collection, name, &err)
+
+	doc, err := c.d.ReadMap(c.collection, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := counterValue(doc)
+	if err != nil {
+		return 0, fmt.Errorf("counter %s/%s: %w", c.collection, name, err)
+	}
+
+	return n, nil
+}
+
+// Reset sets a counter back to zero by deleting its record.
+func (c *Counters) Reset(name string) (err error) {
+	defer wrapOp("Reset", c.collection, name, &err)
+
+	d := c.d
+	collection, resource := d.key(c.collection), d.key(name)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquireRecord(collection, resource, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = d.delete(collection, resource)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func counterValue(doc map[string]interface{}) (int64, error) {
+	v, ok := doc[counterField]
+	if !ok {
+		return 0, nil
+	}
+
+	num, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("field %s is not a number", counterField)
+	}
+
+	return num.Int64()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+	d := newTestDriver(t, nil)
+	c := NewCounters(d, "counters")
+
+	if n, err := c.Get("hits"); err != nil || n != 0 {
+		t.Errorf("Get of a new counter = %d, %v, want 0", n, err)
+	}
+
+	for _, tt := range []struct{ delta, want int64 }{{5, 5}, {-7, -2}, {1 << 40, 1<<40 - 2}} {
+		n, err := c.Inc("hits", tt.delta)
+		if err != nil || n != tt.want {
+			t.Errorf("Inc(%d) = %d, %v, want %d", tt.delta, n, err, tt.want)
+		}
+	}
+	if n, err := c.Get("hits"); err != nil || n != 1<<40-2 {
+		t.Errorf("Get = %d, %v, want %d", n, err, int64(1<<40-2))
+	}
+
+	if err := c.Reset("hits"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Get("hits"); err != nil || n != 0 {
+		t.Errorf("Get after Reset = %d, %v, want 0", n, err)
+	}
+	if err := c.Reset("misses"); err != nil {
+		t.Errorf("Reset of a new counter = %v", err)
+	}
+}
+
+func TestCountersConcurrentInc(t *testing.T) {
+	d := newTestDriver(t, nil)
+	c := NewCounters(d, "counters")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Inc("hits", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, err := c.Get("hits"); err != nil || n != 20 {
+		t.Errorf("Get = %d, %v, want 20", n, err)
+	}
+}
+
+func TestCountersErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+	c := NewCounters(d, "counters")
+
+	if _, err := c.Inc("max", math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Inc("max", 1); err == nil {
+		t.Error("Inc past MaxInt64 succeeded")
+	}
+	if n, err := c.Get("max"); err != nil || n != math.MaxInt64 {
+		t.Errorf("Get after a failed Inc = %d, %v, want MaxInt64", n, err)
+	}
+
+	mustWrite(t, d, "counters", "broken", map[string]string{counterField: "many"})
+	if _, err := c.Get("broken"); err == nil {
+		t.Error("Get of a non-numeric counter succeeded")
+	}
+	if _, err := c.Inc("broken", 1); err == nil {
+		t.Error("Inc of a non-numeric counter succeeded")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+// DiffReport lists the differences between two collections by resource
+// name, each list sorted.
+type DiffReport struct {
+	OnlyInA []string
+	OnlyInB []string
+	Changed []string
+}
+
+// Equal reports whether the compared collections hold the same records.
+func (r DiffReport) Equal() bool {
+	return len(r.OnlyInA) == 0 && len(r.OnlyInB) == 0 && len(r.Changed) == 0
+}
+
+// Diff compares two collections. Records present in both are compared as
+// JSON values, so formatting and key order don't count as changes. A
+// collection that doesn't exist is treated as empty. The collections are
+// read one after the other, not as one snapshot.
+func (d *Driver) Diff(collectionA, collectionB string) (_ DiffReport, err error) {
+	defer wrapOp("Diff", collectionA, "", &err)
+
+	var report DiffReport
+
+	a, err := d.readAllMapOrEmpty(collectionA)
+	if err != nil {
+		return report, err
+	}
+
+	b, err := d.readAllMapOrEmpty(collectionB)
+	if err != nil {
+		return report, err
+	}
+
+	for resource, recordA := range a {
+		recordB, ok := b[resource]
+		switch {
+		case !ok:
+			report.OnlyInA = append(report.OnlyInA, resource)
+		case !sameJSON([]byte(recordA), []byte(recordB)):
+			report.Changed = append(report.Changed, resource)
+		}
+	}
+
+	for resource := range b {
+		if _, ok := a[resource]; !ok {
+			report.OnlyInB = append(report.OnlyInB, resource)
+		}
+	}
+
+	sort.Strings(report.OnlyInA)
+	sort.Strings(report.OnlyInB)
+	sort.Strings(report.Changed)
+
+	return report, nil
+}
+
+func (d *Driver) readAllMapOrEmpty(collection string) (map[string]string, error) {
+	records, err := d.ReadAllMap(collection)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return records, err
+}
+
+// sameJSON reports whether a and b encode the same JSON value. Content that
+// isn't JSON is compared byte for byte.
+func sameJSON(a, b []byte) bool {
+	na, errA := normalizeJSON(a)
+	nb, errB := normalizeJSON(b)
+	if errA != nil || errB != nil {
+		return bytes.Equal(a, b)
+	}
+
+	return bytes.Equal(na, nb)
+}
+
+// normalizeJSON re-encodes b with sorted keys and no whitespace. Numbers
+// are kept as written, so large integers aren't rounded.
+func normalizeJSON(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "a", "same", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "a", "changed", fish{Name: "dory"})
+	mustWrite(t, d, "a", "only-a", fish{Name: "marlin"})
+	if err := d.WriteJSON("b", "same", json.RawMessage(`{"age":1,"name":"nemo"}`)); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "b", "changed", fish{Name: "dory", Age: 2})
+	mustWrite(t, d, "b", "only-b", fish{Name: "bruce"})
+
+	report, err := d.Diff("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.OnlyInA, []string{"only-a"}) || !slices.Equal(report.OnlyInB, []string{"only-b"}) || !slices.Equal(report.Changed, []string{"changed"}) {
+		t.Errorf("Diff = %+v", report)
+	}
+	if report.Equal() {
+		t.Error("Equal reports differing collections as equal")
+	}
+}
+
+func TestDiffMissingCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "a", "nemo", fish{Name: "nemo"})
+
+	report, err := d.Diff("a", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.OnlyInA, []string{"nemo"}) || len(report.OnlyInB) != 0 {
+		t.Errorf("Diff against a missing collection = %+v", report)
+	}
+
+	if report, err := d.Diff("a", "a"); err != nil || !report.Equal() {
+		t.Errorf("Diff of a collection with itself = %+v, %v", report, err)
+	}
+}
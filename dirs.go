@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dirCache remembers directories known to exist, so writes to a collection
+// don't call MkdirAll every time. The driver forgets the directories it
+// deletes, renames or archives; an entry can still go stale when a
+// directory is removed by hand, which writes notice from the failed rename
+// and forget the entry.
+type dirCache struct {
+	mutex sync.Mutex
+	known map[string]bool
+}
+
+func (c *dirCache) has(dir string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.known[dir]
+}
+
+func (c *dirCache) add(dir string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.known == nil {
+		c.known = make(map[string]bool)
+	}
+	c.known[dir] = true
+}
+
+func (c *dirCache) forget(dir string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.known, dir)
+}
+
+// forgetTree forgets dir and every directory below it.
+func (c *dirCache) forgetTree(dir string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	prefix := dir + string(filepath.Separator)
+	for known := range c.known {
+		if known == dir || strings.HasPrefix(known, prefix) {
+			delete(c.known, known)
+		}
+	}
+}
+
+// forgetDirs forgets the cached directories at and below path, relative to
+// the database, in every data directory.
+func (d *Driver) forgetDirs(path string) {
+	for _, root := range d.roots() {
+		d.dirs.forgetTree(filepath.Join(root, path))
+	}
+}
+
+// ensureDir creates dir unless it is known to exist already.
+func (d *Driver) ensureDir(dir string) error {
+	if d.dirs.has(dir) {
+		return nil
+	}
+
+	if err := d.mkdirAll(dir); err != nil {
+		return err
+	}
+
+	d.dirs.add(dir)
+	return nil
+}
+
+// copyIntoDir is copyFileAtomic for a file in a directory from the cache.
+// If the directory turns out to be gone it is created again and the copy
+// retried. A retry needs r from the start: readers that can seek are
+// rewound, and any other reader is only retried if the first attempt
+// failed before reading from it.
+func (d *Driver) copyIntoDir(dir, path string, r io.Reader) error {
+	if err := d.ensureDir(dir); err != nil {
+		return err
+	}
+
+	seeker, seekable := r.(io.Seeker)
+	start := int64(0)
+	if seekable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seekable = false
+		}
+	}
+
+	counted := &countingReader{r: r}
+	src := io.Reader(counted)
+	if seekable {
+		src = r
+	}
+
+	err := d.copyFileAtomic(path, src)
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	d.dirs.forget(dir)
+
+	if seekable {
+		if _, seekErr := seeker.Seek(start, io.SeekStart); seekErr != nil {
+			return err
+		}
+	} else if counted.n > 0 {
+		return err
+	}
+
+	if err := d.ensureDir(dir); err != nil {
+		return err
+	}
+
+	return d.copyFileAtomic(path, r)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
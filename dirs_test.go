@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteAfterCollectionRemoved(t *testing.T) {
+	for name, opts := range map[string]*Options{
+		"next to the record": nil,
+		"TempDir":            {TempDir: t.TempDir()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := newTestDriver(t, opts)
+			mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+			// The collection directory is still cached as existing.
+			if err := os.RemoveAll(filepath.Join(d.dir, "fish")); err != nil {
+				t.Fatal(err)
+			}
+
+			mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+			var got fish
+			if err := d.Read("fish", "dory", &got); err != nil || got.Name != "dory" {
+				t.Errorf("Read fish/dory = %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestWriteRawAfterDriverRemovedDir(t *testing.T) {
+	for name, remove := range map[string]func(d *Driver) error{
+		"Delete": func(d *Driver) error { return d.Delete("sea/fish", "") },
+		"Delete sub-collection": func(d *Driver) error {
+			return d.Delete("sea", "fish")
+		},
+		"RenameCollection": func(d *Driver) error {
+			return d.RenameCollection("sea/fish", "sea/shark")
+		},
+		"ArchiveCollection": func(d *Driver) error { return d.ArchiveCollection("sea/fish") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := newTestDriver(t, &Options{TempDir: t.TempDir()})
+			mustWrite(t, d, "sea/fish", "nemo", fish{Name: "nemo"})
+			if err := remove(d); err != nil {
+				t.Fatal(err)
+			}
+
+			// A MultiReader can't be rewound, so the write only succeeds
+			// if the removed directory wasn't cached any more.
+			src := io.MultiReader(strings.NewReader(`{"name":"dory"}`))
+			if err := d.WriteRaw("sea/fish", "dory", src); err != nil {
+				t.Fatalf("WriteRaw after %s = %v", name, err)
+			}
+			var got fish
+			if err := d.Read("sea/fish", "dory", &got); err != nil || got.Name != "dory" {
+				t.Errorf("Read sea/fish/dory = %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestCopyIntoDirNonSeekableReader(t *testing.T) {
+	// Without a TempDir the temp file is created in dir, so a missing dir
+	// is noticed before anything is read and the copy can be retried.
+	d := newTestDriver(t, nil)
+	dir := filepath.Join(d.dir, "fish")
+	d.dirs.add(dir)
+
+	src := strings.NewReader(`{"name":"nemo"}`)
+	if err := d.copyIntoDir(dir, filepath.Join(dir, "nemo.json"), io.MultiReader(src)); err != nil {
+		t.Fatalf("copyIntoDir into a removed dir = %v", err)
+	}
+	if got := rawRecord(t, d, "fish", "nemo"); got != `{"name":"nemo"}` {
+		t.Errorf("fish/nemo = %s", got)
+	}
+
+	// With a TempDir the first attempt drains the reader before the rename
+	// fails, and there's nothing left to retry with.
+	d = newTestDriver(t, &Options{TempDir: t.TempDir()})
+	dir = filepath.Join(d.dir, "fish")
+	d.dirs.add(dir)
+
+	src = strings.NewReader(`{"name":"nemo"}`)
+	err := d.copyIntoDir(dir, filepath.Join(dir, "nemo.json"), io.MultiReader(src))
+	if !os.IsNotExist(err) {
+		t.Errorf("copyIntoDir with a drained reader = %v, want a not-exist error", err)
+	}
+	if isFile(filepath.Join(dir, "nemo.json")) {
+		t.Error("copyIntoDir wrote a record from a drained reader")
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	d := newTestDriver(b, nil)
+	nemo := fish{Name: "nemo", Age: 1}
+
+	for name, collection := range map[string]string{"Collection": "fish", "SubCollection": "sea/reef/fish"} {
+		b.Run(name+"/cached", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := d.Write(collection, "nemo", nemo); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		// Forgetting the directory before every write costs each one a
+		// MkdirAll, as without the cache.
+		b.Run(name+"/uncached", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				d.forgetDirs(collection)
+				if err := d.Write(collection, "nemo", nemo); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
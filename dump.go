@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Dump returns every record of the database, by collection and resource,
+// as stored. Only top-level collections are included, like Collections
+// returns them; the driver's own files, metadata sidecars and temp files
+// are left out. Each collection is read under its read lock, so a dump is
+// consistent per collection but not across them. It is meant for small
+// databases, as everything is held in memory.
+func (d *Driver) Dump() (_ map[string]map[string]json.RawMessage, err error) {
+	defer wrapOp("Dump", "", "", &err)
+
+	collections, err := d.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	dump := make(map[string]map[string]json.RawMessage, len(collections))
+
+	for _, collection := range collections {
+		records := make(map[string]json.RawMessage)
+
+		err := d.eachRecord(collection, func(resource string, b []byte) (bool, error) {
+			records[resource] = json.RawMessage(b)
+			return true, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("collection %s: %w", collection, err)
+		}
+
+		dump[collection] = records
+	}
+
+	d.log.Debugf("Dumped %d collections of %s", len(dump), d.dir)
+	return dump, nil
+}
+
+// Load writes every record of data, by collection and resource as Dump
+// returns them, storing each as given. Records that already exist are
+// replaced when overwrite is set and left alone otherwise; the check and the
+// write happen under the collection lock, so a record written meanwhile is
+// never clobbered. Collections and resources are written in order and Load
+// stops at the first failure, leaving the records written before it.
+// PartitionBy isn't consulted: new records of a partitioned collection are
+// stored outside any partition.
+func (d *Driver) Load(data map[string]map[string]json.RawMessage, overwrite bool) (err error) {
+	defer wrapOp("Load", "", "", &err)
+
+	collections := make([]string, 0, len(data))
+	for collection := range data {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	written := 0
+	for _, collection := range collections {
+		resources := make([]string, 0, len(data[collection]))
+		for resource := range data[collection] {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+
+		for _, resource := range resources {
+			ok, err := d.restoreRecord(collection, resource, data[collection][resource], overwrite)
+			if err != nil {
+				return fmt.Errorf("record %s/%s: %w", collection, resource, err)
+			}
+			if ok {
+				written++
+			}
+		}
+	}
+
+	d.log.Debugf("Loaded %d records into %s", written, d.dir)
+	return nil
+}
+
+// restoreRecord writes one record for Load and reports whether it did.
+func (d *Driver) restoreRecord(collection, resource string, raw json.RawMessage, overwrite bool) (bool, error) {
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return false, err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquire(collection, false, deadline)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if !overwrite {
+		_, err := d.readRecord(collection, resource)
+		if err == nil || errors.Is(err, ErrEmptyRecord) {
+			return false, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	r, err := d.resolve(collection, resource, bytes.NewReader(raw))
+	if err != nil {
+		return false, err
+	}
+
+	return true, d.writeLocked(collection, resource, r, deadline)
+}
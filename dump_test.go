@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish/reef", "marlin", fish{Name: "marlin"})
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+	mustWrite(t, d, "sharks", "anchor", fish{Name: "anchor"})
+	if err := d.Delete("sharks", "anchor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetRecordMeta("fish", "nemo", map[string]string{"owner": "marlin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteBlob("fish", "nemo", "photo", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := d.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only top-level collections and their records, as stored.
+	if len(dump) != 2 || len(dump["fish"]) != 2 || len(dump["sharks"]) != 1 {
+		t.Fatalf("Dump = %v, want fish with 2 records and sharks with 1", dump)
+	}
+	for collection, records := range dump {
+		for resource, raw := range records {
+			if want := rawRecord(t, d, collection, resource); string(raw) != want {
+				t.Errorf("dump of %s/%s = %s, want %s", collection, resource, raw, want)
+			}
+		}
+	}
+}
+
+func TestDumpEmpty(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	dump, err := d.Dump()
+	if err != nil || len(dump) != 0 {
+		t.Errorf("Dump of an empty database = %v, %v, want nothing", dump, err)
+	}
+}
+
+func TestLoadRoundTrip(t *testing.T) {
+	src := newTestDriver(t, nil)
+	mustWrite(t, src, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, src, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, src, "sharks", "bruce", fish{Name: "bruce"})
+	dump, err := src.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestDriver(t, nil)
+	if err := d.Load(dump, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for collection, records := range dump {
+		for resource := range records {
+			if got, want := rawRecord(t, d, collection, resource), rawRecord(t, src, collection, resource); got != want {
+				t.Errorf("loaded %s/%s = %s, want %s", collection, resource, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadOverwrite(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	data := map[string]map[string]json.RawMessage{
+		"fish": {
+			"nemo": json.RawMessage(`{"name":"nemo","age":2}`),
+			"dory": json.RawMessage(`{"name":"dory"}`),
+		},
+	}
+
+	// Existing records are left alone without overwrite.
+	if err := d.Load(data, false); err != nil {
+		t.Fatal(err)
+	}
+	var f fish
+	if err := d.Read("fish", "nemo", &f); err != nil || f.Age != 1 {
+		t.Errorf("fish/nemo = %+v, %v, want the existing age 1", f, err)
+	}
+	if err := d.Read("fish", "dory", &f); err != nil || f.Name != "dory" {
+		t.Errorf("fish/dory = %+v, %v, want it loaded", f, err)
+	}
+
+	if err := d.Load(data, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := rawRecord(t, d, "fish", "nemo"); got != `{"name":"nemo","age":2}` {
+		t.Errorf("fish/nemo with overwrite = %s", got)
+	}
+}
+
+func TestLoadStopsAtFirstError(t *testing.T) {
+	d := newTestDriver(t, nil)
+	data := map[string]map[string]json.RawMessage{
+		"fish": {
+			"dory":      json.RawMessage(`{"name":"dory"}`),
+			"nemo.meta": json.RawMessage(`{}`),
+			"squirt":    json.RawMessage(`{"name":"squirt"}`),
+		},
+	}
+
+	if err := d.Load(data, false); err == nil {
+		t.Fatal("Load of an invalid resource name succeeded")
+	}
+
+	// Resources are loaded in order, so dory made it and squirt didn't.
+	if resources, _ := d.ListResources("fish"); !slices.Equal(resources, []string{"dory"}) {
+		t.Errorf("fish after the failed Load = %v, want [dory]", resources)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Error is the error returned by the methods and functions of the package,
+// such as Read, Write, Delete, ReadAll, Dump and the generic helpers like
+// UpdateFunc and QueryPage. It names the operation and the collection and
+// resource it was called with, empty for operations taking none, and wraps
+// the cause, so errors.Is still matches sentinels like ErrNotFound and
+// fs.ErrNotExist. Use errors.As to get at the fields. Errors os.IsNotExist
+// recognizes, which it can only do without wrapping, are returned as they
+// are, so existing os.IsNotExist checks keep working; they name the file
+// that is missing instead.
+type Error struct {
+	Op         string
+	Collection string
+	Resource   string
+	Err        error
+}
+
+// Error returns the message of the wrapped error, which already names the
+// record where that helps.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// opError wraps a non-nil err from the method op in an *Error, unless it
+// already is one, e.g. from a method op is built on, or os.IsNotExist
+// recognizes it.
+func opError(op, collection, resource string, err error) error {
+	if err == nil || os.IsNotExist(err) {
+		return err
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	return &Error{Op: op, Collection: collection, Resource: resource, Err: err}
+}
+
+// wrapOp is opError for methods returning their error through err, for use
+// in a defer.
+func wrapOp(op, collection, resource string, err *error) {
+	*err = opError(op, collection, resource, *err)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestErrorNamesOperation(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	err := d.Write("fish", "bubbles", make(chan int))
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Write error %v isn't an *Error", err)
+	}
+	if e.Op != "Write" || e.Collection != "fish" || e.Resource != "bubbles" {
+		t.Errorf("Error = %+v, want Write of fish/bubbles", e)
+	}
+	if e.Error() != e.Err.Error() {
+		t.Errorf("Error() = %q, want the wrapped message %q", e.Error(), e.Err.Error())
+	}
+
+	// Sentinel errors are still found through the wrapper.
+	if _, err := d.WriteAll(trashDir, nil); !errors.Is(err, ErrReservedName) || !errors.As(err, &e) || e.Op != "WriteAll" {
+		t.Errorf("WriteAll of a reserved collection = %v, want an *Error for WriteAll wrapping ErrReservedName", err)
+	}
+}
+
+func TestErrorKeepsInnermostOperation(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	failed, err := d.WriteAll("fish", map[string]interface{}{"bubbles": make(chan int)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e *Error
+	if !errors.As(failed["bubbles"], &e) || e.Op != "Write" {
+		t.Errorf("WriteAll failure = %#v, want an *Error for Write", failed["bubbles"])
+	}
+	if wrapped := opError("WriteAll", "fish", "", failed["bubbles"]); wrapped != failed["bubbles"] {
+		t.Errorf("opError wrapped an *Error again: %v", wrapped)
+	}
+}
+
+func TestErrorNotExist(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	// Not-exist errors stay as they are, so os.IsNotExist keeps working.
+	if err := d.Read("fish", "nemo", &fish{}); !os.IsNotExist(err) {
+		t.Errorf("Read of a missing record = %v, want os.IsNotExist", err)
+	}
+	if err := opError("Read", "fish", "nemo", nil); err != nil {
+		t.Errorf("opError(nil) = %v", err)
+	}
+}
+
+func TestErrorFromEveryEntryPoint(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	users := NewTypedDriver[User](d, "users")
+	keyed := NewKeyed(d, "users", func(u User) string { return u.Name })
+	counters := NewCounters(d, "counters")
+	ring := newTestDriver(t, &Options{DataDirs: []string{t.TempDir(), t.TempDir()}})
+	d.Close()
+	ring.Close()
+
+	every := func(fish) bool { return true }
+	for op, call := range map[string]func() error{
+		"Snapshot": func() error { return d.Snapshot(t.TempDir()) },
+		"Inc":      func() error { _, err := counters.Inc("hits", 1); return err },
+		"Get":      func() error { _, err := counters.Get("hits"); return err },
+		"Reset":    func() error { return counters.Reset("hits") },
+		"Diff":     func() error { _, err := d.Diff("fish", "sharks"); return err },
+		"Dump":     func() error { _, err := d.Dump(); return err },
+		"Load": func() error {
+			return d.Load(map[string]map[string]json.RawMessage{"fish": {"dory": json.RawMessage(`{}`)}}, false)
+		},
+		"Fsck":            func() error { _, err := d.Fsck(); return err },
+		"DBVersion":       func() error { _, err := d.DBVersion(); return err },
+		"Meta":            func() error { _, err := d.Meta(); return err },
+		"SetMeta":         func() error { return d.SetMeta("owner", "marlin") },
+		"ReadAllUnion":    func() error { _, err := d.ReadAllUnion("fish", "sharks"); return err },
+		"Collections":     func() error { _, err := d.Collections(); return err },
+		"CollectionStats": func() error { _, err := d.CollectionStats(); return err },
+		"MapReduce": func() error {
+			_, err := MapReduce(d, "fish", func(fish) int { return 1 }, func(acc, n int) int { return acc + n }, 0)
+			return err
+		},
+		"ReadAllTypedMap": func() error { _, err := ReadAllTypedMap[fish](d, "fish"); return err },
+		"DeleteWhere":     func() error { _, err := DeleteWhere(d, "fish", every); return err },
+		"CountWhere":      func() error { _, err := CountWhere(d, "fish", every); return err },
+		"FindOne":         func() error { _, _, err := FindOne(d, "fish", every); return err },
+		"QueryPage":       func() error { _, _, err := QueryPage(d, "fish", QueryOptions[fish]{}); return err },
+		"TransformAll": func() error {
+			_, err := TransformAll(d, "fish", func(f fish) (fish, error) { return f, nil })
+			return err
+		},
+		"WriteAndRead": func() error { _, err := WriteAndRead[fish](d, "fish", "nemo", fish{Name: "nemo"}); return err },
+		"UpdateFunc": func() error {
+			return UpdateFunc(d, "fish", "nemo", func(f fish) (fish, error) { return f, nil }, 0)
+		},
+		"Rebalance":      func() error { _, err := ring.Rebalance(); return err },
+		"StressTest":     func() error { _, err := StressTest(d, StressConfig{Collection: "stress"}); return err },
+		"Sync":           func() error { return d.Sync() },
+		"PurgeTrash":     func() error { return d.PurgeTrash() },
+		"WalkAll":        func() error { return d.WalkAll(func(string, string, []byte) error { return nil }) },
+		"Put":            func() error { return users.Put("Zoro", User{Name: "Zoro"}) },
+		"All":            func() error { _, err := users.All(); return err },
+		"KeyedStore.Put": func() error { return keyed.Put(User{Name: "Zoro"}) },
+	} {
+		err := call()
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s = %v, want an *Error", op, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EventPolicy controls what happens to an event when the channel Events
+// returns is full.
+type EventPolicy int
+
+const (
+	// DropEvents discards the event, so a slow consumer never holds up
+	// writes.
+	DropEvents EventPolicy = iota
+
+	// BlockOnEvents makes the write or delete wait until the consumer makes
+	// room. Close waits for such operations too.
+	BlockOnEvents
+)
+
+// defaultEventBuffer is the capacity of the Events channel when
+// Options.EventBuffer isn't set.
+const defaultEventBuffer = 64
+
+// OpEvent reports a write or delete made through the driver.
+type OpEvent struct {
+	Op         ChangeOp
+	Collection string
+	// Resource is empty when a whole collection was deleted.
+	Resource string
+	Time     time.Time
+}
+
+// eventStream hands OpEvents to the channel returned by Events, which is
+// only created once someone asks for it.
+type eventStream struct {
+	mutex  sync.Mutex
+	ch     chan OpEvent
+	size   int
+	block  bool
+	closed bool
+}
+
+// Events returns a channel receiving an OpEvent for every successful write
+// and delete made through this driver, including those done on behalf of
+// other operations such as Increment or Truncate. Changes made by other
+// processes aren't reported; see WatchResource for those. Events are only
+// produced from the first call on, and every call returns the same channel,
+// so there is a single consumer. What happens when the buffer is full
+// depends on Options.EventPolicy. The channel is closed by Close.
+func (d *Driver) Events() <-chan OpEvent {
+	s := &d.events
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ch == nil {
+		s.ch = make(chan OpEvent, s.size)
+		if s.closed {
+			close(s.ch)
+		}
+	}
+
+	return s.ch
+}
+
+// emit reports a change to the Events consumer, if there is one.
+func (d *Driver) emit(op ChangeOp, collection, resource string) {
+	s := &d.events
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ch == nil || s.closed {
+		return
+	}
+
+	ev := OpEvent{Op: op, Collection: collection, Resource: resource, Time: time.Now()}
+
+	if s.block {
+		s.ch <- ev
+		return
+	}
+
+	select {
+	case s.ch <- ev:
+	default:
+		d.log.Debugf("Dropped %s event for %s/%s, Events channel full", op, collection, resource)
+	}
+}
+
+// close ends the stream. Operations must be done, so nothing sends on the
+// channel anymore.
+func (s *eventStream) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ch != nil && !s.closed {
+		close(s.ch)
+	}
+	s.closed = true
+}
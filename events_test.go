@@ -0,0 +1,101 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "marlin", fish{Name: "marlin"})
+
+	// Events only start with the first call, and every call shares the
+	// channel.
+	events := d.Events()
+	if d.Events() != events {
+		t.Error("Events returned a different channel on the second call")
+	}
+
+	start := time.Now()
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if _, err := d.Increment("counters", "hits", "total", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("fish", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := <-events
+	if ev.Time.Before(start) {
+		t.Errorf("event time %v is before the write at %v", ev.Time, start)
+	}
+	got := append([]string{string(ev.Op) + " " + ev.Collection + "/" + ev.Resource}, drainEvents(events)...)
+	want := []string{"write fish/nemo", "write counters/hits", "delete fish/nemo", "delete fish/"}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestEventsDropWhenFull(t *testing.T) {
+	d := newTestDriver(t, &Options{EventBuffer: 1})
+	events := d.Events()
+
+	for _, name := range []string{"nemo", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+
+	if got := drainEvents(events); !slices.Equal(got, []string{"write fish/nemo"}) {
+		t.Errorf("events = %v, want only the first write", got)
+	}
+}
+
+func TestEventsBlockWhenFull(t *testing.T) {
+	d := newTestDriver(t, &Options{EventBuffer: 1, EventPolicy: BlockOnEvents})
+	events := d.Events()
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	written := make(chan error, 1)
+	go func() { written <- d.Write("fish", "dory", fish{Name: "dory"}) }()
+
+	select {
+	case err := <-written:
+		t.Fatalf("Write returned with the Events channel full: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if ev := <-events; ev.Resource != "nemo" {
+		t.Errorf("first event for %s, want nemo", ev.Resource)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-events; ev.Resource != "dory" {
+		t.Errorf("second event for %s, want dory", ev.Resource)
+	}
+}
+
+func TestEventsClosedByClose(t *testing.T) {
+	d := newTestDriver(t, nil)
+	events := d.Events()
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	d.Close()
+
+	// Buffered events are still delivered before the channel reports closed.
+	if ev, ok := <-events; !ok || ev.Resource != "nemo" {
+		t.Errorf("event after Close = %+v, %v, want the buffered write", ev, ok)
+	}
+	if _, ok := <-events; ok {
+		t.Error("Events channel still open after Close")
+	}
+
+	later := newTestDriver(t, nil)
+	later.Close()
+	if _, ok := <-later.Events(); ok {
+		t.Error("Events after Close returned an open channel")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadField returns the raw JSON value at a dotted path inside a record,
+// such as "Address.City" or "Tags.0". The record is scanned with a streaming
+// decoder, so only the requested value is held in memory, which keeps huge
+// documents cheap to query.
+func (d *Driver) ReadField(collection, resource, path string) (_ json.RawMessage, err error) {
+	defer wrapOp("ReadField", collection, resource, &err)
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing field path - unable to read field!")
+	}
+
+	f, err := d.ReadRaw(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw, err := extractField(f, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", collection, resource, err)
+	}
+
+	return raw, nil
+}
+
+// Pluck returns the raw JSON value at a dotted path, as for ReadField, in
+// every record of a collection, keyed by resource name. Records without the
+// field are left out.
+func (d *Driver) Pluck(collection, path string) (_ map[string]json.RawMessage, err error) {
+	defer wrapOp("Pluck", collection, "", &err)
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing field path - unable to read field!")
+	}
+
+	values := make(map[string]json.RawMessage)
+	err = d.eachRecord(collection, func(resource string, b []byte) (bool, error) {
+		raw, err := extractField(bytes.NewReader(b), path)
+		if errors.Is(err, ErrNotFound) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%s/%s: %w", collection, resource, err)
+		}
+
+		values[resource] = raw
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// extractField streams a JSON document from r and returns the value at the
+// dotted path, or an error wrapping ErrNotFound if the path doesn't exist.
+func extractField(r io.Reader, path string) (json.RawMessage, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	for _, part := range strings.Split(path, ".") {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			if err := seekKey(dec, part); err != nil {
+				return nil, fieldError(path, err)
+			}
+
+		case json.Delim('['):
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 {
+				return nil, fieldError(path, ErrNotFound)
+			}
+			if err := seekIndex(dec, i); err != nil {
+				return nil, fieldError(path, err)
+			}
+
+		default:
+			return nil, fieldError(path, ErrNotFound)
+		}
+	}
+
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+func fieldError(path string, err error) error {
+	return fmt.Errorf("field %s: %w", path, err)
+}
+
+// seekKey advances dec, positioned just inside an object, to the value of
+// key, skipping the values of every other key.
+func seekKey(dec *json.Decoder, key string) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if tok == key {
+			return nil
+		}
+
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+
+	return ErrNotFound
+}
+
+// seekIndex advances dec, positioned just inside an array, to element i.
+func seekIndex(dec *json.Decoder, i int) error {
+	for n := 0; dec.More(); n++ {
+		if n == i {
+			return nil
+		}
+
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+
+	return ErrNotFound
+}
+
+// skipValue consumes the next value from dec without keeping it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+// compact returns raw without insignificant whitespace.
+func compact(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		t.Fatalf("compacting %q: %v", raw, err)
+	}
+
+	return buf.String()
+}
+
+func TestReadField(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "users", "zoro", map[string]interface{}{
+		"Name":    "Zoro",
+		"Tags":    []string{"swords", "naps"},
+		"Address": map[string]interface{}{"City": "Shimotsuki", "Geo": []int{1, 2}},
+	})
+
+	for path, want := range map[string]string{
+		"Name":          `"Zoro"`,
+		"Tags.1":        `"naps"`,
+		"Address":       `{"City":"Shimotsuki","Geo":[1,2]}`,
+		"Address.City":  `"Shimotsuki"`,
+		"Address.Geo.0": `1`,
+	} {
+		raw, err := d.ReadField("users", "zoro", path)
+		if err != nil {
+			t.Errorf("ReadField %s: %v", path, err)
+			continue
+		}
+		if got := compact(t, raw); got != want {
+			t.Errorf("ReadField %s = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestReadFieldNotFound(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "users", "zoro", map[string]interface{}{"Name": "Zoro", "Tags": []string{"swords"}})
+
+	for _, path := range []string{"Age", "Tags.3", "Tags.x", "Name.First"} {
+		if _, err := d.ReadField("users", "zoro", path); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ReadField %s = %v, want ErrNotFound", path, err)
+		}
+	}
+
+	if _, err := d.ReadField("users", "zoro", ""); err == nil {
+		t.Error("ReadField with an empty path succeeded")
+	}
+}
+
+func TestPluck(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "users", "zoro", map[string]interface{}{"Address": map[string]string{"City": "Shimotsuki"}})
+	mustWrite(t, d, "users", "nami", map[string]interface{}{"Address": map[string]string{"City": "Cocoyasi"}})
+	mustWrite(t, d, "users", "luffy", map[string]interface{}{"Name": "Luffy"})
+
+	values, err := d.Pluck("users", "Address.City")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Records without the field are left out.
+	want := map[string]string{"zoro": `"Shimotsuki"`, "nami": `"Cocoyasi"`}
+	if len(values) != len(want) {
+		t.Errorf("Pluck = %v, want %v", values, want)
+	}
+	for resource, raw := range values {
+		if got := compact(t, raw); got != want[resource] {
+			t.Errorf("Pluck %s = %s, want %s", resource, got, want[resource])
+		}
+	}
+}
+
+func TestPluckUsers(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeUsers(t, d)
+
+	for _, path := range []string{"Company", "Address.City"} {
+		values, err := d.Pluck("users", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != len(demoUsers) {
+			t.Errorf("Pluck %s returned %d values, want %d", path, len(values), len(demoUsers))
+		}
+
+		for _, user := range demoUsers {
+			want := user.Company
+			if path == "Address.City" {
+				want = user.Address.City
+			}
+
+			var got string
+			if err := json.Unmarshal(values[user.Name], &got); err != nil || got != want {
+				t.Errorf("Pluck %s of %s = %s, %v, want %q", path, user.Name, values[user.Name], err, want)
+			}
+		}
+	}
+}
+
+func TestPluckErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "users", "zoro", map[string]string{"Name": "Zoro"})
+
+	if _, err := d.Pluck("users", ""); err == nil {
+		t.Error("Pluck with an empty path succeeded")
+	}
+	if _, err := d.Pluck("pirates", "Name"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Pluck of a missing collection = %v, want os.ErrNotExist", err)
+	}
+}
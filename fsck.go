@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FsckReport is the result of Fsck. Paths are those of the files on disk.
+type FsckReport struct {
+	Collections int
+	Records     int
+
+	// TempFiles are temp files left behind by interrupted writes, which
+	// maintenance removes.
+	TempFiles []string
+
+	// Unreadable are record files that couldn't be read, with the error.
+	Unreadable map[string]error
+
+	// Empty are zero-byte record files, including reservations not written
+	// yet.
+	Empty []string
+
+	// Corrupt are record files that don't decode: invalid JSON, or invalid
+	// for the codec or UnmarshalFunc they are read with.
+	Corrupt map[string]error
+}
+
+// OK reports whether Fsck found nothing wrong.
+func (r FsckReport) OK() bool {
+	return len(r.TempFiles) == 0 && len(r.Unreadable) == 0 && len(r.Empty) == 0 && len(r.Corrupt) == 0
+}
+
+// Fsck checks every collection and record of the database and reports what
+// is wrong, without changing anything. Each collection directory is checked
+// under its read lock, so writes in progress don't show up as temp files.
+// The driver's own storage, such as the trash and history, isn't checked.
+func (d *Driver) Fsck() (_ FsckReport, err error) {
+	defer wrapOp("Fsck", "", "", &err)
+
+	report := FsckReport{Unreadable: make(map[string]error), Corrupt: make(map[string]error)}
+
+	for _, root := range d.roots() {
+		collections, err := collectionDirs(root)
+		if err != nil {
+			return report, err
+		}
+
+		for _, collection := range collections {
+			if err := d.fsckCollection(root, collection, &report); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if d.singleFile {
+		packed, err := d.packedCollections()
+		if err != nil {
+			return report, err
+		}
+
+		for _, collection := range packed {
+			if err := d.fsckPacked(collection, &report); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	d.log.Debugf("Checked %d records in %d collections of %s", report.Records, report.Collections, d.dir)
+	return report, nil
+}
+
+// collectionDirs returns the collection directories under root, nested
+// ones included, relative to root. The driver's dot-directories are left
+// out.
+func collectionDirs(root string) ([]string, error) {
+	var collections []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || path == root {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		collections = append(collections, rel)
+		return nil
+	})
+
+	return collections, err
+}
+
+func (d *Driver) fsckCollection(root, collection string, report *FsckReport) error {
+	unlock, err := d.acquire(d.collectionOf(collection), true, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Join(root, collection)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	report.Collections++
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		if entry.IsDir() {
+			continue
+		}
+
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			report.TempFiles = append(report.TempFiles, path)
+			continue
+		}
+
+		if _, ok := d.recordName(entry); !ok {
+			continue
+		}
+		report.Records++
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			report.Unreadable[path] = err
+			continue
+		}
+
+		if len(b) == 0 {
+			report.Empty = append(report.Empty, path)
+			continue
+		}
+
+		if err := d.checkDecodes(entry.Name(), b); err != nil {
+			report.Corrupt[path] = err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) fsckPacked(collection string, report *FsckReport) error {
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := d.packedFile(collection)
+	report.Collections++
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		report.Unreadable[path] = err
+		return nil
+	}
+
+	var records map[string]json.RawMessage
+	if err := json.Unmarshal(b, &records); err != nil {
+		report.Corrupt[path] = err
+		return nil
+	}
+	report.Records += len(records)
+
+	for resource, raw := range records {
+		if err := d.checkDecodes(".json", raw); err != nil {
+			report.Corrupt[path] = fmt.Errorf("record %s: %w", resource, err)
+		}
+	}
+
+	return nil
+}
+
+// checkDecodes returns why the content b of the record file name can't be
+// read back, or nil if it can.
+func (d *Driver) checkDecodes(name string, b []byte) error {
+	b, err := d.decodeFile(name, b)
+	if err != nil {
+		return err
+	}
+
+	if d.unmarshalFunc == nil {
+		if !json.Valid(b) {
+			var v interface{}
+			return json.Unmarshal(b, &v)
+		}
+		return nil
+	}
+
+	var v interface{}
+	return d.unmarshal(b, &v)
+}
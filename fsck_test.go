@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFsckHealthy(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish/reef", "marlin", fish{Name: "marlin"})
+	if err := d.Delete("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Fsck of a healthy database = %+v", report)
+	}
+
+	// The trash isn't checked.
+	if report.Collections != 2 || report.Records != 2 {
+		t.Errorf("Fsck checked %d records in %d collections, want 2 in 2", report.Records, report.Collections)
+	}
+}
+
+func TestFsckProblems(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	dir := filepath.Join(d.dir, "fish")
+
+	files := map[string]string{
+		"tmp":     filepath.Join(dir, "nemo.json.1234.tmp"),
+		"empty":   filepath.Join(dir, "dory.json"),
+		"corrupt": filepath.Join(dir, "marlin.json"),
+	}
+	for name, content := range map[string]string{"tmp": "{", "empty": "", "corrupt": `{"name":`} {
+		if err := os.WriteFile(files[name], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unreadable := filepath.Join(dir, "bruce.json")
+	if err := os.Symlink(filepath.Join(dir, "gone.json"), unreadable); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Error("Fsck reported OK")
+	}
+	if !slices.Equal(report.TempFiles, []string{files["tmp"]}) {
+		t.Errorf("TempFiles = %v, want %s", report.TempFiles, files["tmp"])
+	}
+	if !slices.Equal(report.Empty, []string{files["empty"]}) {
+		t.Errorf("Empty = %v, want %s", report.Empty, files["empty"])
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[files["corrupt"]] == nil {
+		t.Errorf("Corrupt = %v, want %s", report.Corrupt, files["corrupt"])
+	}
+	if len(report.Unreadable) != 1 || report.Unreadable[unreadable] == nil {
+		t.Errorf("Unreadable = %v, want %s", report.Unreadable, unreadable)
+	}
+	if report.Records != 4 {
+		t.Errorf("Records = %d, want 4", report.Records)
+	}
+
+	// Nothing is repaired.
+	if _, err := os.Stat(files["tmp"]); err != nil {
+		t.Errorf("Fsck removed the temp file: %v", err)
+	}
+}
+
+func TestFsckSingleFile(t *testing.T) {
+	d := newTestDriver(t, &Options{SingleFilePerCollection: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	report, err := d.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Collections != 1 || report.Records != 2 {
+		t.Errorf("Fsck = %+v, want 2 healthy records in 1 collection", report)
+	}
+
+	if err := os.WriteFile(d.packedFile("fish"), []byte(`{"nemo":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = d.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[d.packedFile("fish")] == nil {
+		t.Errorf("Corrupt = %v, want the collection file", report.Corrupt)
+	}
+}
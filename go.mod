@@ -3,6 +3,8 @@ module github.com/SaurabPoudel/asura_db
 go 1.23.5
 
 require (
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/sirupsen/logrus v1.9.3
 )
+
+require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestDriver opens a database in a fresh temp directory with logging
+// discarded, and closes it when the test ends.
+func newTestDriver(t testing.TB, opts *Options) *Driver {
+	t.Helper()
+
+	return openTestDriver(t, filepath.Join(t.TempDir(), "db"), opts)
+}
+
+// openTestDriver opens the database at dir, e.g. to reopen one a test
+// created earlier.
+func openTestDriver(t testing.TB, dir string, opts *Options) *Driver {
+	t.Helper()
+
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Logger == nil && !o.LogJSON {
+		o.Logger = discardLogger()
+	}
+
+	d, err := New(dir, &o)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+// discardLogger returns a logger that drops everything, for tests that
+// call New themselves.
+func discardLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	return log
+}
+
+type fish struct {
+	Name string `json:"name"`
+	Age  int    `json:"age,omitempty"`
+}
+
+// demoUsers are users like the ones main writes, with ages and companies
+// that differ, so queries over them have something to tell apart.
+var demoUsers = []User{
+	{"Smoker", "23", "9234923492", "Surya Tech", Address{"logue town", "Kinki", "Japan", "008"}},
+	{"Zoro", "21", "9234923492", "Asura Tech", Address{"Shimotsuki Village", "East Blue", "Mars", "008"}},
+	{"Benn", "23", "9234923492", "Yantra Tech", Address{"Shanks' Ship", "Grand Line", "Nepal", "008"}},
+	{"Sabo", "22", "9234923492", "Asura Tech", Address{"Baltigo", "Grand Line", "Equador", "008"}},
+}
+
+// writeUsers writes demoUsers to the users collection, keyed by name.
+func writeUsers(t testing.TB, d *Driver) {
+	t.Helper()
+
+	for _, user := range demoUsers {
+		mustWrite(t, d, "users", user.Name, user)
+	}
+}
+
+// mustWrite writes v or fails the test.
+func mustWrite(t testing.TB, d *Driver, collection, resource string, v interface{}) {
+	t.Helper()
+
+	if err := d.Write(collection, resource, v); err != nil {
+		t.Fatalf("Write %s/%s: %v", collection, resource, err)
+	}
+}
+
+// fishNames decodes records holding fish and returns their names in order.
+func fishNames(t testing.TB, records []string) []string {
+	t.Helper()
+
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		var f fish
+		if err := json.Unmarshal([]byte(record), &f); err != nil {
+			t.Fatalf("decoding %q: %v", record, err)
+		}
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+// rawRecord returns the stored bytes of a record.
+func rawRecord(t testing.TB, d *Driver, collection, resource string) string {
+	t.Helper()
+
+	b, err := d.ReadBytes(collection, resource, nil)
+	if err != nil {
+		t.Fatalf("ReadBytes %s/%s: %v", collection, resource, err)
+	}
+
+	return string(b)
+}
+
+// boolPtr returns a pointer to b, for the *bool options.
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// drainEvents returns the events already waiting on ch, as "op
+// collection/resource" strings in the order they were sent.
+func drainEvents(ch <-chan OpEvent) []string {
+	var events []string
+	for {
+		select {
+		case ev := <-ch:
+			events = append(events, string(ev.Op)+" "+ev.Collection+"/"+ev.Resource)
+		default:
+			return events
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// historyDir holds previous versions of records written while KeepHistory is
+// set: .history/<collection>/<resource>/<n>.json, where n increases with
+// every write, or <n>.<partition>.json for a record stored in a partition.
+const historyDir = ".history"
+
+// History returns the stored previous versions of a record, oldest first.
+func (d *Driver) History(collection, resource string) (_ []string, err error) {
+	defer wrapOp("History", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read history!")
+	}
+
+	if isReserved(collection) {
+		return nil, fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if resource == "" {
+		return nil, fmt.Errorf("Missing resource - unable to read history (no name)!")
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	dir := filepath.Join(d.dir, historyDir, collection, resource)
+	versions, err := historyVersions(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]string, 0, len(versions))
+	for _, v := range versions {
+		b, err := os.ReadFile(filepath.Join(dir, v.file))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, string(b))
+	}
+
+	return records, nil
+}
+
+// Rollback replaces a record with one of its previous versions. version is
+// an index into the slice returned by History. The replaced content is itself
+// kept in history, so a rollback can be undone.
+func (d *Driver) Rollback(collection, resource string, version int) (err error) {
+	defer wrapOp("Rollback", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to roll back record!")
+	}
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to roll back record (no name)!")
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquire(collection, false, deadline)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Join(d.dir, historyDir, collection, resource)
+	versions, err := historyVersions(dir)
+	if err != nil {
+		return err
+	}
+
+	if version < 0 || version >= len(versions) {
+		return fmt.Errorf("unable to find version %d of %s/%s", version, collection, resource)
+	}
+
+	v := versions[version]
+	b, err := os.ReadFile(filepath.Join(dir, v.file))
+	if err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		d.dryRunf("roll back %s/%s to version %d", collection, resource, version)
+		return nil
+	}
+
+	// A version goes back into the partition it was written to.
+	if d.partitioned(collection) {
+		err = d.writeIntoPartition(collection, resource, v.partition, bytes.NewReader(b), deadline)
+	} else {
+		err = d.writeLocked(collection, resource, bytes.NewReader(b), deadline)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.log.Debugf("Rolled back %s/%s to version %d", collection, resource, version)
+	return nil
+}
+
+// stashHistory copies the current content of a record into its history and
+// drops the oldest versions beyond d.keepHistory. The caller must hold the
+// collection mutex.
+func (d *Driver) stashHistory(collection, resource string) error {
+	if d.keepHistory <= 0 {
+		return nil
+	}
+
+	// A reservation or an empty file has no content worth keeping.
+	b, err := d.readRecord(collection, resource)
+	if noContent(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(d.dir, historyDir, collection, resource)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	versions, err := historyVersions(dir)
+	if err != nil {
+		return err
+	}
+
+	next := historyVersion{n: 1, partition: d.partitionOf(collection, resource)}
+	if len(versions) > 0 {
+		next.n = versions[len(versions)-1].n + 1
+	}
+	next.file = next.name()
+
+	if err := d.writeFileAtomic(filepath.Join(dir, next.file), b); err != nil {
+		return err
+	}
+
+	versions = append(versions, next)
+	for len(versions) > d.keepHistory {
+		if err := os.Remove(filepath.Join(dir, versions[0].file)); err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+
+	return nil
+}
+
+// historyVersion is one stored version of a record. The partition is kept
+// so Rollback can put the version back where it was.
+type historyVersion struct {
+	n         int
+	partition string
+	file      string
+}
+
+func (v historyVersion) name() string {
+	if v.partition == "" {
+		return strconv.Itoa(v.n) + ".json"
+	}
+
+	return strconv.Itoa(v.n) + "." + v.partition + ".json"
+}
+
+// historyVersions returns the versions stored in dir in ascending order. A
+// missing directory has no versions.
+func historyVersions(dir string) ([]historyVersion, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []historyVersion
+	for _, file := range files {
+		base, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok {
+			continue
+		}
+
+		num, partition, _ := strings.Cut(base, ".")
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, historyVersion{n: n, partition: partition, file: file.Name()})
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].n < versions[j].n })
+	return versions, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryKeepsBoundedVersions(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 2})
+	for age := 1; age <= 4; age++ {
+		mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: age})
+	}
+
+	history, err := d.History("fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("History has %d versions, want 2", len(history))
+	}
+	for i, want := range []int{2, 3} {
+		var got fish
+		if err := json.Unmarshal([]byte(history[i]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Age != want {
+			t.Errorf("version %d has age %d, want %d", i, got.Age, want)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 5})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	if err := d.Rollback("fish", "nemo", 0); err != nil {
+		t.Fatal(err)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 1 {
+		t.Fatalf("after Rollback = %+v, %v", got, err)
+	}
+
+	// The rolled back content is kept, so the rollback can be undone.
+	history, err := d.History("fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Rollback("fish", "nemo", len(history)-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("after undoing Rollback = %+v, %v", got, err)
+	}
+
+	if err := d.Rollback("fish", "nemo", 99); err == nil {
+		t.Error("Rollback to a missing version succeeded")
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	history, err := d.History("fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Errorf("History = %v, want none without KeepHistory", history)
+	}
+}
+
+func TestHistoryEscape(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 5})
+
+	for _, name := range []string{"../fish", "fish/../../nemo"} {
+		if _, err := d.History(name, "nemo"); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("History of %s = %v, want ErrInvalidName", name, err)
+		}
+		if err := d.Rollback(name, "nemo", 0); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Rollback of %s = %v, want ErrInvalidName", name, err)
+		}
+	}
+	if _, err := d.History("fish", "../../nemo"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("History of an escaping resource = %v, want ErrInvalidName", err)
+	}
+	if err := d.Rollback(historyDir, "nemo", 0); !errors.Is(err, ErrReservedName) {
+		t.Errorf("Rollback in the history area = %v, want ErrReservedName", err)
+	}
+}
+
+func TestHistorySharesTheCollectionLock(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 5})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	unlock, err := d.acquire("fish", true, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.History("fish", "nemo")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("History waited for another reader to finish")
+	}
+}
+
+func TestRollbackPartitioned(t *testing.T) {
+	d := newPartitionedDriver(t, Options{KeepHistory: 5})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	if err := d.Rollback("fish", "nemo", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old version goes back into its own partition.
+	if !isFile(filepath.Join(d.dir, "fish", "age-1", "nemo.json")) || isFile(filepath.Join(d.dir, "fish", "age-2", "nemo.json")) {
+		t.Error("Rollback left the record in the partition of the replaced version")
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 1 {
+		t.Errorf("Read after Rollback = %+v, %v", got, err)
+	}
+
+	// Undoing the rollback moves it back.
+	history, err := d.History("fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Rollback("fish", "nemo", len(history)-1); err != nil {
+		t.Fatal(err)
+	}
+	if records, err := d.ReadAllPartition("fish", "age-2"); err != nil || len(records) != 1 {
+		t.Errorf("age-2 after undoing Rollback = %v, %v, want nemo", records, err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHookPanic is returned when a user-supplied callback, such as a
+// ConflictResolver, NameFunc, PartitionBy function or IndexFunc, panics.
+// The error carries the recovered value; locks taken by the operation are
+// released and the driver stays usable.
+var ErrHookPanic = errors.New("hook panicked")
+
+// recoverHook converts a panic in the callback named hook into an error
+// wrapping ErrHookPanic, stored in *err. Use it deferred, in a function
+// that does nothing but call the callback.
+func recoverHook(hook string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%s: %v: %w", hook, r, ErrHookPanic)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookPanics(t *testing.T) {
+	boom := func() { panic("boom") }
+
+	tests := []struct {
+		name string
+		opts *Options
+		op   func(d *Driver) error
+	}{
+		{
+			name: "MarshalFunc",
+			opts: &Options{MarshalFunc: func(v interface{}) ([]byte, error) { boom(); return nil, nil }},
+			op:   func(d *Driver) error { return d.Write("fish", "nemo", fish{Name: "nemo"}) },
+		},
+		{
+			name: "UnmarshalFunc",
+			opts: &Options{UnmarshalFunc: func(data []byte, v interface{}) error { boom(); return nil }},
+			op:   func(d *Driver) error { return d.Read("fish", "dory", &fish{}) },
+		},
+		{
+			name: "ConflictResolver",
+			opts: &Options{ConflictResolver: func(existing, incoming []byte) ([]byte, error) { boom(); return nil, nil }},
+			op:   func(d *Driver) error { return d.Write("fish", "dory", fish{Name: "dory"}) },
+		},
+		{
+			name: "NameFunc",
+			opts: &Options{NameFunc: func(collection, resource string) string { boom(); return "" }},
+			op:   func(d *Driver) error { return d.Write("fish", "nemo", fish{Name: "nemo"}) },
+		},
+		{
+			name: "PartitionBy",
+			opts: &Options{PartitionBy: map[string]func(v interface{}) string{"fish": func(v interface{}) string { boom(); return "" }}},
+			op:   func(d *Driver) error { return d.Write("fish", "nemo", fish{Name: "nemo"}) },
+		},
+		{
+			name: "IDGenerator",
+			opts: &Options{IDGenerator: func() string { boom(); return "" }},
+			op:   func(d *Driver) error { _, err := d.WriteAuto("fish", fish{Name: "nemo"}); return err },
+		},
+		{
+			name: "IndexFunc",
+			op: func(d *Driver) error {
+				return d.CreateIndex("fish", "name", func(data []byte) (string, bool) { boom(); return "", false })
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, tt.opts)
+			// Hooks may panic on every write, so the collection is seeded
+			// by a driver without them.
+			mustWrite(t, openTestDriver(t, d.dir, nil), "fish", "dory", fish{Name: "dory"})
+
+			err := tt.op(d)
+			if !errors.Is(err, ErrHookPanic) {
+				t.Fatalf("error = %v, want ErrHookPanic", err)
+			}
+			if !strings.Contains(err.Error(), tt.name) || !strings.Contains(err.Error(), "boom") {
+				t.Errorf("error %q doesn't name the hook and the panic value", err)
+			}
+
+			// The operation's locks are released and the driver still works.
+			locked := make(chan func(), 1)
+			go func() { locked <- d.LockCollection("fish") }()
+			select {
+			case unlock := <-locked:
+				unlock()
+			case <-time.After(5 * time.Second):
+				t.Fatal("collection still locked after the panic")
+			}
+			if _, err := d.ListResources("fish"); err != nil {
+				t.Errorf("ListResources after the panic = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+)
+
+// WriteAuto stores v as a new record named by the IDGenerator and returns
+// the name. It fails with ErrAlreadyExists instead of overwriting a record
+// if the generator repeats itself.
+func (d *Driver) WriteAuto(collection string, v interface{}) (_ string, err error) {
+	defer wrapOp("WriteAuto", collection, "", &err)
+
+	b, err := d.marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := d.newID()
+	if err != nil {
+		return "", err
+	}
+
+	collection, resource := d.key(collection), d.key(id)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return "", err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquireRecord(collection, resource, deadline)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if _, err := d.readRecord(collection, resource); !os.IsNotExist(err) {
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("record %s/%s: %w", collection, resource, ErrAlreadyExists)
+	}
+
+	if err := d.writeValue(collection, resource, v, bytes.NewReader(b), deadline); err != nil {
+		return "", err
+	}
+
+	return resource, nil
+}
+
+// newID returns a record name from the configured IDGenerator, or a random
+// UUID if there is none.
+func (d *Driver) newID() (id string, err error) {
+	if d.idGenerator != nil {
+		defer recoverHook("IDGenerator", &err)
+		return d.idGenerator(), nil
+	}
+
+	return newUUID(), nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		// crypto/rand doesn't fail on supported platforms.
+		panic(err)
+	}
+
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
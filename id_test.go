@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestWriteAuto(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	id, err := d.WriteAuto("fish", fish{Name: "nemo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !uuidPattern.MatchString(id) {
+		t.Errorf("WriteAuto named the record %q, want a version 4 UUID", id)
+	}
+
+	var got fish
+	if err := d.Read("fish", id, &got); err != nil || got.Name != "nemo" {
+		t.Errorf("Read %s = %+v, %v", id, got, err)
+	}
+
+	other, err := d.WriteAuto("fish", fish{Name: "dory"})
+	if err != nil || other == id {
+		t.Errorf("second WriteAuto = %q, %v, want a new name", other, err)
+	}
+}
+
+func TestWriteAutoIDGenerator(t *testing.T) {
+	next := 0
+	d := newTestDriver(t, &Options{IDGenerator: func() string {
+		next++
+		return "fish-1"
+	}})
+
+	id, err := d.WriteAuto("fish", fish{Name: "nemo"})
+	if err != nil || id != "fish-1" {
+		t.Fatalf("WriteAuto = %q, %v, want fish-1", id, err)
+	}
+
+	// A generator repeating itself doesn't overwrite the record.
+	if _, err := d.WriteAuto("fish", fish{Name: "dory"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("WriteAuto with a repeated name = %v, want ErrAlreadyExists", err)
+	}
+	var got fish
+	if err := d.Read("fish", "fish-1", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("record after a repeated name = %+v, %v", got, err)
+	}
+	if next != 2 {
+		t.Errorf("IDGenerator called %d times, want 2", next)
+	}
+}
+
+func TestWriteAutoSequentialIDs(t *testing.T) {
+	next := 0
+	d := newTestDriver(t, &Options{IDGenerator: func() string {
+		next++
+		return fmt.Sprintf("user-%d", next)
+	}})
+
+	for i, name := range []string{"Zoro", "Nami", "Usopp"} {
+		id, err := d.WriteAuto("users", User{Name: name})
+		if want := fmt.Sprintf("user-%d", i+1); err != nil || id != want {
+			t.Errorf("WriteAuto of %s = %q, %v, want %s", name, id, err, want)
+		}
+	}
+
+	var got User
+	if err := d.Read("users", "user-2", &got); err != nil || got.Name != "Nami" {
+		t.Errorf("Read user-2 = %+v, %v, want Nami", got, err)
+	}
+}
+
+func TestWriteAutoPartitioned(t *testing.T) {
+	d := newPartitionedDriver(t, Options{IDGenerator: func() string { return "nemo" }})
+
+	if _, err := d.WriteAuto("fish", fish{Name: "nemo", Age: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(d.dir, "fish", "age-3", "nemo.json")) {
+		t.Error("WriteAuto ignored PartitionBy")
+	}
+	if records, err := d.ReadAllPartition("fish", "age-3"); err != nil || len(records) != 1 {
+		t.Errorf("ReadAllPartition = %v, %v, want the auto-written record", records, err)
+	}
+
+	// The partitioned record is found when the generator repeats itself.
+	if _, err := d.WriteAuto("fish", fish{Name: "dory", Age: 4}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("WriteAuto with a repeated name = %v, want ErrAlreadyExists", err)
+	}
+}
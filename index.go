@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// IndexFunc extracts the key a record is indexed under from its stored
+// bytes. Returning false leaves the record out of the index.
+type IndexFunc func(data []byte) (key string, ok bool)
+
+// index is an in-memory secondary index over one collection, mapping index
+// keys to the resources that have them.
+type index struct {
+	fn         IndexFunc
+	entries    map[string]map[string]struct{}
+	byResource map[string]string
+}
+
+func newIndex(fn IndexFunc) *index {
+	return &index{
+		fn:         fn,
+		entries:    make(map[string]map[string]struct{}),
+		byResource: make(map[string]string),
+	}
+}
+
+func (ix *index) put(resource string, data []byte) (err error) {
+	ix.remove(resource)
+
+	defer recoverHook("IndexFunc", &err)
+
+	key, ok := ix.fn(data)
+	if !ok {
+		return nil
+	}
+
+	if ix.entries[key] == nil {
+		ix.entries[key] = make(map[string]struct{})
+	}
+	ix.entries[key][resource] = struct{}{}
+	ix.byResource[resource] = key
+	return nil
+}
+
+func (ix *index) remove(resource string) {
+	key, ok := ix.byResource[resource]
+	if !ok {
+		return
+	}
+
+	delete(ix.entries[key], resource)
+	if len(ix.entries[key]) == 0 {
+		delete(ix.entries, key)
+	}
+	delete(ix.byResource, resource)
+}
+
+// CreateIndex registers a secondary index on a collection and builds it from
+// the current records. Write, Delete and Restore keep it up to date; after
+// changing files by hand, call Reindex.
+func (d *Driver) CreateIndex(collection, name string, fn IndexFunc) (err error) {
+	defer wrapOp("CreateIndex", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to create index!")
+	}
+
+	if name == "" {
+		return fmt.Errorf("Missing index name - unable to create index!")
+	}
+
+	d.indexMutex.Lock()
+	if d.indexes == nil {
+		d.indexes = make(map[string]map[string]*index)
+	}
+	if d.indexes[collection] == nil {
+		d.indexes[collection] = make(map[string]*index)
+	}
+	d.indexes[collection][name] = newIndex(fn)
+	d.indexMutex.Unlock()
+
+	return d.Reindex(collection)
+}
+
+// Lookup returns the resources of a collection whose index key is key,
+// sorted by name.
+func (d *Driver) Lookup(collection, name, key string) (_ []string, err error) {
+	defer wrapOp("Lookup", collection, "", &err)
+
+	collection = d.key(collection)
+
+	d.indexMutex.RLock()
+	defer d.indexMutex.RUnlock()
+
+	ix, ok := d.indexes[collection][name]
+	if !ok {
+		return nil, fmt.Errorf("index %s on %s: %w", name, collection, ErrNotFound)
+	}
+
+	resources := make([]string, 0, len(ix.entries[key]))
+	for resource := range ix.entries[key] {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	return resources, nil
+}
+
+// Reindex rebuilds every index registered on a collection by scanning its
+// records. It is the recovery path after records were changed behind the
+// driver's back, e.g. by bulk imports or manual edits.
+func (d *Driver) Reindex(collection string) (err error) {
+	defer wrapOp("Reindex", collection, "", &err)
+
+	collection = d.key(collection)
+
+	d.indexMutex.RLock()
+	registered := make(map[string]*index, len(d.indexes[collection]))
+	for name, ix := range d.indexes[collection] {
+		registered[name] = ix
+	}
+	d.indexMutex.RUnlock()
+
+	if len(registered) == 0 {
+		return nil
+	}
+
+	// A shared lock keeps writers out while scanning, so no update is lost
+	// between the scan and the swap below.
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	rebuilt := make(map[string]*index, len(registered))
+	for name, ix := range registered {
+		rebuilt[name] = newIndex(ix.fn)
+	}
+
+	resources, err := d.listResources(collection)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, resource := range resources {
+		b, err := d.readRecord(collection, resource)
+		if noContent(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, ix := range rebuilt {
+			if err := ix.put(resource, b); err != nil {
+				return fmt.Errorf("indexing %s/%s: %w", collection, resource, err)
+			}
+		}
+	}
+
+	d.indexMutex.Lock()
+	for name, ix := range rebuilt {
+		// Leave alone indexes replaced by CreateIndex while rebuilding.
+		if d.indexes[collection][name] == registered[name] {
+			d.indexes[collection][name] = ix
+		}
+	}
+	d.indexMutex.Unlock()
+
+	d.log.Debugf("Reindexed %s (%d indexes)", collection, len(rebuilt))
+	return nil
+}
+
+// reindexRecord refreshes the index entries of a record after it was
+// written. The caller must hold the collection mutex.
+func (d *Driver) reindexRecord(collection, resource string) error {
+	d.indexMutex.RLock()
+	n := len(d.indexes[collection])
+	d.indexMutex.RUnlock()
+
+	if n == 0 {
+		return nil
+	}
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	for _, ix := range d.indexes[collection] {
+		if err := ix.put(resource, b); err != nil {
+			return fmt.Errorf("indexing %s/%s: %w", collection, resource, err)
+		}
+	}
+
+	return nil
+}
+
+// unindex drops a deleted record, or a whole collection when resource is
+// empty, from the collection's indexes.
+func (d *Driver) unindex(collection, resource string) {
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	for name, ix := range d.indexes[collection] {
+		if resource == "" {
+			d.indexes[collection][name] = newIndex(ix.fn)
+			continue
+		}
+		ix.remove(resource)
+	}
+}
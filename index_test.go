@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// byCity indexes users by the City field of their record.
+func byCity(data []byte) (string, bool) {
+	var u struct{ City string }
+	if err := json.Unmarshal(data, &u); err != nil || u.City == "" {
+		return "", false
+	}
+
+	return u.City, true
+}
+
+func TestIndexLookup(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "users", "zoro", map[string]string{"City": "Shimotsuki"})
+	mustWrite(t, d, "users", "luffy", map[string]string{"City": "Foosha"})
+
+	if err := d.CreateIndex("users", "city", byCity); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records written after the index was created are indexed too.
+	mustWrite(t, d, "users", "kuina", map[string]string{"City": "Shimotsuki"})
+	mustWrite(t, d, "users", "nami", map[string]string{})
+
+	lookup := func(city string) []string {
+		t.Helper()
+		resources, err := d.Lookup("users", "city", city)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resources
+	}
+
+	if got := lookup("Shimotsuki"); !slices.Equal(got, []string{"kuina", "zoro"}) {
+		t.Errorf("Lookup = %v, want [kuina zoro]", got)
+	}
+
+	mustWrite(t, d, "users", "zoro", map[string]string{"City": "Wano"})
+	if got := lookup("Shimotsuki"); !slices.Equal(got, []string{"kuina"}) {
+		t.Errorf("Lookup after a rewrite = %v, want [kuina]", got)
+	}
+
+	if err := d.Delete("users", "kuina"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("Shimotsuki"); len(got) != 0 {
+		t.Errorf("Lookup after Delete = %v, want none", got)
+	}
+	if err := d.Restore("users", "kuina"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("Shimotsuki"); !slices.Equal(got, []string{"kuina"}) {
+		t.Errorf("Lookup after Restore = %v, want [kuina]", got)
+	}
+
+	if _, err := d.Lookup("users", "age", "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup of an unknown index = %v, want ErrNotFound", err)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	d := newTestDriver(t, nil)
+	if err := d.CreateIndex("users", "city", byCity); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "users", "zoro", map[string]string{"City": "Shimotsuki"})
+
+	if err := os.WriteFile(filepath.Join(d.dir, "users", "zoro.json"), []byte(`{"City":"Wano"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reindex("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := d.Lookup("users", "city", "Wano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resources, []string{"zoro"}) {
+		t.Errorf("Lookup after Reindex = %v, want [zoro]", resources)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RecordInfo describes a stored record, as returned by Inspect.
+type RecordInfo struct {
+	Collection string
+	Resource   string
+
+	// Value is the decoded record.
+	Value interface{}
+
+	// Path is the file holding the record, which in single-file mode is
+	// the collection file. Size is the size of the record itself.
+	Path    string
+	Size    int64
+	ModTime time.Time
+
+	// Checksum is the hex SHA-256 of the stored bytes.
+	Checksum string
+
+	// Versions is the number of previous versions kept in history.
+	Versions int
+}
+
+// Inspect returns a record together with where and how it is stored, for
+// debugging.
+func (d *Driver) Inspect(collection, resource string) (_ RecordInfo, err error) {
+	defer wrapOp("Inspect", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+	info := RecordInfo{Collection: collection, Resource: resource}
+
+	if collection == "" {
+		return info, fmt.Errorf("Missing collection - unable to inspect!")
+	}
+
+	if resource == "" {
+		return info, fmt.Errorf("Missing resource - unable to inspect (no name)!")
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return info, err
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return info, err
+	}
+	defer unlock()
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return info, err
+	}
+
+	info.Path = d.recordFile(collection, resource)
+	if d.singleFile {
+		info.Path = d.packedFile(collection)
+	}
+
+	fi, err := os.Stat(info.Path)
+	if err != nil {
+		return info, err
+	}
+	info.Size = int64(len(b))
+	info.ModTime = fi.ModTime()
+
+	sum := sha256.Sum256(b)
+	info.Checksum = hex.EncodeToString(sum[:])
+
+	versions, err := historyVersions(filepath.Join(d.dir, historyDir, collection, resource))
+	if err != nil {
+		return info, err
+	}
+	info.Versions = len(versions)
+
+	if err := d.checkJSON(collection, resource, b); err != nil {
+		return info, err
+	}
+
+	return info, d.unmarshal(b, &info.Value)
+}
+
+// ChangedSince returns, sorted, the records of a collection whose files were
+// modified after since, for incremental syncs. Only the files' metadata is
+// read. In single-file mode every record shares the collection file's
+// modification time. Deleted records aren't reported.
+func (d *Driver) ChangedSince(collection string, since time.Time) (_ []string, err error) {
+	defer wrapOp("ChangedSince", collection, "", &err)
+
+	collection = d.key(collection)
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(resources)
+
+	var changed []string
+	for _, resource := range resources {
+		modTime, err := d.modTime(collection, resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if modTime.After(since) {
+			changed = append(changed, resource)
+		}
+	}
+
+	return changed, nil
+}
+
+// modTime returns the modification time of the file holding a record. The
+// caller must hold the collection mutex.
+func (d *Driver) modTime(collection, resource string) (time.Time, error) {
+	if d.singleFile {
+		fi, err := os.Stat(d.packedFile(collection))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return fi.ModTime(), nil
+	}
+
+	fi, err := os.Stat(d.recordFile(collection, resource))
+	if err == nil {
+		return fi.ModTime(), nil
+	}
+
+	for _, root := range d.roots() {
+		for _, codec := range d.codecs {
+			if fi, err := os.Stat(filepath.Join(root, collection, resource+codec.Ext())); err == nil {
+				return fi.ModTime(), nil
+			}
+		}
+	}
+
+	return time.Time{}, err
+}
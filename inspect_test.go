@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 3})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+
+	info, err := d.Inspect("fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := rawRecord(t, d, "fish", "nemo")
+	sum := sha256.Sum256([]byte(stored))
+	if info.Path != filepath.Join(d.dir, "fish", "nemo.json") || info.Size != int64(len(stored)) || info.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("Inspect = %+v", info)
+	}
+	if info.Versions != 1 || info.ModTime.IsZero() {
+		t.Errorf("Inspect versions and mod time = %d, %v", info.Versions, info.ModTime)
+	}
+	if value, ok := info.Value.(map[string]interface{}); !ok || value["name"] != "nemo" {
+		t.Errorf("Inspect value = %#v", info.Value)
+	}
+
+	if _, err := d.Inspect("fish", "dory"); !os.IsNotExist(err) {
+		t.Errorf("Inspect of a missing record = %v, want not exist", err)
+	}
+}
+
+func TestChangedSince(t *testing.T) {
+	d := newTestDriver(t, nil)
+	hourAgo := time.Now().Add(-time.Hour)
+	for _, name := range []string{"nemo", "dory", "marlin", "bruce"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		if err := os.Chtimes(filepath.Join(d.dir, "fish", name+".json"), hourAgo, hourAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := time.Now().Add(-time.Minute)
+
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory", Age: 2})
+	if err := d.Delete("fish", "bruce"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := d.ChangedSince("fish", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dory", "nemo"}; !slices.Equal(changed, want) {
+		t.Errorf("ChangedSince = %v, want %v", changed, want)
+	}
+
+	if changed, err := d.ChangedSince("fish", time.Now().Add(time.Minute)); err != nil || len(changed) != 0 {
+		t.Errorf("ChangedSince a later time = %v, %v, want nothing", changed, err)
+	}
+	if _, err := d.ChangedSince("sharks", since); !os.IsNotExist(err) {
+		t.Errorf("ChangedSince of a missing collection = %v, want a not-exist error", err)
+	}
+}
+
+func TestChangedSinceSingleFile(t *testing.T) {
+	d := newTestDriver(t, &Options{SingleFilePerCollection: true})
+	since := time.Now().Add(-time.Minute)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	// Every record carries the modification time of the collection file.
+	changed, err := d.ChangedSince("fish", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dory", "nemo"}; !slices.Equal(changed, want) {
+		t.Errorf("ChangedSince = %v, want %v", changed, want)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExportJSONL writes every record of a collection to w as compact JSON, one
+// record per line, ordered by resource key.
+func (d *Driver) ExportJSONL(collection string, w io.Writer) (err error) {
+	defer wrapOp("ExportJSONL", collection, "", &err)
+
+	records, err := d.ReadAllOrdered(collection)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	var buf bytes.Buffer
+
+	for _, record := range records {
+		buf.Reset()
+		if err := json.Compact(&buf, []byte(record)); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+
+		if _, err := bw.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ImportJSONL writes one record per line of r into a collection, using the
+// value of keyField in each object as the resource name. Blank lines are
+// skipped. It returns the number of records written.
+func (d *Driver) ImportJSONL(collection string, r io.Reader, keyField string) (_ int, err error) {
+	defer wrapOp("ImportJSONL", collection, "", &err)
+
+	if keyField == "" {
+		return 0, fmt.Errorf("Missing key field - unable to name imported records!")
+	}
+
+	br := bufio.NewReader(r)
+	count := 0
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return count, err
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var fields map[string]interface{}
+			dec := json.NewDecoder(bytes.NewReader(line))
+			dec.UseNumber()
+			if err := dec.Decode(&fields); err != nil {
+				return count, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+
+			key, ok := fields[keyField]
+			if !ok || key == nil || fmt.Sprint(key) == "" {
+				return count, fmt.Errorf("line %d: missing key field %q", lineNo, keyField)
+			}
+
+			if err := d.Write(collection, fmt.Sprint(key), json.RawMessage(line)); err != nil {
+				return count, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			count++
+		}
+
+		if err == io.EOF {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportJSONL(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory", Age: 5})
+
+	var buf bytes.Buffer
+	if err := d.ExportJSONL("fish", &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\"name\":\"dory\",\"age\":5}\n{\"name\":\"nemo\",\"age\":1}\n"
+	if buf.String() != want {
+		t.Errorf("ExportJSONL = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestImportJSONL(t *testing.T) {
+	d := newTestDriver(t, nil)
+	in := "{\"name\":\"nemo\",\"age\":1}\n\n{\"name\":\"dory\",\"age\":5}"
+
+	n, err := d.ImportJSONL("fish", strings.NewReader(in), "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("ImportJSONL imported %d records, want 2", n)
+	}
+
+	var got fish
+	if err := d.Read("fish", "dory", &got); err != nil || got.Age != 5 {
+		t.Errorf("imported record = %+v, %v", got, err)
+	}
+}
+
+func TestJSONLRoundTripUsers(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeUsers(t, d)
+
+	var buf bytes.Buffer
+	if err := d.ExportJSONL("users", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != len(demoUsers) {
+		t.Errorf("ExportJSONL wrote %d lines, want %d", lines, len(demoUsers))
+	}
+
+	n, err := d.ImportJSONL("imported", &buf, "Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(demoUsers) {
+		t.Errorf("ImportJSONL imported %d records, want %d", n, len(demoUsers))
+	}
+
+	for _, want := range demoUsers {
+		var got User
+		if err := d.Read("imported", want.Name, &got); err != nil || got != want {
+			t.Errorf("imported %s = %+v, %v, want %+v", want.Name, got, err, want)
+		}
+	}
+}
+
+func TestImportJSONLErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if _, err := d.ImportJSONL("fish", strings.NewReader("{}"), ""); err == nil {
+		t.Error("ImportJSONL without a key field succeeded")
+	}
+
+	n, err := d.ImportJSONL("fish", strings.NewReader("{\"name\":\"nemo\"}\n{\"age\":3}\n"), "name")
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ImportJSONL of a line without the key = %v, want an error naming line 2", err)
+	}
+	if n != 1 {
+		t.Errorf("ImportJSONL imported %d records before the error, want 1", n)
+	}
+
+	if _, err := d.ImportJSONL("fish", strings.NewReader("not json\n"), "name"); err == nil {
+		t.Error("ImportJSONL of invalid JSON succeeded")
+	}
+}
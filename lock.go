@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// LockCollection takes the collection's write lock and holds it until unlock
+// is called, so no other Write, Delete or ReadAll on the collection can run
+// in the meantime. The driver's own methods take the same lock and it isn't
+// reentrant: calling them for this collection while holding it deadlocks.
+// Use it to freeze a collection while working on its files directly, and
+// always lock several collections in the same order. Close waits for the
+// lock to be released.
+func (d *Driver) LockCollection(collection string) (unlock func()) {
+	collection = d.key(collection)
+
+	release, err := d.acquire(collection, false, time.Time{})
+	if err != nil {
+		// Closed: every other operation is rejected, so there is nothing
+		// left to exclude.
+		d.log.Warnf("Locking %s: %v", collection, err)
+		return func() {}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(release)
+	}
+}
+
+// LockResource takes the write lock of a single record and holds it until
+// unlock is called. Write, Delete and the other writers of the record,
+// including the read-modify-write helpers such as Increment and UpdateFunc,
+// wait for it, as do other LockResource callers, so no other writer
+// interleaves with code holding the lock; Read doesn't wait. Like
+// LockCollection the lock isn't reentrant: writing the record, or locking
+// it again, while holding it deadlocks. Close waits for the lock to be
+// released.
+func (d *Driver) LockResource(collection, resource string) (unlock func()) {
+	collection, resource = d.key(collection), d.key(resource)
+
+	done, err := d.begin()
+	if err != nil {
+		d.log.Warnf("Locking %s/%s: %v", collection, resource, err)
+		return func() {}
+	}
+
+	release, err := d.lockRecord(collection, resource, time.Time{})
+	if err != nil {
+		done()
+		d.log.Warnf("Locking %s/%s: %v", collection, resource, err)
+		return func() {}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			release()
+			done()
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockCollectionBlocksWriters(t *testing.T) {
+	d := newTestDriver(t, nil)
+	unlock := d.LockCollection("fish")
+
+	written := make(chan error, 1)
+	go func() { written <- d.Write("fish", "nemo", fish{Name: "nemo"}) }()
+
+	select {
+	case err := <-written:
+		t.Fatalf("Write finished while the collection was locked: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlock()
+	// Unlocking twice is harmless.
+	unlock()
+
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockCollectionOtherCollections(t *testing.T) {
+	d := newTestDriver(t, nil)
+	unlock := d.LockCollection("fish")
+	defer unlock()
+
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+}
+
+func TestLockResourceBlocksUpdates(t *testing.T) {
+	d := newTestDriver(t, nil)
+	unlock := d.LockResource("counters", "hits")
+
+	incremented := make(chan error, 1)
+	go func() {
+		_, err := d.Increment("counters", "hits", "total", 1)
+		incremented <- err
+	}()
+
+	select {
+	case err := <-incremented:
+		t.Fatalf("Increment finished while the record was locked: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Other records aren't locked.
+	mustWrite(t, d, "counters", "visits", map[string]int{"total": 10})
+	if _, err := d.Increment("counters", "misses", "total", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+	unlock()
+
+	if err := <-incremented; err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Total int `json:"total"`
+	}
+	if err := d.Read("counters", "hits", &got); err != nil || got.Total != 1 {
+		t.Errorf("total = %+v, %v, want 1", got, err)
+	}
+}
+
+func TestLockResourceBlocksWriters(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	unlock := d.LockResource("fish", "nemo")
+
+	written := make(chan error, 1)
+	go func() { written <- d.Write("fish", "nemo", fish{Name: "nemo", Age: 2}) }()
+
+	select {
+	case err := <-written:
+		t.Fatalf("Write finished while the record was locked: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Reads don't wait, and see the record as the holder left it.
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 1 {
+		t.Errorf("Read while locked = %+v, %v, want age 1", got, err)
+	}
+	if err := d.TryWrite("fish", "nemo", fish{Name: "nemo", Age: 3}, 10*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("TryWrite of the locked record = %v, want ErrLockTimeout", err)
+	}
+	if err := d.TryDelete("fish", "nemo", 10*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("TryDelete of the locked record = %v, want ErrLockTimeout", err)
+	}
+
+	unlock()
+
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read after unlocking = %+v, %v, want the blocked write", got, err)
+	}
+}
+
+func TestLockResourceReleasesEntries(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	d.LockResource("counters", "hits")()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if len(d.recordLocks) != 0 {
+		t.Errorf("record locks left after unlocking: %v", d.recordLocks)
+	}
+}
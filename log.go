@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// logSeqWidth is how many digits Append pads sequence numbers to, so
+// resource names sort in append order.
+const logSeqWidth = 20
+
+// Append stores v as the next record of an append-only log collection and
+// returns its name: a zero-padded sequence number one past the highest in
+// the collection, so resource order is append order.
+func (d *Driver) Append(collection string, v interface{}) (_ string, err error) {
+	defer wrapOp("Append", collection, "", &err)
+
+	b, err := d.marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	collection = d.key(collection)
+
+	// Validate the collection with a placeholder name; the real one is only
+	// known under the lock.
+	if err := d.checkRecord(collection, "0"); err != nil {
+		return "", err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquire(collection, false, deadline)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var last uint64
+	for _, resource := range resources {
+		if n, err := strconv.ParseUint(resource, 10, 64); err == nil && n > last {
+			last = n
+		}
+	}
+
+	resource := fmt.Sprintf("%0*d", logSeqWidth, last+1)
+	if err := d.writeLocked(collection, resource, bytes.NewReader(b), deadline); err != nil {
+		return "", err
+	}
+
+	return resource, nil
+}
+
+// CompactLog deletes every record of a log collection that a later record,
+// in resource order, supersedes: one for which keyFn returns the same key.
+// The survivors keep their names, so their order is preserved. Records for
+// which keyFn returns "" are always kept. The collection stays locked
+// throughout.
+func (d *Driver) CompactLog(collection string, keyFn func([]byte) string) (err error) {
+	defer wrapOp("CompactLog", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if err := d.checkPath(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return err
+	}
+	sort.Strings(resources)
+
+	latest := make(map[string]string)
+	keys := make(map[string]string, len(resources))
+	for _, resource := range resources {
+		b, err := d.readRecord(collection, resource)
+		if noContent(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		key := keyFn(b)
+		if key == "" {
+			continue
+		}
+		keys[resource] = key
+		latest[key] = resource
+	}
+
+	removed := 0
+	for _, resource := range resources {
+		key, ok := keys[resource]
+		if !ok || latest[key] == resource {
+			continue
+		}
+
+		if err := d.delete(collection, resource); err != nil {
+			return err
+		}
+		removed++
+	}
+
+	d.log.Debugf("Compacted %s, removed %d superseded records", collection, removed)
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+type logEntry struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+}
+
+// entryKey is a CompactLog key function keying entries on their Key field.
+func entryKey(b []byte) string {
+	var e logEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return ""
+	}
+	return e.Key
+}
+
+func TestAppend(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "log", "notes", logEntry{})
+
+	var names []string
+	for i := 1; i <= 3; i++ {
+		name, err := d.Append("log", logEntry{Key: "a", Value: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	// Names are zero-padded, so they sort in append order, and resources
+	// that aren't sequence numbers are ignored.
+	want := []string{"00000000000000000001", "00000000000000000002", "00000000000000000003"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Append names = %v, want %v", names, want)
+	}
+
+	// Numbering carries on from the highest record left.
+	if err := d.Delete("log", want[1]); err != nil {
+		t.Fatal(err)
+	}
+	name, err := d.Append("log", logEntry{Key: "a", Value: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "00000000000000000004" {
+		t.Errorf("Append after a delete = %s, want 00000000000000000004", name)
+	}
+}
+
+func TestAppendErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if _, err := d.Append("", logEntry{}); err == nil {
+		t.Error("Append with no collection succeeded")
+	}
+	if _, err := d.Append("log", make(chan int)); err == nil {
+		t.Error("Append of an unmarshalable value succeeded")
+	}
+}
+
+func TestCompactLog(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for i, key := range []string{"a", "b", "a", "", "b", "a", ""} {
+		if _, err := d.Append("log", logEntry{Key: key, Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.CompactLog("log", entryKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last entry of every key survives, and entries without a key are
+	// kept, all under their original names.
+	resources, err := d.ListResources("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"00000000000000000004", "00000000000000000005", "00000000000000000006", "00000000000000000007"}
+	if !slices.Equal(resources, want) {
+		t.Errorf("records after CompactLog = %v, want %v", resources, want)
+	}
+
+	var e logEntry
+	if err := d.Read("log", "00000000000000000006", &e); err != nil || e.Key != "a" || e.Value != 5 {
+		t.Errorf("latest a = %+v, %v, want value 5", e, err)
+	}
+}
+
+func TestCompactLogMissingCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.CompactLog("log", entryKey); err == nil {
+		t.Error("CompactLog of a missing collection succeeded")
+	}
+}
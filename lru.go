@@ -0,0 +1,103 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"sync"
+)
+
+// accessLog tracks, in memory, the order in which records were last read
+// or written, for MaxRecordsPerCollection eviction. Records not used since
+// the driver started count as the least recently used.
+type accessLog struct {
+	mutex sync.Mutex
+	tick  uint64
+	last  map[string]map[string]uint64
+}
+
+// touch marks a record as just used.
+func (a *accessLog) touch(collection, resource string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.last == nil {
+		a.last = make(map[string]map[string]uint64)
+	}
+	if a.last[collection] == nil {
+		a.last[collection] = make(map[string]uint64)
+	}
+
+	a.tick++
+	a.last[collection][resource] = a.tick
+}
+
+// forget drops a record, or a whole collection when resource is empty.
+func (a *accessLog) forget(collection, resource string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if resource == "" {
+		delete(a.last, collection)
+		return
+	}
+	delete(a.last[collection], resource)
+}
+
+// oldest returns the least recently used of resources, preferring the
+// first by name among those never used.
+func (a *accessLog) oldest(collection string, resources []string) string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	sort.Strings(resources)
+
+	victim := ""
+	for _, resource := range resources {
+		if victim == "" || a.last[collection][resource] < a.last[collection][victim] {
+			victim = resource
+		}
+	}
+
+	return victim
+}
+
+// touch records a read or write of a record when MaxRecordsPerCollection is
+// set.
+func (d *Driver) touch(collection, resource string) {
+	if d.maxRecords > 0 {
+		d.access.touch(collection, resource)
+	}
+}
+
+// evict deletes least recently used records of a collection until it holds
+// no more than MaxRecordsPerCollection, never evicting keep. The caller must
+// hold the collection mutex.
+func (d *Driver) evict(collection, keep string) error {
+	if d.maxRecords <= 0 {
+		return nil
+	}
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return err
+	}
+
+	candidates := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		if resource != keep {
+			candidates = append(candidates, resource)
+		}
+	}
+
+	for n := len(resources); n > d.maxRecords && len(candidates) > 0; n-- {
+		victim := d.access.oldest(collection, candidates)
+		if err := d.delete(collection, victim); err != nil {
+			return err
+		}
+
+		d.log.Debugf("Evicted %s/%s", collection, victim)
+		candidates = slices.DeleteFunc(candidates, func(resource string) bool { return resource == victim })
+	}
+
+	return nil
+}
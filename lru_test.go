@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMaxRecordsPerCollectionEvictsLeastRecentlyUsed(t *testing.T) {
+	d := newTestDriver(t, &Options{MaxRecordsPerCollection: 2})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	// Reading nemo makes dory the least recently used.
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "fish", "marlin", fish{Name: "marlin"})
+
+	names, err := d.ListResources("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	if want := []string{"marlin", "nemo"}; !slices.Equal(names, want) {
+		t.Errorf("records after eviction = %v, want %v", names, want)
+	}
+
+	// Rewriting a record doesn't count as a new one.
+	mustWrite(t, d, "fish", "marlin", fish{Name: "marlin", Age: 1})
+	if names, err := d.ListResources("fish"); err != nil || len(names) != 2 {
+		t.Errorf("records after a rewrite = %v, %v", names, err)
+	}
+}
+
+func TestMaxRecordsPerCollectionIsPerCollection(t *testing.T) {
+	d := newTestDriver(t, &Options{MaxRecordsPerCollection: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Errorf("a write to another collection evicted a record: %v", err)
+	}
+}
@@ -1,28 +1,434 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 const Version = "1.0.1"
 
+// metaFile holds database-level metadata. It lives at the root of d.dir,
+// next to the collections, so its name is reserved as a collection name.
+const metaFile = ".asuradb.meta"
+
+type Metadata struct {
+	Version   string            `json:"version"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrInvalidName   = errors.New("invalid name")
+	ErrCorruptRecord = errors.New("corrupt record")
+
+	// ErrRecordTooLarge is returned by writes of records over
+	// Options.MaxRecordBytes.
+	ErrRecordTooLarge = errors.New("record too large")
+
+	// ErrDatabaseMissing is returned by Write when the database directory
+	// has been removed and Options.MissingDatabase is FailOnMissingDatabase.
+	ErrDatabaseMissing = errors.New("database directory is missing")
+
+	// ErrEmptyRecord is returned when reading a record whose file is
+	// empty, unless Options.EmptyAsMissing is set.
+	ErrEmptyRecord = errors.New("record file is empty")
+
+	// ErrConflict is returned by UpdateFunc when the record kept changing
+	// under it for every retry.
+	ErrConflict = errors.New("record changed concurrently")
+
+	// ErrReservedName is returned for collection and resource names used
+	// by the driver's own storage, see reservedNames.
+	ErrReservedName = errors.New("name is reserved")
+)
+
 type (
 	Driver struct {
 		mutex   sync.Mutex
-		mutexes map[string]*sync.Mutex
+		mutexes map[string]*sync.RWMutex
 		dir     string
 		log     *logrus.Logger
+
+		tempDir          string
+		symlinks         SymlinkPolicy
+		indent           bool
+		trailingNewline  bool
+		softDelete       bool
+		keepHistory      int
+		opTimeout        time.Duration
+		dryRun           bool
+		missingDB        MissingDatabasePolicy
+		dataDirs         []string
+		ring             *hashRing
+		strictUnion      bool
+		marshalFunc      func(v interface{}) ([]byte, error)
+		unmarshalFunc    func(data []byte, v interface{}) error
+		validateOnRead   bool
+		idGenerator      func() string
+		maxRecords       int
+		trashRetention   time.Duration
+		compactLogs      map[string]func([]byte) string
+		temps            tempFiles
+		codecs           []Codec
+		partitionBy      map[string]func(v interface{}) string
+		conflictResolver func(existing, incoming []byte) ([]byte, error)
+		maxRecordBytes   int64
+		emptyOnMissing   bool
+		syncDirs         bool
+		syncDir          func(path string) error
+		hardLinks        bool
+		nameFunc         func(collection, resource string) string
+		partitions       partitionCache
+		names            nameCache
+		dirs             dirCache
+		cache            *recordCache
+		emptyAsMissing   bool
+		rawBytes         bool
+		strictDecode     bool
+		cacheModTime     bool
+		events           eventStream
+		access           accessLog
+		caseInsensitive  bool
+		singleFile       bool
+
+		indexMutex sync.RWMutex
+		indexes    map[string]map[string]*index
+
+		// closed, active and recordLocks are guarded by mutex.
+		closed      bool
+		active      sync.WaitGroup
+		recordLocks map[string]*recordLock
 	}
 )
 
+// MissingDatabasePolicy controls how Write reacts to the database directory
+// disappearing, e.g. after an operator removed it by hand.
+type MissingDatabasePolicy int
+
+const (
+	// RecreateDatabase recreates the directory, with fresh metadata, and
+	// logs a warning.
+	RecreateDatabase MissingDatabasePolicy = iota
+
+	// FailOnMissingDatabase makes Write return ErrDatabaseMissing.
+	FailOnMissingDatabase
+)
+
 type Options struct {
 	Logger *logrus.Logger
+
+	// LogJSON makes the default logger emit JSON lines instead of text.
+	// It can't be combined with a custom Logger.
+	LogJSON bool
+
+	// SoftDelete makes Delete move records into the trash instead of
+	// removing them. See Restore and PurgeTrash.
+	SoftDelete bool
+
+	// TempDir is where temp files are staged before being renamed into
+	// place. It must be on the same filesystem as the database. Empty
+	// stages them next to the final file.
+	TempDir string
+
+	// Symlinks decides whether symlinked collections and records are
+	// followed (when they stay inside the database) or rejected.
+	Symlinks SymlinkPolicy
+
+	// Indent stores records indented with tabs, re-indenting the bytes
+	// given to WriteJSON. Set it to false to store records without
+	// indentation; WriteJSON then keeps the given bytes exactly as they
+	// are. Nil means true.
+	Indent *bool
+
+	// TrailingNewline makes Write and WriteJSON end records with a
+	// newline. Set it to false for records without one. WriteRaw never
+	// adds one. Nil means true.
+	TrailingNewline *bool
+
+	// OperationTimeout bounds how long Read, Write, Delete, ReadAll and
+	// the other operations taking collection locks may take, including
+	// waiting for the locks. They fail with ErrTimeout instead of hanging
+	// behind a stuck lock holder. LockCollection and LockResource wait
+	// regardless. Zero means no limit.
+	OperationTimeout time.Duration
+
+	// DryRun makes Write, Delete and the other mutating methods log what
+	// they would do and return without touching the disk.
+	DryRun bool
+
+	// MissingDatabase decides what Write does when the database directory
+	// was removed while the driver is running.
+	MissingDatabase MissingDatabasePolicy
+
+	// Namespace stores the whole database, collections and metadata alike,
+	// under dir/<Namespace>, so several tenants can share one directory
+	// without seeing each other's data.
+	Namespace string
+
+	// DataDirs spreads records over more directories, e.g. on other
+	// disks. Each record is placed in dir or one of DataDirs by consistent
+	// hashing of its resource key; metadata and history stay in
+	// dir. After adding a directory, Rebalance moves the records that now
+	// belong to it; until then they are still found where they were.
+	DataDirs []string
+
+	// StrictUnion makes ReadAllUnion fail on a collection that doesn't
+	// exist instead of skipping it.
+	StrictUnion bool
+
+	// MarshalFunc and UnmarshalFunc replace the JSON encoding used by
+	// Write, Read and the typed helpers, e.g. to sort keys or strip nulls.
+	// MarshalFunc takes precedence over Indent. Nil keeps the defaults.
+	MarshalFunc   func(v interface{}) ([]byte, error)
+	UnmarshalFunc func(data []byte, v interface{}) error
+
+	// ValidateOnRead checks that records parse as JSON when they are read,
+	// so a record broken by hand fails with an ErrCorruptRecord naming it
+	// and the offset of the problem instead of a bare syntax error. It is
+	// ignored when UnmarshalFunc is set, as records needn't be JSON then.
+	ValidateOnRead bool
+
+	// IDGenerator names the records stored by WriteAuto. It is called from
+	// many goroutines at once and must be safe for concurrent use. Nil uses
+	// random UUIDs.
+	IDGenerator func() string
+
+	// MaxRecordsPerCollection caps the number of records in a collection.
+	// A write that goes over the cap deletes the least recently read or
+	// written record. Recency is only tracked in memory, so after a restart
+	// records not used since go first. Zero means no cap.
+	MaxRecordsPerCollection int
+
+	// Codecs are extra formats records may be stored in, e.g. while
+	// migrating a collection to JSON. See Codec.
+	Codecs []Codec
+
+	// PartitionBy stores the records of the given collections in
+	// sub-directories, collection/<partition>/<resource>.json, named by
+	// calling the function with the value passed to Write, e.g. a date
+	// derived from a timestamp field. An empty partition stores the
+	// record in the collection itself. Other writers, like WriteRaw, leave
+	// a record in its current partition. ReadAllPartition reads a single
+	// partition.
+	PartitionBy map[string]func(v interface{}) string
+
+	// ConflictResolver decides what Write and the other writers store when
+	// the record already exists, e.g. by merging the fields of both. It is
+	// called under the collection lock with the stored and the new bytes.
+	// Nil overwrites. Rollback and the read-modify-write helpers such as
+	// Increment and UpdateFunc, which already start from the stored
+	// record, don't use it.
+	ConflictResolver func(existing, incoming []byte) ([]byte, error)
+
+	// MaxRecordBytes caps the size of a stored record. Writes of anything
+	// larger fail with ErrRecordTooLarge and leave the record as it was.
+	// Zero means no cap.
+	MaxRecordBytes int64
+
+	// EmptyOnMissingCollection makes ReadAll return no records instead of
+	// an error for a collection that doesn't exist.
+	EmptyOnMissingCollection bool
+
+	// Sync makes New fsync the directories it creates, and their parent,
+	// so a newly created database survives a crash.
+	Sync bool
+
+	// UseHardLinks makes CopyCollection and Snapshot hard-link record files
+	// instead of copying them when source and destination share a
+	// filesystem. Writes replace records by renaming a new file into place,
+	// so a later write to either side never changes the other.
+	UseHardLinks bool
+
+	// NameFunc picks the file name, without extension, of a record written
+	// for the first time, e.g. to prefix it with a timestamp. The name
+	// is kept in the collection's .names file and reused by later writes,
+	// so Read, Delete and the listing methods keep working with resource
+	// names. Names must be unique within the collection and can't contain
+	// path separators or start with a dot. Records written before NameFunc
+	// was set keep their resource name.
+	NameFunc func(collection, resource string) string
+
+	// CacheSize keeps up to this many recently read records in memory, so
+	// repeated reads don't go to disk. Writes and deletes through the
+	// driver keep it up to date; files changed by other processes aren't
+	// noticed unless CacheCheckModTime is set. Zero disables the cache. See
+	// WarmCache.
+	CacheSize int
+
+	// CacheCheckModTime makes every cached read stat the record's file and
+	// read it again if its modification time changed, so edits made by
+	// other processes show up at the cost of a stat per read.
+	CacheCheckModTime bool
+
+	// EmptyAsMissing makes reads treat zero-byte record files, e.g. left by
+	// a crash or an external tool, as records that don't exist, instead of
+	// failing with ErrEmptyRecord.
+	EmptyAsMissing bool
+
+	// RawBytesPassthrough makes Write store []byte and json.RawMessage
+	// values as given, instead of marshaling them, which turns a []byte
+	// into a base64 JSON string. The bytes aren't checked or re-indented.
+	RawBytesPassthrough bool
+
+	// StrictDecode makes reads into structs, such as Read and the typed
+	// helpers, fail when a record has fields the struct lacks, so schema
+	// drift shows up early. It can't be combined with UnmarshalFunc.
+	StrictDecode bool
+
+	// EventBuffer is the capacity of the channel returned by Events. Zero
+	// means a default of 64 events.
+	EventBuffer int
+
+	// EventPolicy decides whether events are dropped or writes wait when
+	// the Events channel is full. The default drops them.
+	EventPolicy EventPolicy
+
+	// TrashRetention is how long soft-deleted records stay in the trash,
+	// counted from the delete, before StartMaintenance purges them. Zero
+	// leaves the trash alone until PurgeTrash is called.
+	TrashRetention time.Duration
+
+	// CompactLogs lists the log collections StartMaintenance compacts with
+	// CompactLog, each with the key function to compact it by.
+	CompactLogs map[string]func([]byte) string
+
+	// CaseInsensitiveKeys lowercases collection and resource names before
+	// use, so "Zoro" and "zoro" are the same record on every platform, not
+	// only on case-insensitive filesystems. Records written with upper-case
+	// names before turning it on are no longer found.
+	CaseInsensitiveKeys bool
+
+	// SingleFilePerCollection stores each collection as one JSON object
+	// file, <collection>.json, instead of one file per record. This saves
+	// inodes for small collections, but every Write and Delete rewrites the
+	// whole file. Records must be valid JSON. It can't be combined with
+	// DataDirs or SoftDelete.
+	SingleFilePerCollection bool
+
+	// KeepHistory is the number of previous versions of each record that
+	// Write keeps around for History and Rollback. Zero disables history.
+	KeepHistory int
+}
+
+// validate reports every invalid or conflicting setting in o, so that New
+// fails up front instead of misbehaving later.
+func (o *Options) validate() error {
+	var errs []error
+
+	if o.LogJSON && o.Logger != nil {
+		errs = append(errs, fmt.Errorf("LogJSON only applies to the default logger, not a custom Logger"))
+	}
+
+	if o.Symlinks != SymlinkFollowWithin && o.Symlinks != SymlinkReject {
+		errs = append(errs, fmt.Errorf("unknown Symlinks policy %d", o.Symlinks))
+	}
+
+	if o.MissingDatabase != RecreateDatabase && o.MissingDatabase != FailOnMissingDatabase {
+		errs = append(errs, fmt.Errorf("unknown MissingDatabase policy %d", o.MissingDatabase))
+	}
+
+	if o.OperationTimeout < 0 {
+		errs = append(errs, fmt.Errorf("OperationTimeout must not be negative, got %v", o.OperationTimeout))
+	}
+
+	if o.MaxRecordsPerCollection < 0 {
+		errs = append(errs, fmt.Errorf("MaxRecordsPerCollection must not be negative, got %d", o.MaxRecordsPerCollection))
+	}
+
+	if o.CacheSize < 0 {
+		errs = append(errs, fmt.Errorf("CacheSize must not be negative, got %d", o.CacheSize))
+	}
+
+	if o.TrashRetention < 0 {
+		errs = append(errs, fmt.Errorf("TrashRetention must not be negative, got %v", o.TrashRetention))
+	}
+
+	for collection, keyFn := range o.CompactLogs {
+		if keyFn == nil {
+			errs = append(errs, fmt.Errorf("CompactLogs has no key function for %s", collection))
+		}
+	}
+
+	if o.EventBuffer < 0 {
+		errs = append(errs, fmt.Errorf("EventBuffer must not be negative, got %d", o.EventBuffer))
+	}
+
+	if o.EventPolicy != DropEvents && o.EventPolicy != BlockOnEvents {
+		errs = append(errs, fmt.Errorf("unknown EventPolicy %d", o.EventPolicy))
+	}
+
+	if o.MaxRecordBytes < 0 {
+		errs = append(errs, fmt.Errorf("MaxRecordBytes must not be negative, got %d", o.MaxRecordBytes))
+	}
+
+	if o.KeepHistory < 0 {
+		errs = append(errs, fmt.Errorf("KeepHistory must not be negative, got %d", o.KeepHistory))
+	}
+
+	if o.Namespace != "" {
+		if ns := filepath.Clean(o.Namespace); ns != o.Namespace || filepath.Base(ns) != ns || ns == "." || ns == ".." || isReserved(ns) {
+			errs = append(errs, fmt.Errorf("namespace %q: %w", o.Namespace, ErrInvalidName))
+		}
+	}
+
+	for _, dataDir := range o.DataDirs {
+		if dataDir == "" {
+			errs = append(errs, fmt.Errorf("DataDirs must not contain an empty path"))
+		}
+	}
+
+	if o.SingleFilePerCollection && len(o.DataDirs) > 0 {
+		errs = append(errs, fmt.Errorf("SingleFilePerCollection can't be combined with DataDirs"))
+	}
+
+	for _, codec := range o.Codecs {
+		if codec == nil || !strings.HasPrefix(codec.Ext(), ".") || codec.Ext() == ".json" || codec.Ext() == blobExt {
+			errs = append(errs, fmt.Errorf("Codecs must not be nil and need an extension starting with a dot, other than .json and %s", blobExt))
+			break
+		}
+	}
+
+	if o.SingleFilePerCollection && len(o.PartitionBy) > 0 {
+		errs = append(errs, fmt.Errorf("SingleFilePerCollection can't be combined with PartitionBy"))
+	}
+
+	if o.SingleFilePerCollection && o.SoftDelete {
+		errs = append(errs, fmt.Errorf("SingleFilePerCollection can't be combined with SoftDelete"))
+	}
+
+	if o.NameFunc != nil && (o.SingleFilePerCollection || o.SoftDelete || len(o.DataDirs) > 0 || len(o.PartitionBy) > 0 || len(o.Codecs) > 0) {
+		errs = append(errs, fmt.Errorf("NameFunc can't be combined with SingleFilePerCollection, SoftDelete, DataDirs, PartitionBy or Codecs"))
+	}
+
+	if o.StrictDecode && o.UnmarshalFunc != nil {
+		errs = append(errs, fmt.Errorf("StrictDecode can't be combined with UnmarshalFunc"))
+	}
+
+	if o.TempDir != "" {
+		if fi, err := os.Stat(o.TempDir); err != nil || !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("TempDir %s is not a directory", o.TempDir))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
 }
 
 func NewConsoleLogger() *logrus.Logger {
@@ -35,6 +441,14 @@ func NewConsoleLogger() *logrus.Logger {
 	return logger
 }
 
+// NewJSONLogger is like NewConsoleLogger but formats entries as JSON, for
+// log aggregation.
+func NewJSONLogger() *logrus.Logger {
+	logger := NewConsoleLogger()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	return logger
+}
+
 func New(dir string, options *Options) (*Driver, error) {
 	dir = filepath.Clean(dir)
 	opts := Options{}
@@ -42,174 +456,1766 @@ func New(dir string, options *Options) (*Driver, error) {
 		opts = *options
 	}
 
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.Logger == nil && opts.LogJSON {
+		opts.Logger = NewJSONLogger()
+	}
+
 	if opts.Logger == nil {
 		opts.Logger = NewConsoleLogger()
 	}
 
+	if opts.Namespace != "" {
+		dir = filepath.Join(dir, opts.Namespace)
+	}
+
+	var dataDirs []string
+	if len(opts.DataDirs) > 0 {
+		dataDirs = append(dataDirs, dir)
+		for _, dataDir := range opts.DataDirs {
+			dataDir = filepath.Join(filepath.Clean(dataDir), opts.Namespace)
+			if !slices.Contains(dataDirs, dataDir) {
+				dataDirs = append(dataDirs, dataDir)
+			}
+		}
+	}
+
 	driver := &Driver{
 		dir:     dir,
-		mutexes: make(map[string]*sync.Mutex),
+		mutexes: make(map[string]*sync.RWMutex),
 		log:     opts.Logger,
+
+		tempDir:          opts.TempDir,
+		symlinks:         opts.Symlinks,
+		indent:           opts.Indent == nil || *opts.Indent,
+		trailingNewline:  opts.TrailingNewline == nil || *opts.TrailingNewline,
+		softDelete:       opts.SoftDelete,
+		keepHistory:      opts.KeepHistory,
+		opTimeout:        opts.OperationTimeout,
+		dryRun:           opts.DryRun,
+		missingDB:        opts.MissingDatabase,
+		strictUnion:      opts.StrictUnion,
+		marshalFunc:      opts.MarshalFunc,
+		unmarshalFunc:    opts.UnmarshalFunc,
+		validateOnRead:   opts.ValidateOnRead,
+		idGenerator:      opts.IDGenerator,
+		maxRecords:       opts.MaxRecordsPerCollection,
+		codecs:           opts.Codecs,
+		conflictResolver: opts.ConflictResolver,
+		maxRecordBytes:   opts.MaxRecordBytes,
+		emptyOnMissing:   opts.EmptyOnMissingCollection,
+		caseInsensitive:  opts.CaseInsensitiveKeys,
+		singleFile:       opts.SingleFilePerCollection,
+		trashRetention:   opts.TrashRetention,
+		syncDirs:         opts.Sync,
+		hardLinks:        opts.UseHardLinks,
+		nameFunc:         opts.NameFunc,
+		emptyAsMissing:   opts.EmptyAsMissing,
+		rawBytes:         opts.RawBytesPassthrough,
+		strictDecode:     opts.StrictDecode,
+		cacheModTime:     opts.CacheCheckModTime,
+		syncDir:          syncPath,
+	}
+
+	if len(dataDirs) > 1 {
+		driver.dataDirs = dataDirs
+		driver.ring = newHashRing(dataDirs)
+	}
+
+	if opts.CacheSize > 0 {
+		driver.cache = newRecordCache(opts.CacheSize)
+	}
+
+	driver.events.size = opts.EventBuffer
+	if driver.events.size == 0 {
+		driver.events.size = defaultEventBuffer
+	}
+	driver.events.block = opts.EventPolicy == BlockOnEvents
+
+	if len(opts.PartitionBy) > 0 {
+		driver.partitionBy = make(map[string]func(v interface{}) string, len(opts.PartitionBy))
+		for collection, fn := range opts.PartitionBy {
+			driver.partitionBy[driver.key(collection)] = fn
+		}
 	}
 
+	if len(opts.CompactLogs) > 0 {
+		driver.compactLogs = make(map[string]func([]byte) string, len(opts.CompactLogs))
+		for collection, keyFn := range opts.CompactLogs {
+			driver.compactLogs[driver.key(collection)] = keyFn
+		}
+	}
+
+	created := false
 	if _, err := os.Stat(dir); err == nil {
 		opts.Logger.Debugf("Using %s (database already exists)\n", dir)
-		return driver, nil
+	} else {
+		opts.Logger.Debugf("Creating the database at %s ...\n", dir)
+		if err := driver.mkdirAll(dir); err != nil {
+			return driver, err
+		}
+		created = true
+	}
+
+	for _, dataDir := range driver.dataDirs {
+		if err := driver.mkdirAll(dataDir); err != nil {
+			return driver, err
+		}
+	}
+
+	if driver.tempDir != "" {
+		if err := driver.checkTempDir(); err != nil {
+			return driver, err
+		}
+	}
+
+	if created {
+		if err := driver.writeMeta(Metadata{Version: Version, CreatedAt: time.Now().UTC()}); err != nil {
+			return driver, err
+		}
+		if driver.syncDirs {
+			return driver, driver.syncDir(dir)
+		}
 	}
 
-	opts.Logger.Debugf("Creating the database at %s ...\n", dir)
-	return driver, os.MkdirAll(dir, 0755)
+	return driver, nil
 }
 
-func (d *Driver) Read(collection string, resource string, v string) error {
+// SetLogLevel changes how verbose the driver's logging is, e.g. to turn on
+// debug output while troubleshooting. It is safe to call while the driver
+// is in use. A Logger passed in Options is shared, so it changes for its
+// other users too.
+func (d *Driver) SetLogLevel(level logrus.Level) {
+	d.log.SetLevel(level)
+}
 
-	if collection == "" {
-		return fmt.Errorf("Missing collection - no place to save record!")
+// DBVersion returns the version recorded when the database was created and
+// warns if it differs from the running Version. A database from before
+// versions were recorded is upgraded: the running Version is recorded for
+// it and returned.
+func (d *Driver) DBVersion() (_ string, err error) {
+	defer wrapOp("DBVersion", "", "", &err)
+
+	unlock, err := d.acquire(metaFile, false, d.deadline())
+	if err != nil {
+		return "", err
 	}
+	defer unlock()
 
-	if resource == "" {
-		return fmt.Errorf("Missing resource - unable to save record (no name)!")
+	m, err := d.readMeta()
+	if err != nil {
+		return "", err
 	}
 
-	record := filepath.Join(d.dir, collection, resource)
+	if m.Version == "" {
+		m.Version = Version
+		if d.dryRun {
+			d.dryRunf("record version %s for %s", Version, d.dir)
+			return m.Version, nil
+		}
 
-	if _, err := stat(record); err != nil {
-		return err
+		if err := d.writeMeta(m); err != nil {
+			return "", err
+		}
+		d.log.Infof("Database at %s had no recorded version, recorded %s", d.dir, Version)
+		return m.Version, nil
+	}
+
+	if m.Version != Version {
+		d.log.Warnf("Database at %s was created by version %s, running %s", d.dir, m.Version, Version)
 	}
 
-	b, err := os.ReadFile(record + ".json")
+	return m.Version, nil
+}
+
+// Meta returns the database-level metadata written by New. A database
+// created before metadata was kept has an empty Version and CreatedAt.
+func (d *Driver) Meta() (_ Metadata, err error) {
+	defer wrapOp("Meta", "", "", &err)
+
+	unlock, err := d.acquire(metaFile, false, d.deadline())
 	if err != nil {
-		return err
+		return Metadata{}, err
 	}
+	defer unlock()
 
-	return json.Unmarshal(b, &v)
+	return d.readMeta()
 }
 
-func (d *Driver) Delete(collection, resource string) error {
+// SetMeta stores a custom tag in the database metadata, creating the
+// metadata file if the database doesn't have one yet.
+func (d *Driver) SetMeta(key, value string) (err error) {
+	defer wrapOp("SetMeta", "", "", &err)
 
-	path := filepath.Join(collection, resource)
-	mutex := d.getOrCreateMutex(collection)
-	mutex.Lock()
-	defer mutex.Unlock()
+	if key == "" {
+		return fmt.Errorf("Missing key - unable to set metadata!")
+	}
 
-	dir := filepath.Join(d.dir, path)
+	unlock, err := d.acquire(metaFile, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	switch fi, err := stat(dir); {
-	case fi == nil, err != nil:
-		return fmt.Errorf("unable to find file or directory named %v\n", path)
+	m, err := d.readMeta()
+	if err != nil {
+		return err
+	}
 
-	case fi.Mode().IsDir():
-		return os.RemoveAll(dir)
+	if m.Tags == nil {
+		m.Tags = make(map[string]string)
+	}
+	m.Tags[key] = value
 
-	case fi.Mode().IsRegular():
-		return os.RemoveAll(dir + ".json")
+	if d.dryRun {
+		d.dryRunf("set metadata %s=%s", key, value)
+		return nil
 	}
-	return nil
-}
 
-func (d *Driver) getOrCreateMutex(collection string) *sync.Mutex {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-	m, ok := d.mutexes[collection]
+	return d.writeMeta(m)
+}
 
-	if !ok {
-		m = &sync.Mutex{}
-		d.mutexes[collection] = m
+// key normalizes a collection or resource name according to
+// CaseInsensitiveKeys. Exported methods apply it to their arguments before
+// building paths, locks or index entries from them.
+func (d *Driver) key(name string) string {
+	if d.caseInsensitive {
+		return strings.ToLower(name)
 	}
 
-	return m
+	return name
 }
 
-func stat(path string) (fi os.FileInfo, err error) {
-	if fi, err = os.Stat(path); os.IsNotExist(err) {
-		fi, err = os.Stat(path + ".json")
+// dryRunf logs a change that was skipped because of Options.DryRun.
+func (d *Driver) dryRunf(format string, args ...interface{}) {
+	d.log.Infof("Dry run: would "+format, args...)
+}
+
+// reservedNames are the files and directories the driver keeps next to the
+// collections at the root of d.dir. Features storing data there must add
+// their name here.
+var reservedNames = []string{metaFile, trashDir, historyDir, archiveDir}
+
+// isReserved reports whether name, or the top-level collection it is nested
+// in, is used for the driver's own storage and so can't be used as a
+// collection or resource name.
+func isReserved(name string) bool {
+	top, _, _ := strings.Cut(filepath.ToSlash(filepath.Clean(name)), "/")
+	return slices.Contains(reservedNames, top)
+}
+
+// readMeta returns the database-level metadata. Databases created before
+// the metadata file existed have none, which reads as empty metadata.
+func (d *Driver) readMeta() (Metadata, error) {
+	var m Metadata
+
+	b, err := os.ReadFile(filepath.Join(d.dir, metaFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
 	}
 
-	return fi, err
+	return m, json.Unmarshal(b, &m)
 }
 
-type Address struct {
-	City    string
-	State   string
-	Country string
-	Pincode string
+func (d *Driver) writeMeta(m Metadata) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return d.writeFileAtomic(filepath.Join(d.dir, metaFile), append(b, byte('\n')))
 }
 
-type User struct {
-	Name    string
-	Age     json.Number
-	Contact string
-	Company string
-	Address Address
+// Read decodes a record into v, which must be a pointer to a value of any
+// type UnmarshalFunc, or encoding/json by default, can decode into.
+func (d *Driver) Read(collection string, resource string, v interface{}) error {
+	return opError("Read", collection, resource, d.read(collection, resource, v))
 }
 
-func (d *Driver) Write(collection, resource string, v interface{}) error {
+func (d *Driver) read(collection string, resource string, v interface{}) error {
+	collection, resource = d.key(collection), d.key(resource)
+
 	if collection == "" {
 		return fmt.Errorf("Missing collection - no place to save record!")
 	}
 
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
 	if resource == "" {
 		return fmt.Errorf("Missing resource - unable to save record (no name)!")
 	}
 
-	mutex := d.getOrCreateMutex(collection)
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	dir := filepath.Join(d.dir, collection)
-	fnlPath := filepath.Join(dir, resource+".json")
-	tmpPath := fnlPath + ".tmp"
-
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
 		return err
 	}
 
-	b, err := json.MarshalIndent(v, "", "\t")
+	unlock, err := d.acquire(collection, true, d.deadline())
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	b = append(b, byte('\n'))
-
-	if err := os.WriteFile(tmpPath, b, 0644); err != nil {
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
 		return err
 	}
-	if err := os.Rename(tmpPath, fnlPath); err != nil {
+
+	if err := d.checkJSON(collection, resource, b); err != nil {
 		return err
 	}
 
-	d.log.Debugf("Successfully wrote %s/%s", collection, resource)
-	return nil
+	d.touch(collection, resource)
+	return d.unmarshal(b, v)
 }
 
-func (d *Driver) ReadAll(collection string) ([]string, error) {
-	if collection == "" {
-		return nil, fmt.Errorf("Missing collection - unable to read")
+// ReadMap decodes a record into a generic map, for records without a
+// matching struct. Numbers are decoded as json.Number, so integers keep
+// their exact value.
+func (d *Driver) ReadMap(collection, resource string) (_ map[string]interface{}, err error) {
+	defer wrapOp("ReadMap", collection, resource, &err)
+
+	b, err := d.ReadBytes(collection, resource, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if d.unmarshalFunc != nil {
+		return m, d.unmarshal(b, &m)
 	}
-	dir := filepath.Join(d.dir, collection)
 
-	if _, err := stat(dir); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
 		return nil, err
 	}
 
-	files, err := os.ReadDir(dir)
+	return m, nil
+}
+
+func (d *Driver) Delete(collection, resource string) error {
+	return opError("Delete", collection, resource, d.deleteBefore(collection, resource, d.deadline()))
+}
+
+func (d *Driver) deleteBefore(collection, resource string, deadline time.Time) error {
+	collection, resource = d.key(collection), d.key(resource)
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	path := filepath.Join(collection, resource)
+	if err := d.checkPath(path); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquireRecord(collection, resource, deadline)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer unlock()
 
-	var records []string
+	return d.delete(collection, resource)
+}
 
-	for _, file := range files {
-		b, err := os.ReadFile(filepath.Join(dir, file.Name()))
-		if err != nil {
-			return nil, err
+// delete removes a record, or a whole collection when resource is empty,
+// or moves it to the trash. The caller must hold the collection mutex.
+func (d *Driver) delete(collection, resource string) (err error) {
+	defer func() {
+		if err == nil && !d.dryRun {
+			d.emit(ChangeDelete, collection, resource)
 		}
+	}()
+	defer d.uncache(collection, resource)
 
-		records = append(records, string(b))
+	if d.singleFile {
+		return d.deletePacked(collection, resource)
 	}
 
-	d.log.Debugf("Successfully read all records from %s", collection)
-	return records, nil
+	path := filepath.Join(collection, resource)
+	if resource != "" {
+		path = filepath.Join(d.recordDir(collection, resource), d.storedName(collection, resource))
+	}
+
+	// Delete removes a sub-collection named resource when there is no
+	// such record, but won't guess when there are both.
+	if resource != "" {
+		for _, root := range d.roots() {
+			if fi, err := os.Stat(filepath.Join(root, path)); err == nil && fi.IsDir() && isFile(filepath.Join(root, path)+".json") {
+				return fmt.Errorf("%s is both a record and a sub-collection, remove one by hand: %w", path, ErrInvalidName)
+			}
+		}
+	}
+
+	found := false
+	for _, root := range d.roots() {
+		ok, err := d.deleteIn(root, path)
+		if err != nil {
+			return err
+		}
+		found = found || ok
+	}
+
+	if resource != "" && len(d.codecs) > 0 {
+		ok, err := d.deleteEncoded(collection, resource)
+		if err != nil {
+			return err
+		}
+		found = found || ok
+	}
+
+	if !found {
+		return fmt.Errorf("unable to find file or directory named %v: %w", path, ErrNotFound)
+	}
+
+	if resource != "" && !d.dryRun {
+		if err := d.forgetName(collection, resource); err != nil {
+			return err
+		}
+	}
+
+	if !d.dryRun {
+		d.unindex(collection, resource)
+		d.access.forget(collection, resource)
+		d.partitions.forget(collection, resource)
+		// A collection, or a sub-collection named resource, is gone.
+		d.names.forget(filepath.Join(collection, resource))
+		d.forgetDirs(filepath.Join(collection, resource))
+	}
+	return nil
+}
+
+// deleteIn deletes path from a single data directory, reporting whether
+// there was anything to delete.
+func (d *Driver) deleteIn(root, path string) (bool, error) {
+	dir := filepath.Join(root, path)
+
+	switch fi, err := stat(dir); {
+	case fi == nil, err != nil:
+		return false, nil
+
+	case d.dryRun:
+		d.dryRunf("delete %s", path)
+		return true, nil
+
+	case fi.Mode().IsDir():
+		if d.softDelete {
+			return true, d.moveToTrash(root, path)
+		}
+		return true, os.RemoveAll(dir)
+
+	case fi.Mode().IsRegular():
+		blobs, err := sidecarFiles(filepath.Dir(dir), filepath.Base(path))
+		if err != nil {
+			return true, err
+		}
+
+		for _, name := range append(blobs, filepath.Base(path)+".json") {
+			file := filepath.Join(filepath.Dir(path), name)
+			if d.softDelete {
+				err = d.moveToTrash(root, file)
+			} else {
+				err = os.Remove(filepath.Join(root, file))
+			}
+			if err != nil {
+				return true, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// RenameCollection renames a collection, along with its history and
+// trash, by renaming its directory.
+func (d *Driver) RenameCollection(oldName, newName string) (err error) {
+	defer wrapOp("RenameCollection", oldName, "", &err)
+
+	oldName, newName = d.key(oldName), d.key(newName)
+
+	if oldName == "" || newName == "" {
+		return fmt.Errorf("Missing collection - unable to rename!")
+	}
+
+	for _, name := range []string{oldName, newName} {
+		if isReserved(name) {
+			return fmt.Errorf("collection %s: %w", name, ErrReservedName)
+		}
+		if err := d.checkPath(name); err != nil {
+			return err
+		}
+	}
+
+	if oldName == newName {
+		return nil
+	}
+
+	// Lock both collections in a fixed order so two opposite renames can't
+	// deadlock. Both mutex entries are kept: goroutines may already be
+	// waiting on either of them.
+	first, second := oldName, newName
+	if second < first {
+		first, second = second, first
+	}
+	deadline := d.deadline()
+	for _, name := range []string{first, second} {
+		unlock, err := d.acquire(name, false, deadline)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	var roots []string
+	for _, root := range d.roots() {
+		if _, err := os.Stat(filepath.Join(root, newName)); err == nil {
+			return fmt.Errorf("collection %s: %w", newName, ErrAlreadyExists)
+		}
+		if fi, err := os.Stat(filepath.Join(root, oldName)); err == nil && fi.IsDir() {
+			roots = append(roots, root)
+		}
+	}
+
+	packed := false
+	if d.singleFile {
+		if _, err := os.Stat(d.packedFile(newName)); err == nil {
+			return fmt.Errorf("collection %s: %w", newName, ErrAlreadyExists)
+		}
+		_, err := os.Stat(d.packedFile(oldName))
+		packed = err == nil
+	}
+
+	if len(roots) == 0 && !packed {
+		return fmt.Errorf("collection %s: %w", oldName, ErrNotFound)
+	}
+
+	if d.dryRun {
+		d.dryRunf("rename collection %s to %s", oldName, newName)
+		return nil
+	}
+
+	for _, root := range roots {
+		dst := filepath.Join(root, newName)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+
+		if err := os.Rename(filepath.Join(root, oldName), dst); err != nil {
+			return err
+		}
+	}
+
+	if packed {
+		dst := d.packedFile(newName)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+
+		if err := os.Rename(d.packedFile(oldName), dst); err != nil {
+			return err
+		}
+	}
+
+	for _, root := range d.roots() {
+		for _, area := range []string{historyDir, trashDir} {
+			src := filepath.Join(root, area, oldName)
+			if _, err := os.Stat(src); err != nil {
+				continue
+			}
+			if err := moveInto(src, filepath.Join(root, area, newName)); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.indexMutex.Lock()
+	if indexes, ok := d.indexes[oldName]; ok {
+		d.indexes[newName] = indexes
+		delete(d.indexes, oldName)
+	}
+	d.indexMutex.Unlock()
+
+	d.access.forget(oldName, "")
+	d.names.forget(oldName)
+	d.names.forget(newName)
+	d.forgetDirs(oldName)
+	d.uncache(oldName, "")
+
+	d.log.Debugf("Renamed collection %s to %s", oldName, newName)
+	return nil
+}
+
+func (d *Driver) getOrCreateMutex(collection string) *sync.RWMutex {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	m, ok := d.mutexes[collection]
+
+	if !ok {
+		m = &sync.RWMutex{}
+		d.mutexes[collection] = m
+	}
+
+	return m
+}
+
+// writeFileAtomic writes b to a temp file and renames it over path, so
+// readers never observe a partially written file.
+func (d *Driver) writeFileAtomic(path string, b []byte) error {
+	return d.copyFileAtomic(path, bytes.NewReader(b))
+}
+
+// copyFileAtomic is the streaming counterpart of writeFileAtomic.
+func (d *Driver) copyFileAtomic(path string, r io.Reader) error {
+	f, err := d.createTemp(path)
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	defer d.temps.done(tmpPath)
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// createTemp opens the temp file that will be renamed over path. Without a
+// TempDir it sits next to path; the collection mutex keeps the name unique.
+// Temp files in TempDir are tracked in d.temps until the write is over, so
+// maintenance knows which ones are still in use.
+func (d *Driver) createTemp(path string) (*os.File, error) {
+	if d.tempDir == "" {
+		return os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	}
+
+	f, err := os.CreateTemp(d.tempDir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	d.temps.add(f.Name())
+
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		d.temps.done(f.Name())
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// checkTempDir verifies that files staged in d.tempDir can be renamed into
+// every data directory, which fails when they are on different filesystems.
+func (d *Driver) checkTempDir() error {
+	for _, root := range d.roots() {
+		f, err := os.CreateTemp(d.tempDir, ".asuradb-probe-*")
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		probe := filepath.Join(root, filepath.Base(f.Name()))
+		if err := os.Rename(f.Name(), probe); err != nil {
+			os.Remove(f.Name())
+			return fmt.Errorf("temp dir %s must be on the same filesystem as %s: %w", d.tempDir, root, err)
+		}
+
+		if err := os.Remove(probe); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordName returns the resource name of a directory entry holding a
+// record, or false for temp files, sub-directories, metadata sidecars and
+// other files.
+func recordName(entry os.DirEntry) (string, bool) {
+	if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || internalFile(entry.Name()) {
+		return "", false
+	}
+
+	return strings.TrimSuffix(entry.Name(), ".json"), true
+}
+
+// internalFile reports whether name, a file in a collection directory, is
+// one the driver keeps next to the records rather than a record: the temp
+// file of a write, a blob, a metadata sidecar or the NameFunc names file.
+func internalFile(name string) bool {
+	return strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, blobExt) || strings.HasSuffix(name, metaExt) || name == namesFile
+}
+
+// isFile reports whether path exists and isn't a directory.
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+func stat(path string) (fi os.FileInfo, err error) {
+	if fi, err = os.Stat(path); os.IsNotExist(err) {
+		fi, err = os.Stat(path + ".json")
+	}
+
+	return fi, err
+}
+
+type Address struct {
+	City    string
+	State   string
+	Country string
+	Pincode string
+}
+
+type User struct {
+	Name    string
+	Age     json.Number
+	Contact string
+	Company string
+	Address Address
+}
+
+func (d *Driver) Write(collection, resource string, v interface{}) error {
+	b, err := d.marshal(v)
+	if err != nil {
+		return opError("Write", collection, resource, err)
+	}
+
+	if d.partitioned(d.key(collection)) {
+		return opError("Write", collection, resource, d.writePartitioned(collection, resource, v, b))
+	}
+
+	return opError("Write", collection, resource, d.writeRecord(collection, resource, bytes.NewReader(b), d.deadline()))
+}
+
+// WriteAll writes every record of records to a collection, carrying on past
+// failures, and returns the error of each resource that couldn't be written.
+// The top-level error is only set when no write can succeed, e.g. for a
+// missing or reserved collection or a closed driver.
+func (d *Driver) WriteAll(collection string, records map[string]interface{}) (_ map[string]error, err error) {
+	defer wrapOp("WriteAll", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - no place to save record!")
+	}
+
+	if isReserved(collection) {
+		return nil, fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if err := d.checkPath(collection); err != nil {
+		return nil, err
+	}
+
+	resources := make([]string, 0, len(records))
+	for resource := range records {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	failed := make(map[string]error)
+	for _, resource := range resources {
+		err := d.Write(collection, resource, records[resource])
+		if errors.Is(err, ErrClosed) || errors.Is(err, ErrDatabaseMissing) {
+			return failed, err
+		}
+		if err != nil {
+			failed[resource] = err
+		}
+	}
+
+	d.log.Debugf("Wrote %d of %d records to %s", len(records)-len(failed), len(records), collection)
+	return failed, nil
+}
+
+// WriteIfChanged is like Write but leaves the record alone, reporting
+// false, when it already holds exactly the bytes v marshals to. Skipping
+// the write keeps the file's modification time, so watchers and backups
+// don't see a change.
+func (d *Driver) WriteIfChanged(collection, resource string, v interface{}) (changed bool, err error) {
+	defer wrapOp("WriteIfChanged", collection, resource, &err)
+
+	b, err := d.marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return false, err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquire(collection, false, deadline)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	resolved, err := d.resolve(collection, resource, bytes.NewReader(b))
+	if err != nil {
+		return false, err
+	}
+	if b, err = io.ReadAll(resolved); err != nil {
+		return false, err
+	}
+
+	if old, err := d.readRecord(collection, resource); err == nil && bytes.Equal(old, b) {
+		d.log.Debugf("Skipped unchanged %s/%s", collection, resource)
+		return false, nil
+	}
+
+	if err := d.writeLocked(collection, resource, bytes.NewReader(b), deadline); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// marshal encodes v the way records are stored on disk.
+func (d *Driver) marshal(v interface{}) ([]byte, error) {
+	return marshalRecord(d, v, json.Marshal)
+}
+
+// marshalRecord is marshal with encode producing the compact JSON of v, so
+// TypedDriver's cached encoders store records the same way Write does.
+func marshalRecord[T any](d *Driver, v T, encode func(T) ([]byte, error)) ([]byte, error) {
+	if d.rawBytes {
+		switch raw := any(v).(type) {
+		case []byte:
+			return raw, nil
+		case json.RawMessage:
+			return raw, nil
+		}
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	if d.marshalFunc != nil {
+		b, err = d.callMarshal(v)
+	} else {
+		b, err = encode(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if d.indent && d.marshalFunc == nil {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, b, "", "\t"); err != nil {
+			return nil, err
+		}
+		b = buf.Bytes()
+	}
+
+	if d.trailingNewline {
+		b = append(b, byte('\n'))
+	}
+
+	return b, nil
+}
+
+func (d *Driver) callMarshal(v interface{}) (b []byte, err error) {
+	defer recoverHook("MarshalFunc", &err)
+	return d.marshalFunc(v)
+}
+
+// unmarshal decodes a stored record into v.
+func (d *Driver) unmarshal(b []byte, v interface{}) (err error) {
+	if d.unmarshalFunc != nil {
+		defer recoverHook("UnmarshalFunc", &err)
+		return d.unmarshalFunc(b, v)
+	}
+
+	if !d.strictDecode || !json.Valid(b) {
+		return json.Unmarshal(b, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("decoding record into %T: %w", v, err)
+	}
+	return nil
+}
+
+// checkJSON returns an ErrCorruptRecord if ValidateOnRead is set and b
+// isn't valid JSON.
+func (d *Driver) checkJSON(collection, resource string, b []byte) error {
+	if !d.validateOnRead || d.unmarshalFunc != nil || json.Valid(b) {
+		return nil
+	}
+
+	var raw json.RawMessage
+	var syntaxErr *json.SyntaxError
+	if err := json.Unmarshal(b, &raw); errors.As(err, &syntaxErr) {
+		return fmt.Errorf("%s/%s at offset %d: %v: %w", collection, resource, syntaxErr.Offset, syntaxErr, ErrCorruptRecord)
+	}
+
+	return fmt.Errorf("%s/%s: %w", collection, resource, ErrCorruptRecord)
+}
+
+// WriteJSON stores already-marshaled JSON. The bytes are validated and then
+// re-indented like Write, or written as given when Indent is false.
+func (d *Driver) WriteJSON(collection, resource string, raw json.RawMessage) error {
+	return opError("WriteJSON", collection, resource, d.writeJSON(collection, resource, raw))
+}
+
+func (d *Driver) writeJSON(collection, resource string, raw json.RawMessage) error {
+	if !json.Valid(raw) {
+		return fmt.Errorf("invalid JSON for %s/%s", collection, resource)
+	}
+
+	if !d.indent {
+		return d.writeRecord(collection, resource, bytes.NewReader(raw), d.deadline())
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "\t"); err != nil {
+		return err
+	}
+	if d.trailingNewline {
+		buf.WriteByte('\n')
+	}
+
+	return d.writeRecord(collection, resource, &buf, d.deadline())
+}
+
+// writeRecord atomically replaces a record with the content of r, keeping
+// the previous version in history when enabled. It gives up once deadline
+// passes, unless deadline is zero.
+func (d *Driver) writeRecord(collection, resource string, r io.Reader, deadline time.Time) error {
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquireRecord(collection, resource, deadline)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err = d.resolve(collection, resource, r)
+	if err != nil {
+		return err
+	}
+
+	return d.writeLocked(collection, resource, r, deadline)
+}
+
+// resolve returns what to store when r is written over an existing record:
+// r itself, or the ConflictResolver's merge of the two. The caller must
+// hold the collection mutex.
+func (d *Driver) resolve(collection, resource string, r io.Reader) (io.Reader, error) {
+	if d.conflictResolver == nil {
+		return r, nil
+	}
+
+	existing, err := d.readRecord(collection, resource)
+	if noContent(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	incoming, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := d.callResolver(existing, incoming)
+	if err != nil {
+		return nil, fmt.Errorf("resolving write to %s/%s: %w", collection, resource, err)
+	}
+
+	return bytes.NewReader(merged), nil
+}
+
+func (d *Driver) callResolver(existing, incoming []byte) (merged []byte, err error) {
+	defer recoverHook("ConflictResolver", &err)
+	return d.conflictResolver(existing, incoming)
+}
+
+// writeLocked is writeRecord for callers that already validated the names
+// and hold the collection mutex.
+func (d *Driver) writeLocked(collection, resource string, r io.Reader, deadline time.Time) error {
+	r, err := d.limitRecord(collection, resource, r)
+	if err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		d.dryRunf("write %s/%s", collection, resource)
+		return nil
+	}
+
+	if err := d.checkDatabase(); err != nil {
+		return err
+	}
+
+	if err := d.stashHistory(collection, resource); err != nil {
+		return err
+	}
+
+	if expired(deadline) {
+		return fmt.Errorf("writing %s/%s: %w", collection, resource, ErrTimeout)
+	}
+
+	// Dropped once the new content is in place, so a read in between can't
+	// cache the old one again.
+	defer d.uncache(collection, resource)
+
+	if d.singleFile {
+		if err := d.writePackedRecord(collection, resource, r); err != nil {
+			return err
+		}
+	} else {
+		if err := d.assignName(collection, resource); err != nil {
+			return err
+		}
+
+		fnlPath := d.homeFile(collection, resource)
+
+		if err := d.copyIntoDir(filepath.Dir(fnlPath), fnlPath, r); err != nil {
+			return err
+		}
+
+		if err := d.removeStale(collection, resource); err != nil {
+			return err
+		}
+
+		if err := d.removeEncoded(collection, resource); err != nil {
+			return err
+		}
+	}
+
+	if err := d.reindexRecord(collection, resource); err != nil {
+		return err
+	}
+
+	d.touch(collection, resource)
+	if err := d.evict(collection, resource); err != nil {
+		return err
+	}
+
+	d.emit(ChangeWrite, collection, resource)
+	d.log.Debugf("Successfully wrote %s/%s", collection, resource)
+	return nil
+}
+
+// limitRecord enforces MaxRecordBytes on the content of a record about to
+// be written. Content of known size is checked up front; anything else is
+// cut off with ErrRecordTooLarge once it passes the limit, which aborts the
+// write before the temp file is renamed into place.
+func (d *Driver) limitRecord(collection, resource string, r io.Reader) (io.Reader, error) {
+	if d.maxRecordBytes <= 0 {
+		return r, nil
+	}
+
+	if sized, ok := r.(interface{ Len() int }); ok {
+		if n := int64(sized.Len()); n > d.maxRecordBytes {
+			return nil, fmt.Errorf("%s/%s is %d bytes, limit %d: %w", collection, resource, n, d.maxRecordBytes, ErrRecordTooLarge)
+		}
+		return r, nil
+	}
+
+	return &limitedReader{r: r, left: d.maxRecordBytes, err: fmt.Errorf("%s/%s exceeds %d bytes: %w", collection, resource, d.maxRecordBytes, ErrRecordTooLarge)}, nil
+}
+
+// limitedReader is io.LimitReader failing with err instead of stopping
+// quietly at the limit.
+type limitedReader struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, l.err
+	}
+
+	// Read one byte past the limit to tell "exactly at" from "over".
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return 0, l.err
+	}
+	return n, err
+}
+
+// checkDatabase makes sure d.dir still exists, recreating it or failing
+// with ErrDatabaseMissing according to the configured policy.
+func (d *Driver) checkDatabase() error {
+	if _, err := os.Stat(d.dir); !os.IsNotExist(err) {
+		return nil
+	}
+
+	if d.missingDB == FailOnMissingDatabase {
+		return fmt.Errorf("%s: %w", d.dir, ErrDatabaseMissing)
+	}
+
+	d.log.Warnf("Database at %s is missing, recreating it", d.dir)
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+
+	metaMutex := d.getOrCreateMutex(metaFile)
+	metaMutex.Lock()
+	defer metaMutex.Unlock()
+
+	if _, err := os.Stat(filepath.Join(d.dir, metaFile)); err == nil {
+		return nil
+	}
+
+	return d.writeMeta(Metadata{Version: Version, CreatedAt: time.Now().UTC()})
+}
+
+// checkRecord validates the names of a record about to be written.
+func (d *Driver) checkRecord(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("Missing collection - no place to save record!")
+	}
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to save record (no name)!")
+	}
+
+	if isReserved(resource) {
+		return fmt.Errorf("resource %s: %w", resource, ErrReservedName)
+	}
+
+	if strings.HasSuffix(resource+".json", metaExt) {
+		return fmt.Errorf("resource %s would be taken for metadata: %w", resource, ErrInvalidName)
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return err
+	}
+
+	return d.checkCollision(collection, resource)
+}
+
+// checkCollision rejects a record whose name is taken by a sub-collection,
+// or whose collection path passes through an existing record: "orders" can
+// be a record or a sub-collection of a collection, not both, since Delete
+// couldn't tell which was meant.
+func (d *Driver) checkCollision(collection, resource string) error {
+	if d.singleFile {
+		return nil
+	}
+
+	rel := filepath.Join(collection, resource)
+	parts := strings.Split(rel, string(filepath.Separator))
+
+	for _, root := range d.roots() {
+		if fi, err := os.Stat(filepath.Join(root, rel)); err == nil && fi.IsDir() {
+			return fmt.Errorf("%s is a sub-collection, not a record: %w", rel, ErrInvalidName)
+		}
+
+		for i := 2; i < len(parts); i++ {
+			prefix := filepath.Join(parts[:i]...)
+			if fi, err := os.Stat(filepath.Join(root, prefix+".json")); err == nil && !fi.IsDir() {
+				return fmt.Errorf("%s is a record, not a collection: %w", prefix, ErrInvalidName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReadAll returns the records of a collection. A collection that doesn't
+// exist is an error, or no records if EmptyOnMissingCollection is set.
+// Reservations, and other empty record files, are left out, as are the
+// records of sub-collections.
+func (d *Driver) ReadAll(collection string) ([]string, error) {
+	records, err := d.readAll(collection)
+	if d.emptyOnMissing && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return records, opError("ReadAll", collection, "", err)
+}
+
+func (d *Driver) readAll(collection string) ([]string, error) {
+	collection = d.key(collection)
+
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read")
+	}
+
+	if isReserved(collection) {
+		return nil, fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if err := d.checkPath(collection); err != nil {
+		return nil, err
+	}
+
+	// Hold the read lock across the listing and the reads so concurrent
+	// writes and deletes can't tear the snapshot.
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if d.singleFile {
+		packed, err := d.readPacked(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		records := make([]string, 0, len(packed))
+		for resource, b := range packed {
+			if err := d.checkJSON(collection, resource, b); err != nil {
+				return nil, err
+			}
+			records = append(records, string(b))
+		}
+
+		d.log.Debugf("Successfully read all records from %s", collection)
+		return records, nil
+	}
+
+	if d.partitioned(collection) {
+		resources, err := d.partitionResources(collection)
+		if err != nil {
+			return nil, err
+		}
+
+		records := make([]string, 0, len(resources))
+		for _, resource := range resources {
+			b, err := d.readRecord(collection, resource)
+			if err == nil {
+				err = d.checkJSON(collection, resource, b)
+			}
+			if noContent(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, string(b))
+		}
+
+		d.log.Debugf("Successfully read all records from %s", collection)
+		return records, nil
+	}
+
+	var (
+		records []string
+		seen    = make(map[string]bool)
+		found   = false
+		lastErr error
+	)
+
+	for _, root := range d.roots() {
+		dir := filepath.Join(root, collection)
+
+		if _, err := stat(dir); err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			// Sub-collections are read on their own.
+			if file.IsDir() {
+				continue
+			}
+
+			name := file.Name()
+			if resource, ok := d.recordName(file); ok {
+				name = resource
+			}
+			if seen[name] || internalFile(file.Name()) {
+				continue
+			}
+			seen[name] = true
+
+			b, err := os.ReadFile(filepath.Join(dir, file.Name()))
+			if err == nil && len(b) == 0 {
+				err = d.emptyRecord(collection, name, filepath.Join(dir, file.Name()))
+			}
+			if err == nil {
+				b, err = d.decodeFile(file.Name(), b)
+			}
+			if err == nil {
+				err = d.checkJSON(collection, name, b)
+			}
+			if noContent(err) {
+				// Deleted after the listing, by another process or
+				// by hand: a race, not corruption. Empty files are
+				// reservations, or left by a crash for Fsck to find.
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, string(b))
+		}
+	}
+
+	if !found {
+		return nil, lastErr
+	}
+
+	d.log.Debugf("Successfully read all records from %s", collection)
+	return records, nil
+}
+
+// ReadAllUnion returns the records of several collections, one collection
+// after the other in the order given. Collections that don't exist are
+// skipped unless StrictUnion is set.
+func (d *Driver) ReadAllUnion(collections ...string) (_ []string, err error) {
+	defer wrapOp("ReadAllUnion", "", "", &err)
+
+	var records []string
+
+	for _, collection := range collections {
+		part, err := d.ReadAll(collection)
+		if errors.Is(err, fs.ErrNotExist) && !d.strictUnion {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, part...)
+	}
+
+	return records, nil
+}
+
+// Collections returns the names of the collections in the database.
+func (d *Driver) Collections() (_ []string, err error) {
+	defer wrapOp("Collections", "", "", &err)
+
+	done, err := d.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var collections []string
+
+	for _, root := range d.roots() {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			// Dot-directories are the driver's own, e.g. ReplaceCollection's
+			// staging area.
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !slices.Contains(collections, entry.Name()) {
+				collections = append(collections, entry.Name())
+			}
+		}
+	}
+
+	if d.singleFile {
+		packed, err := d.packedCollections()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, collection := range packed {
+			if !slices.Contains(collections, collection) {
+				collections = append(collections, collection)
+			}
+		}
+	}
+
+	return collections, nil
+}
+
+// CollectionStats returns the number of records in every collection of the
+// database. It reads each directory once, which is cheaper than calling
+// ListResources for every name Collections returns.
+func (d *Driver) CollectionStats() (_ map[string]int, err error) {
+	defer wrapOp("CollectionStats", "", "", &err)
+
+	done, err := d.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	seen := make(map[string]map[string]bool)
+
+	for _, root := range d.roots() {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			collection := entry.Name()
+			if !entry.IsDir() || strings.HasPrefix(collection, ".") {
+				continue
+			}
+			if seen[collection] == nil {
+				seen[collection] = make(map[string]bool)
+			}
+
+			if d.partitioned(collection) {
+				// partitionResources already covers every root.
+				resources, err := d.partitionResources(collection)
+				if err != nil {
+					return nil, err
+				}
+				for _, resource := range resources {
+					seen[collection][resource] = true
+				}
+				continue
+			}
+
+			files, err := os.ReadDir(filepath.Join(root, collection))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			for _, file := range files {
+				if resource, ok := d.recordName(file); ok {
+					seen[collection][resource] = true
+				}
+			}
+		}
+	}
+
+	stats := make(map[string]int, len(seen))
+	for collection, resources := range seen {
+		stats[collection] = len(resources)
+	}
+
+	if d.singleFile {
+		packed, err := d.packedCollections()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, collection := range packed {
+			resources, err := d.packedResources(collection)
+			if err != nil {
+				return nil, err
+			}
+			stats[collection] = len(resources)
+		}
+	}
+
+	return stats, nil
+}
+
+// ListResources returns the names of the records in a collection without
+// reading their contents. Temp files and sub-directories are skipped.
+func (d *Driver) ListResources(collection string) (_ []string, err error) {
+	defer wrapOp("ListResources", collection, "", &err)
+
+	done, err := d.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return d.listResources(collection)
+}
+
+// listResources is ListResources for callers that already registered with
+// Close, typically while holding the collection lock. It doesn't check for
+// Close itself, so an operation in flight when Close is called isn't cut
+// short between its steps.
+func (d *Driver) listResources(collection string) ([]string, error) {
+	collection = d.key(collection)
+
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to list")
+	}
+
+	if isReserved(collection) {
+		return nil, fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if err := d.checkPath(collection); err != nil {
+		return nil, err
+	}
+
+	if d.singleFile {
+		return d.packedResources(collection)
+	}
+
+	if d.partitioned(collection) {
+		return d.partitionResources(collection)
+	}
+
+	var (
+		resources []string
+		seen      = make(map[string]bool)
+		found     = false
+		lastErr   error
+	)
+
+	for _, root := range d.roots() {
+		files, err := os.ReadDir(filepath.Join(root, collection))
+		if os.IsNotExist(err) {
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+
+		for _, file := range files {
+			if resource, ok := d.recordName(file); ok && !seen[resource] {
+				seen[resource] = true
+				resources = append(resources, resource)
+			}
+		}
+	}
+
+	if !found {
+		return nil, lastErr
+	}
+
+	return d.resourceNames(collection, resources)
+}
+
+// ReadAllOrdered is like ReadAll but returns records sorted by resource key,
+// so the result is the same on every platform.
+func (d *Driver) ReadAllOrdered(collection string) (_ []string, err error) {
+	defer wrapOp("ReadAllOrdered", collection, "", &err)
+
+	collection = d.key(collection)
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(resources)
+
+	records := make([]string, 0, len(resources))
+
+	for _, resource := range resources {
+		b, err := d.readRecord(collection, resource)
+		if err == nil {
+			err = d.checkJSON(collection, resource, b)
+		}
+		if noContent(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, string(b))
+	}
+
+	d.log.Debugf("Successfully read all records from %s", collection)
+	return records, nil
+}
+
+// ReadAllMap is like ReadAll but returns the records keyed by resource name.
+func (d *Driver) ReadAllMap(collection string) (_ map[string]string, err error) {
+	defer wrapOp("ReadAllMap", collection, "", &err)
+
+	collection = d.key(collection)
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]string, len(resources))
+
+	for _, resource := range resources {
+		b, err := d.readRecord(collection, resource)
+		if err == nil {
+			err = d.checkJSON(collection, resource, b)
+		}
+		if noContent(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records[resource] = string(b)
+	}
+
+	d.log.Debugf("Successfully read all records from %s", collection)
+	return records, nil
+}
+
+// ReadAllParallel is like ReadAllOrdered but reads the records with up to
+// workers goroutines. The first read error stops the remaining work.
+func (d *Driver) ReadAllParallel(collection string, workers int) (_ []string, err error) {
+	defer wrapOp("ReadAllParallel", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(resources)
+
+	records := make([]string, len(resources))
+	present := make([]bool, len(resources))
+	jobs := make(chan int)
+	done := make(chan struct{})
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				b, err := d.readRecord(collection, resources[i])
+				if err == nil {
+					err = d.checkJSON(collection, resources[i], b)
+				}
+				if noContent(err) {
+					continue
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(done)
+					})
+					return
+				}
+				records[i] = string(b)
+				present[i] = true
+			}
+		}()
+	}
+
+feed:
+	for i := range resources {
+		select {
+		case jobs <- i:
+		case <-done:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	n := 0
+	for i, ok := range present {
+		if ok {
+			records[n] = records[i]
+			n++
+		}
+	}
+	records = records[:n]
+
+	d.log.Debugf("Successfully read all records from %s", collection)
+	return records, nil
+}
+
+// Scan returns the names of the records in a collection whose keys start
+// with prefix. An empty prefix matches every record.
+func (d *Driver) Scan(collection, prefix string) (_ []string, err error) {
+	defer wrapOp("Scan", collection, "", &err)
+
+	collection, prefix = d.key(collection), d.key(prefix)
+
+	resources, err := d.ListResources(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+
+	for _, resource := range resources {
+		if strings.HasPrefix(resource, prefix) {
+			matches = append(matches, resource)
+		}
+	}
+
+	return matches, nil
 }
 
 func main() {
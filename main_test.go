@@ -0,0 +1,1346 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestDBVersion(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	v, err := d.DBVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != Version {
+		t.Errorf("DBVersion = %q, want %q", v, Version)
+	}
+}
+
+func TestDBVersionUpgradesUnversionedDatabase(t *testing.T) {
+	d := newTestDriver(t, nil)
+	if err := os.Remove(filepath.Join(d.dir, metaFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := d.DBVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != Version {
+		t.Errorf("DBVersion = %q, want %q", v, Version)
+	}
+
+	m, err := d.Meta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != Version {
+		t.Errorf("recorded version = %q, want %q", m.Version, Version)
+	}
+}
+
+func TestDBVersionDryRunDoesNotRecord(t *testing.T) {
+	d := newTestDriver(t, nil)
+	if err := os.Remove(filepath.Join(d.dir, metaFile)); err != nil {
+		t.Fatal(err)
+	}
+	d.dryRun = true
+
+	if v, err := d.DBVersion(); err != nil || v != Version {
+		t.Fatalf("DBVersion = %q, %v", v, err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, metaFile)); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote the meta file: %v", err)
+	}
+}
+
+func TestMetaAndSetMeta(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	m, err := d.Meta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != Version || m.CreatedAt.IsZero() {
+		t.Errorf("Meta = %+v, want version and creation time", m)
+	}
+
+	if err := d.SetMeta("owner", "zoro"); err != nil {
+		t.Fatal(err)
+	}
+	m, err = d.Meta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Tags["owner"] != "zoro" {
+		t.Errorf("Tags = %v, want owner=zoro", m.Tags)
+	}
+
+	if err := d.SetMeta("", "x"); err == nil {
+		t.Error("SetMeta with an empty key succeeded")
+	}
+}
+
+func TestMetaWithoutMetaFile(t *testing.T) {
+	d := newTestDriver(t, nil)
+	if err := os.Remove(filepath.Join(d.dir, metaFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := d.Meta()
+	if err != nil {
+		t.Fatalf("Meta: %v", err)
+	}
+	if m.Version != "" || !m.CreatedAt.IsZero() {
+		t.Errorf("Meta = %+v, want empty metadata", m)
+	}
+
+	if err := d.SetMeta("owner", "luffy"); err != nil {
+		t.Fatalf("SetMeta: %v", err)
+	}
+	if m, err = d.Meta(); err != nil || m.Tags["owner"] != "luffy" {
+		t.Errorf("Meta = %+v, %v", m, err)
+	}
+}
+
+func TestListResources(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for _, name := range []string{"nemo", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+	mustWrite(t, d, "fish/reef", "bruce", fish{Name: "bruce"})
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "gill.json.tmp"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := d.ListResources("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	if want := []string{"dory", "marlin", "nemo"}; !slices.Equal(names, want) {
+		t.Errorf("ListResources = %v, want %v", names, want)
+	}
+
+	if _, err := d.ListResources("birds"); !os.IsNotExist(err) {
+		t.Errorf("ListResources of a missing collection = %v, want not exist", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for _, name := range []string{"user-1", "user-2", "admin-1"} {
+		mustWrite(t, d, "people", name, fish{Name: name})
+	}
+
+	matches, err := d.Scan("people", "user-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(matches)
+	if want := []string{"user-1", "user-2"}; !slices.Equal(matches, want) {
+		t.Errorf("Scan = %v, want %v", matches, want)
+	}
+
+	all, err := d.Scan("people", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("Scan with an empty prefix = %v, want every record", all)
+	}
+
+	none, err := d.Scan("people", "guest-")
+	if err != nil || len(none) != 0 {
+		t.Errorf("Scan without matches = %v, %v", none, err)
+	}
+}
+
+func TestReadAllOrdered(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for _, name := range []string{"nemo", "bruce", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+
+	records, err := d.ReadAllOrdered("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fishNames(t, records), []string{"bruce", "dory", "marlin", "nemo"}; !slices.Equal(got, want) {
+		t.Errorf("ReadAllOrdered = %v, want %v", got, want)
+	}
+}
+
+func TestRenameCollection(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	if err := d.RenameCollection("fish", "clownfish"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("clownfish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read from the renamed collection = %+v, %v", got, err)
+	}
+	if err := d.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Errorf("Read from the old name = %v, want not exist", err)
+	}
+	if history, err := d.History("clownfish", "nemo"); err != nil || len(history) != 1 {
+		t.Errorf("History of the renamed collection = %v, %v", history, err)
+	}
+}
+
+func TestRenameCollectionErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+
+	if err := d.RenameCollection("birds", "parrots"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("renaming a missing collection = %v, want ErrNotFound", err)
+	}
+	if err := d.RenameCollection("fish", "sharks"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("renaming onto an existing collection = %v, want ErrAlreadyExists", err)
+	}
+	if err := d.RenameCollection("fish", ""); err == nil {
+		t.Error("renaming to an empty name succeeded")
+	}
+}
+
+func TestRenameCollectionEscape(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "users", "Zoro", fish{Name: "Zoro"})
+
+	for _, names := range [][2]string{{"users", "../escaped"}, {"../users", "escaped"}, {"users", "a/../../escaped"}} {
+		if err := d.RenameCollection(names[0], names[1]); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("RenameCollection(%q, %q) = %v, want ErrInvalidName", names[0], names[1], err)
+		}
+	}
+	if err := d.RenameCollection("users", trashDir); !errors.Is(err, ErrReservedName) {
+		t.Errorf("RenameCollection into the trash = %v, want ErrReservedName", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(d.dir), "escaped")); !os.IsNotExist(err) {
+		t.Errorf("collection moved out of the database directory: %v", err)
+	}
+	var got fish
+	if err := d.Read("users", "Zoro", &got); err != nil || got.Name != "Zoro" {
+		t.Errorf("Read after the rejected renames = %+v, %v", got, err)
+	}
+}
+
+func TestReadAllDuringWrites(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for age := 0; age < 50; age++ {
+			if err := d.Write("fish", "nemo", fish{Name: "nemo", Age: age}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		records, err := d.ReadAll("fish")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("ReadAll returned %d records, want 1", len(records))
+		}
+		if !json.Valid([]byte(records[0])) {
+			t.Fatalf("ReadAll returned a partly written record: %q", records[0])
+		}
+	}
+	wg.Wait()
+}
+
+func TestReadAllSkipsInternalFiles(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	for _, name := range []string{"nemo.json.tmp", "nemo.photo" + blobExt, "nemo" + metaExt} {
+		if err := os.WriteFile(filepath.Join(d.dir, "fish", name), []byte(`{"name":"other"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := d.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"nemo"}) {
+		t.Errorf("ReadAll = %v, want only the record", got)
+	}
+}
+
+func TestTempDir(t *testing.T) {
+	tempDir := filepath.Join(t.TempDir(), "staging")
+	if err := os.Mkdir(tempDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestDriver(t, &Options{TempDir: tempDir})
+
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.WriteRaw("fish", "dory", strings.NewReader(`{"name":"dory"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAllOrdered("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"dory", "nemo"}) {
+		t.Errorf("ReadAllOrdered = %v", got)
+	}
+
+	for _, dir := range []string{tempDir, filepath.Join(d.dir, "fish")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".tmp") {
+				t.Errorf("temp file %s left in %s", entry.Name(), dir)
+			}
+		}
+	}
+}
+
+func TestTempDirMissing(t *testing.T) {
+	opts := &Options{Logger: discardLogger(), TempDir: filepath.Join(t.TempDir(), "missing")}
+	if _, err := New(filepath.Join(t.TempDir(), "db"), opts); err == nil {
+		t.Error("New with a missing TempDir succeeded")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.WriteJSON("fish", "nemo", json.RawMessage(`{"name":"nemo","age":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rawRecord(t, d, "fish", "nemo"), "{\n\t\"name\": \"nemo\",\n\t\"age\": 1\n}\n"; got != want {
+		t.Errorf("stored record = %q, want %q", got, want)
+	}
+
+	if err := d.WriteJSON("fish", "dory", json.RawMessage(`{"name":`)); err == nil {
+		t.Error("WriteJSON of invalid JSON succeeded")
+	}
+	if _, err := d.ReadBytes("fish", "dory", nil); !os.IsNotExist(err) {
+		t.Errorf("invalid JSON was stored: %v", err)
+	}
+}
+
+func TestIndentDisabled(t *testing.T) {
+	d := newTestDriver(t, &Options{Indent: boolPtr(false)})
+
+	raw := `{ "name": "nemo" }`
+	if err := d.WriteJSON("fish", "nemo", json.RawMessage(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if got := rawRecord(t, d, "fish", "nemo"); got != raw {
+		t.Errorf("WriteJSON stored %q, want the given bytes %q", got, raw)
+	}
+
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	if got, want := rawRecord(t, d, "fish", "dory"), "{\"name\":\"dory\"}\n"; got != want {
+		t.Errorf("Write stored %q, want %q", got, want)
+	}
+}
+
+func TestTrailingNewline(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		opts      Options
+		write     string
+		writeJSON string
+	}{
+		{"default", Options{}, "{\n\t\"name\": \"nemo\"\n}\n", "{\n\t\"name\": \"dory\"\n}\n"},
+		{"no newline", Options{TrailingNewline: boolPtr(false)}, "{\n\t\"name\": \"nemo\"\n}", "{\n\t\"name\": \"dory\"\n}"},
+		{"no newline or indent", Options{TrailingNewline: boolPtr(false), Indent: boolPtr(false)}, `{"name":"nemo"}`, `{"name":"dory"}`},
+	} {
+		d := newTestDriver(t, &tt.opts)
+		mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+		if err := d.WriteJSON("fish", "dory", json.RawMessage(`{"name":"dory"}`)); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := rawRecord(t, d, "fish", "nemo"); got != tt.write {
+			t.Errorf("%s: Write stored %q, want %q", tt.name, got, tt.write)
+		}
+		if got := rawRecord(t, d, "fish", "dory"); got != tt.writeJSON {
+			t.Errorf("%s: WriteJSON stored %q, want %q", tt.name, got, tt.writeJSON)
+		}
+	}
+}
+
+func TestReadAllParallel(t *testing.T) {
+	d := newTestDriver(t, nil)
+	var want []string
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		want = append(want, name)
+	}
+
+	for _, workers := range []int{0, 1, 4, 50} {
+		records, err := d.ReadAllParallel("fish", workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fishNames(t, records); !slices.Equal(got, want) {
+			t.Errorf("%d workers: ReadAllParallel = %v, want %v", workers, got, want)
+		}
+	}
+}
+
+func TestReadAllParallelCorruptRecord(t *testing.T) {
+	d := newTestDriver(t, &Options{ValidateOnRead: true})
+	for i := 0; i < 10; i++ {
+		mustWrite(t, d, "fish", fmt.Sprintf("fish-%d", i), fish{Name: "nemo"})
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "fish-5.json"), []byte(`{"name":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.ReadAllParallel("fish", 3); !errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("ReadAllParallel with a corrupt record = %v, want ErrCorruptRecord", err)
+	}
+}
+
+func BenchmarkReadAllParallel(b *testing.B) {
+	d := newTestDriver(b, nil)
+	for i := 0; i < 200; i++ {
+		mustWrite(b, d, "fish", fmt.Sprintf("fish-%03d", i), fish{Name: "nemo", Age: i})
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := d.ReadAll("fish"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		for _, workers := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := d.ReadAllParallel("fish", workers); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	live := openTestDriver(t, dir, &Options{KeepHistory: 1})
+	mustWrite(t, live, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, live, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	d := openTestDriver(t, dir, &Options{DryRun: true, KeepHistory: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 3})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	if err := d.Rollback("fish", "nemo", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetMeta("owner", "zoro"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := live.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("record after dry-run changes = %+v, %v", got, err)
+	}
+	if err := live.Read("fish", "dory", &got); !os.IsNotExist(err) {
+		t.Errorf("dry-run Write created a record: %v", err)
+	}
+	if m, err := live.Meta(); err != nil || m.Tags["owner"] != "" {
+		t.Errorf("dry-run SetMeta changed the metadata: %+v, %v", m, err)
+	}
+}
+
+func TestDryRunSoftDelete(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	live := openTestDriver(t, dir, &Options{SoftDelete: true})
+	mustWrite(t, live, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, live, "fish", "dory", fish{Name: "dory"})
+	if err := live.Delete("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+
+	d := openTestDriver(t, dir, &Options{SoftDelete: true, DryRun: true})
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Restore("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PurgeTrash(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := live.Read("fish", "nemo", &got); err != nil {
+		t.Errorf("dry-run Delete removed the record: %v", err)
+	}
+	if err := live.Restore("fish", "dory"); err != nil {
+		t.Errorf("dry-run Restore or PurgeTrash changed the trash: %v", err)
+	}
+}
+
+func TestNewJSONLogger(t *testing.T) {
+	var buf strings.Builder
+	log := NewJSONLogger()
+	log.SetOutput(&buf)
+	log.Info("hello")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(buf.String()), &line); err != nil {
+		t.Fatalf("log line %q isn't JSON: %v", buf.String(), err)
+	}
+	if line["msg"] != "hello" {
+		t.Errorf("log line = %v, want msg hello", line)
+	}
+}
+
+func TestLogJSON(t *testing.T) {
+	d := newTestDriver(t, &Options{LogJSON: true})
+	d.log.SetOutput(io.Discard)
+
+	if _, ok := d.log.Formatter.(*logrus.JSONFormatter); !ok {
+		t.Errorf("LogJSON logger uses %T, want a JSON formatter", d.log.Formatter)
+	}
+
+	opts := &Options{LogJSON: true, Logger: discardLogger()}
+	if _, err := New(filepath.Join(t.TempDir(), "db"), opts); err == nil {
+		t.Error("New with LogJSON and a custom Logger succeeded")
+	}
+}
+
+func TestMissingDatabaseRecreated(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := os.RemoveAll(d.dir); err != nil {
+		t.Fatal(err)
+	}
+
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	var got fish
+	if err := d.Read("fish", "dory", &got); err != nil || got.Name != "dory" {
+		t.Errorf("Read after recreating the database = %+v, %v", got, err)
+	}
+	if m, err := d.Meta(); err != nil || m.Version != Version {
+		t.Errorf("metadata of the recreated database = %+v, %v", m, err)
+	}
+}
+
+func TestMissingDatabaseFail(t *testing.T) {
+	d := newTestDriver(t, &Options{MissingDatabase: FailOnMissingDatabase})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := os.RemoveAll(d.dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("fish", "dory", fish{Name: "dory"}); !errors.Is(err, ErrDatabaseMissing) {
+		t.Errorf("Write to a removed database = %v, want ErrDatabaseMissing", err)
+	}
+	if _, err := os.Stat(d.dir); !os.IsNotExist(err) {
+		t.Errorf("Write recreated the database: %v", err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	red := openTestDriver(t, dir, &Options{Namespace: "red"})
+	blue := openTestDriver(t, dir, &Options{Namespace: "blue"})
+
+	mustWrite(t, red, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, blue, "sharks", "bruce", fish{Name: "bruce"})
+
+	var got fish
+	if err := blue.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Errorf("one tenant read another's record: %v", err)
+	}
+	if !isFile(filepath.Join(dir, "red", "fish", "nemo.json")) || !isFile(filepath.Join(dir, "red", metaFile)) {
+		t.Error("records and metadata aren't stored under the namespace")
+	}
+
+	collections, err := red.Collections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(collections, []string{"fish"}) {
+		t.Errorf("Collections = %v, want [fish]", collections)
+	}
+}
+
+func TestNamespaceInvalid(t *testing.T) {
+	for _, ns := range []string{"a/b", "..", ".", metaFile, "x/../y"} {
+		opts := &Options{Logger: discardLogger(), Namespace: ns}
+		if _, err := New(filepath.Join(t.TempDir(), "db"), opts); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("New with namespace %q = %v, want ErrInvalidName", ns, err)
+		}
+	}
+}
+
+func TestReadAllUnion(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		d := newTestDriver(t, &Options{StrictUnion: strict})
+		mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+		mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+
+		records, err := d.ReadAllUnion("sharks", "fish")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fishNames(t, records); !slices.Equal(got, []string{"bruce", "nemo"}) {
+			t.Errorf("ReadAllUnion = %v, want the collections in order", got)
+		}
+
+		records, err = d.ReadAllUnion("fish", "birds")
+		if strict && !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("strict ReadAllUnion with a missing collection = %v, want not exist", err)
+		}
+		if !strict && (err != nil || len(records) != 1) {
+			t.Errorf("ReadAllUnion with a missing collection = %v, %v, want it skipped", records, err)
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"negative OperationTimeout":        {OperationTimeout: -time.Second},
+		"negative MaxRecordsPerCollection": {MaxRecordsPerCollection: -1},
+		"negative KeepHistory":             {KeepHistory: -1},
+		"negative MaxRecordBytes":          {MaxRecordBytes: -1},
+		"unknown Symlinks policy":          {Symlinks: SymlinkPolicy(7)},
+		"unknown MissingDatabase policy":   {MissingDatabase: MissingDatabasePolicy(7)},
+		"empty data dir":                   {DataDirs: []string{""}},
+		"single file with data dirs":       {SingleFilePerCollection: true, DataDirs: []string{"x"}},
+		"single file with soft delete":     {SingleFilePerCollection: true, SoftDelete: true},
+	} {
+		opts.Logger = discardLogger()
+		dir := filepath.Join(t.TempDir(), "db")
+		if _, err := New(dir, &opts); err == nil {
+			t.Errorf("%s: New succeeded", name)
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s: New created the database despite invalid options", name)
+		}
+	}
+}
+
+func TestOptionsValidateReportsEveryProblem(t *testing.T) {
+	opts := &Options{Logger: discardLogger(), KeepHistory: -1, CacheSize: -1}
+
+	_, err := New(filepath.Join(t.TempDir(), "db"), opts)
+	if err == nil {
+		t.Fatal("New succeeded")
+	}
+	for _, want := range []string{"KeepHistory", "CacheSize"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %s", err, want)
+		}
+	}
+}
+
+func TestReadAllSkipsVanishedRecords(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	// A dangling symlink is listed but fails to open like a record deleted
+	// between the listing and the read.
+	if err := os.Symlink(filepath.Join(d.dir, "fish", "gone.json"), filepath.Join(d.dir, "fish", "ghost.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, readAll := range map[string]func(string) ([]string, error){
+		"ReadAll":        d.ReadAll,
+		"ReadAllOrdered": d.ReadAllOrdered,
+		"ReadAllParallel": func(c string) ([]string, error) {
+			return d.ReadAllParallel(c, 2)
+		},
+	} {
+		records, err := readAll("fish")
+		if err != nil {
+			t.Errorf("%s with a vanished record = %v", name, err)
+			continue
+		}
+		if got := fishNames(t, records); !slices.Equal(got, []string{"nemo"}) {
+			t.Errorf("%s = %v, want [nemo]", name, got)
+		}
+	}
+}
+
+func TestMarshalAndUnmarshalFunc(t *testing.T) {
+	d := newTestDriver(t, &Options{
+		MarshalFunc:   func(v interface{}) ([]byte, error) { return xml.Marshal(v) },
+		UnmarshalFunc: xml.Unmarshal,
+	})
+
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	if got, want := rawRecord(t, d, "fish", "nemo"), "<fish><Name>nemo</Name><Age>1</Age></fish>\n"; got != want {
+		t.Errorf("stored record = %q, want %q", got, want)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got != (fish{Name: "nemo", Age: 1}) {
+		t.Errorf("Read = %+v, %v", got, err)
+	}
+
+	typed, err := NewTypedDriver[fish](d, "fish").Get("nemo")
+	if err != nil || typed != got {
+		t.Errorf("TypedDriver.Get = %+v, %v", typed, err)
+	}
+
+	ages, err := MapReduce(d, "fish", func(f fish) int { return f.Age }, func(acc, age int) int { return acc + age }, 0)
+	if err != nil || ages != 1 {
+		t.Errorf("MapReduce = %d, %v", ages, err)
+	}
+}
+
+func TestMarshalFuncError(t *testing.T) {
+	d := newTestDriver(t, &Options{MarshalFunc: func(v interface{}) ([]byte, error) {
+		return nil, errors.New("can't encode")
+	}})
+
+	if err := d.Write("fish", "nemo", fish{Name: "nemo"}); err == nil || !strings.Contains(err.Error(), "can't encode") {
+		t.Errorf("Write with a failing MarshalFunc = %v", err)
+	}
+	if _, err := d.ReadBytes("fish", "nemo", nil); !os.IsNotExist(err) {
+		t.Errorf("Write with a failing MarshalFunc stored a record: %v", err)
+	}
+}
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	d := newTestDriver(t, &Options{CaseInsensitiveKeys: true})
+	mustWrite(t, d, "Fish", "Nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "FISH", "NEMO", fish{Name: "nemo", Age: 2})
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read with other case = %+v, %v", got, err)
+	}
+	if !isFile(filepath.Join(d.dir, "fish", "nemo.json")) {
+		t.Error("record isn't stored under the lowercase name")
+	}
+
+	names, err := d.ListResources("FiSh")
+	if err != nil || !slices.Equal(names, []string{"nemo"}) {
+		t.Errorf("ListResources = %v, %v", names, err)
+	}
+	if matches, err := d.Scan("fish", "NE"); err != nil || !slices.Equal(matches, []string{"nemo"}) {
+		t.Errorf("Scan with an upper-case prefix = %v, %v", matches, err)
+	}
+
+	if err := d.Delete("Fish", "NeMo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Errorf("Read after Delete = %v, want not exist", err)
+	}
+}
+
+func TestCaseSensitiveKeys(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "Nemo", fish{Name: "Nemo"})
+
+	names, err := d.ListResources("fish")
+	if err != nil || !slices.Equal(names, []string{"Nemo"}) {
+		t.Errorf("ListResources = %v, %v, want the name as written", names, err)
+	}
+}
+
+func TestReadAllMap(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	records, err := d.ReadAllMap("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("ReadAllMap = %v, want 2 records", records)
+	}
+	for resource, record := range records {
+		if got := fishNames(t, []string{record}); got[0] != resource {
+			t.Errorf("record %s holds %s", resource, got[0])
+		}
+	}
+
+	if _, err := d.ReadAllMap("birds"); !os.IsNotExist(err) {
+		t.Errorf("ReadAllMap of a missing collection = %v, want not exist", err)
+	}
+}
+
+func TestValidateOnRead(t *testing.T) {
+	d := newTestDriver(t, &Options{ValidateOnRead: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "dory.json"), []byte(`{"name": "dory",}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Errorf("Read of a valid record = %v", err)
+	}
+
+	err := d.Read("fish", "dory", &got)
+	if !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("Read of a broken record = %v, want ErrCorruptRecord", err)
+	}
+	if !strings.Contains(err.Error(), "fish/dory") || !strings.Contains(err.Error(), "offset 17") {
+		t.Errorf("error %q doesn't name the record and offset", err)
+	}
+
+	if _, err := d.ReadBytes("fish", "dory", nil); !errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("ReadBytes of a broken record = %v, want ErrCorruptRecord", err)
+	}
+	if _, err := d.ReadAll("fish"); !errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("ReadAll with a broken record = %v, want ErrCorruptRecord", err)
+	}
+}
+
+func TestValidateOnReadOff(t *testing.T) {
+	d := newTestDriver(t, nil)
+	if err := os.MkdirAll(filepath.Join(d.dir, "fish"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "dory.json"), []byte(`{"name": "dory",}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "dory", &got); err == nil || errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("Read of a broken record = %v, want the plain decoding error", err)
+	}
+}
+
+func TestRecordAndSubCollectionCollisions(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "shop/orders", "1", fish{Name: "order"})
+	mustWrite(t, d, "shop", "owner", fish{Name: "zoro"})
+
+	if err := d.Write("shop", "orders", fish{Name: "x"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write of a record named like a sub-collection = %v, want ErrInvalidName", err)
+	}
+	if err := d.Write("shop/owner", "1", fish{Name: "x"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write into a collection named like a record = %v, want ErrInvalidName", err)
+	}
+
+	// Made by hand: Delete won't guess which one is meant.
+	if err := os.WriteFile(filepath.Join(d.dir, "shop", "orders.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("shop", "orders"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Delete of a record and sub-collection = %v, want ErrInvalidName", err)
+	}
+	if err := os.Remove(filepath.Join(d.dir, "shop", "orders.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("shop", "orders"); err != nil {
+		t.Fatalf("Delete of a sub-collection = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "shop", "orders")); !os.IsNotExist(err) {
+		t.Errorf("sub-collection still exists: %v", err)
+	}
+}
+
+func TestWriteIfChanged(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 5})
+
+	changed, err := d.WriteIfChanged("fish", "nemo", fish{Name: "nemo"})
+	if err != nil || !changed {
+		t.Fatalf("first WriteIfChanged = %v, %v, want a write", changed, err)
+	}
+
+	path := filepath.Join(d.dir, "fish", "nemo.json")
+	long := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, long, long); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err = d.WriteIfChanged("fish", "nemo", fish{Name: "nemo"})
+	if err != nil || changed {
+		t.Errorf("WriteIfChanged of the same value = %v, %v, want it skipped", changed, err)
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.ModTime().Equal(long) {
+		t.Errorf("skipped write changed the modification time")
+	}
+	if history, err := d.History("fish", "nemo"); err != nil || len(history) != 0 {
+		t.Errorf("skipped write added history: %v, %v", history, err)
+	}
+
+	changed, err = d.WriteIfChanged("fish", "nemo", fish{Name: "nemo", Age: 1})
+	if err != nil || !changed {
+		t.Errorf("WriteIfChanged of a new value = %v, %v, want a write", changed, err)
+	}
+}
+
+// mergeFields is a ConflictResolver keeping the fields of both records, the
+// incoming ones winning.
+func mergeFields(existing, incoming []byte) ([]byte, error) {
+	var merged, in map[string]interface{}
+	if err := json.Unmarshal(existing, &merged); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(incoming, &in); err != nil {
+		return nil, err
+	}
+	for k, v := range in {
+		merged[k] = v
+	}
+
+	return json.Marshal(merged)
+}
+
+func TestConflictResolver(t *testing.T) {
+	calls := 0
+	d := newTestDriver(t, &Options{ConflictResolver: func(existing, incoming []byte) ([]byte, error) {
+		calls++
+		return mergeFields(existing, incoming)
+	}})
+
+	mustWrite(t, d, "users", "zoro", map[string]interface{}{"name": "zoro", "swords": 3})
+	if calls != 0 {
+		t.Errorf("resolver called %d times for a new record", calls)
+	}
+	mustWrite(t, d, "users", "zoro", map[string]interface{}{"name": "Zoro", "bounty": 320})
+
+	m, err := d.ReadMap("users", "zoro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["name"] != "Zoro" || m["swords"] != json.Number("3") || m["bounty"] != json.Number("320") {
+		t.Errorf("merged record = %v", m)
+	}
+
+	// The read-modify-write helpers already start from the stored record.
+	calls = 0
+	if _, err := d.Increment("users", "zoro", "swords", 1); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("Increment called the resolver %d times", calls)
+	}
+}
+
+func TestConflictResolverError(t *testing.T) {
+	d := newTestDriver(t, &Options{ConflictResolver: func(existing, incoming []byte) ([]byte, error) {
+		return nil, errors.New("conflict")
+	}})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	if err := d.Write("fish", "nemo", fish{Name: "nemo", Age: 1}); err == nil || !strings.Contains(err.Error(), "conflict") {
+		t.Errorf("Write with a failing resolver = %v", err)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 0 {
+		t.Errorf("record after a failed resolve = %+v, %v", got, err)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	var buf strings.Builder
+	log := logrus.New()
+	log.SetOutput(&buf)
+	log.SetLevel(logrus.InfoLevel)
+	d := newTestDriver(t, &Options{Logger: log})
+
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if strings.Contains(buf.String(), "level=debug") {
+		t.Fatalf("debug output at info level: %s", buf.String())
+	}
+
+	d.SetLogLevel(logrus.DebugLevel)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if !strings.Contains(buf.String(), "level=debug") {
+		t.Errorf("no debug output after SetLogLevel(DebugLevel): %q", buf.String())
+	}
+}
+
+func TestMaxRecordBytes(t *testing.T) {
+	d := newTestDriver(t, &Options{MaxRecordBytes: 64})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	big := fish{Name: strings.Repeat("n", 100)}
+	if err := d.Write("fish", "nemo", big); !errors.Is(err, ErrRecordTooLarge) {
+		t.Errorf("Write over the limit = %v, want ErrRecordTooLarge", err)
+	}
+	if err := d.WriteRaw("fish", "nemo", strings.NewReader(`{"name":"`+big.Name+`"}`)); !errors.Is(err, ErrRecordTooLarge) {
+		t.Errorf("WriteRaw over the limit = %v, want ErrRecordTooLarge", err)
+	}
+	if err := d.WriteJSON("fish", "nemo", json.RawMessage(`{"name":"`+big.Name+`"}`)); !errors.Is(err, ErrRecordTooLarge) {
+		t.Errorf("WriteJSON over the limit = %v, want ErrRecordTooLarge", err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("record after oversized writes = %+v, %v", got, err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(d.dir, "fish")); err != nil || len(entries) != 1 {
+		t.Errorf("files after oversized writes = %v, %v", entries, err)
+	}
+}
+
+func TestReadMap(t *testing.T) {
+	d := newTestDriver(t, nil)
+	if err := d.WriteJSON("users", "zoro", json.RawMessage(`{"name":"zoro","bounty":9007199254740993,"crew":{"ship":"sunny"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := d.ReadMap("users", "zoro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["name"] != "zoro" {
+		t.Errorf("name = %v", m["name"])
+	}
+	if m["bounty"] != json.Number("9007199254740993") {
+		t.Errorf("bounty = %#v, want the exact json.Number", m["bounty"])
+	}
+	if crew, ok := m["crew"].(map[string]interface{}); !ok || crew["ship"] != "sunny" {
+		t.Errorf("crew = %#v", m["crew"])
+	}
+
+	if _, err := d.ReadMap("users", "luffy"); !os.IsNotExist(err) {
+		t.Errorf("ReadMap of a missing record = %v, want not exist", err)
+	}
+}
+
+func TestReadMapUser(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeUsers(t, d)
+
+	m, err := d.ReadMap("users", "Zoro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["Name"] != "Zoro" || m["Company"] != "Asura Tech" {
+		t.Errorf("ReadMap = %#v", m)
+	}
+	if m["Age"] != json.Number("21") {
+		t.Errorf("Age = %#v, want json.Number 21", m["Age"])
+	}
+
+	address, ok := m["Address"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Address = %#v, want a nested map", m["Address"])
+	}
+	if address["City"] != "Shimotsuki Village" || address["Country"] != "Mars" {
+		t.Errorf("Address = %#v", address)
+	}
+}
+
+func TestEmptyOnMissingCollection(t *testing.T) {
+	d := newTestDriver(t, &Options{EmptyOnMissingCollection: true})
+
+	records, err := d.ReadAll("birds")
+	if err != nil || len(records) != 0 {
+		t.Errorf("ReadAll of a missing collection = %v, %v, want no records", records, err)
+	}
+
+	// Other errors still come through.
+	if _, err := d.ReadAll(metaFile); !errors.Is(err, ErrReservedName) {
+		t.Errorf("ReadAll of a reserved name = %v, want ErrReservedName", err)
+	}
+}
+
+func TestCollectionStats(t *testing.T) {
+	d := newTestDriver(t, &Options{DataDirs: []string{filepath.Join(t.TempDir(), "data")}})
+	for _, name := range []string{"nemo", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+	mustWrite(t, d, "sharks", "anchor", fish{Name: "anchor"})
+	if err := d.Delete("sharks", "anchor"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := d.CollectionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Records spread over DataDirs are counted once, and the trash and
+	// other internal directories aren't collections.
+	want := map[string]int{"fish": 3, "sharks": 1}
+	if !maps.Equal(stats, want) {
+		t.Errorf("CollectionStats() = %v, want %v", stats, want)
+	}
+	for collection, count := range stats {
+		resources, err := d.ListResources(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resources) != count {
+			t.Errorf("%s: %d records, ListResources has %d", collection, count, len(resources))
+		}
+	}
+}
+
+func TestWriteAll(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	failed, err := d.WriteAll("fish", map[string]interface{}{
+		"nemo":    fish{Name: "nemo"},
+		"dory":    fish{Name: "dory"},
+		"bubbles": make(chan int),
+		"":        fish{Name: "nobody"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures are reported per resource and don't stop the other writes.
+	if len(failed) != 2 || failed["bubbles"] == nil || failed[""] == nil {
+		t.Errorf("failed = %v, want errors for bubbles and the empty name", failed)
+	}
+	records, err := d.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fishNames(t, records), []string{"dory", "nemo"}; !slices.Equal(got, want) {
+		t.Errorf("written records = %v, want %v", got, want)
+	}
+}
+
+func TestWriteAllErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+	records := map[string]interface{}{"nemo": fish{Name: "nemo"}}
+
+	if _, err := d.WriteAll("", records); err == nil {
+		t.Error("WriteAll with no collection succeeded")
+	}
+
+	d.Close()
+	failed, err := d.WriteAll("fish", records)
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteAll after Close = %v, want ErrClosed", err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("failed = %v after Close, want none", failed)
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	for _, name := range reservedNames {
+		ops := map[string]error{
+			"Write":            d.Write(name, "nemo", fish{Name: "nemo"}),
+			"Write nested":     d.Write(name+"/fish", "nemo", fish{Name: "nemo"}),
+			"Write resource":   d.Write("fish", name, fish{Name: "nemo"}),
+			"Read":             d.Read(name, "nemo", &fish{}),
+			"Delete":           d.Delete(name, "nemo"),
+			"RenameCollection": d.RenameCollection("fish", name),
+		}
+		_, ops["ReadAll"] = d.ReadAll(name)
+		_, ops["ListResources"] = d.ListResources(name)
+		_, ops["WriteAll"] = d.WriteAll(name, map[string]interface{}{"nemo": fish{Name: "nemo"}})
+
+		for op, err := range ops {
+			if !errors.Is(err, ErrReservedName) {
+				t.Errorf("%s(%q) = %v, want ErrReservedName", op, name, err)
+			}
+		}
+	}
+
+	if got := rawRecord(t, d, "fish", "nemo"); !strings.Contains(got, "nemo") {
+		t.Errorf("fish/nemo = %s after the rejected operations", got)
+	}
+}
+
+func TestDotNamesRejected(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, tt := range []struct{ collection, resource string }{
+		{".hidden", "nemo"},
+		{"fish/.hidden", "nemo"},
+		{"fish", ".nemo"},
+	} {
+		err := d.Write(tt.collection, tt.resource, fish{Name: "nemo"})
+		if !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Write(%q, %q) = %v, want ErrInvalidName", tt.collection, tt.resource, err)
+		}
+	}
+}
+
+func TestEmptyRecord(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "dory.json"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Read("fish", "dory", &fish{}); !errors.Is(err, ErrEmptyRecord) {
+		t.Errorf("Read of an empty file = %v, want ErrEmptyRecord", err)
+	}
+	if _, err := d.ReadRaw("fish", "dory"); !errors.Is(err, ErrEmptyRecord) {
+		t.Errorf("ReadRaw of an empty file = %v, want ErrEmptyRecord", err)
+	}
+
+	// Listing readers skip the empty file rather than failing.
+	records, err := d.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"nemo"}) {
+		t.Errorf("ReadAll = %v, want [nemo]", got)
+	}
+}
+
+func TestEmptyAsMissing(t *testing.T) {
+	d := newTestDriver(t, &Options{EmptyAsMissing: true})
+	if err := os.MkdirAll(filepath.Join(d.dir, "fish"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "dory.json"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Read("fish", "dory", &fish{}); !os.IsNotExist(err) {
+		t.Errorf("Read of an empty file = %v, want a not-exist error", err)
+	}
+	if _, err := d.ReadRaw("fish", "dory"); !os.IsNotExist(err) {
+		t.Errorf("ReadRaw of an empty file = %v, want a not-exist error", err)
+	}
+}
+
+func TestRawBytesPassthrough(t *testing.T) {
+	d := newTestDriver(t, &Options{RawBytesPassthrough: true})
+
+	raw := `{"name":"nemo",   "age":1}`
+	mustWrite(t, d, "fish", "nemo", []byte(raw))
+	mustWrite(t, d, "fish", "dory", json.RawMessage(`{"name":"dory"}`))
+	mustWrite(t, d, "fish", "marlin", fish{Name: "marlin"})
+
+	// Stored exactly as given, without indenting or a trailing newline.
+	if got := rawRecord(t, d, "fish", "nemo"); got != raw {
+		t.Errorf("[]byte record = %q, want %q", got, raw)
+	}
+	if got := rawRecord(t, d, "fish", "dory"); got != `{"name":"dory"}` {
+		t.Errorf("json.RawMessage record = %q", got)
+	}
+	var f fish
+	if err := d.Read("fish", "nemo", &f); err != nil || f.Age != 1 {
+		t.Errorf("Read fish/nemo = %+v, %v", f, err)
+	}
+
+	// Other values are still marshaled.
+	if got := rawRecord(t, d, "fish", "marlin"); !strings.Contains(got, "\n") {
+		t.Errorf("fish/marlin = %q, want indented JSON", got)
+	}
+}
+
+func TestRawBytesPassthroughOff(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	mustWrite(t, d, "fish", "nemo", []byte(`{"name":"nemo"}`))
+
+	if got := rawRecord(t, d, "fish", "nemo"); !strings.HasPrefix(got, `"`) {
+		t.Errorf("[]byte without RawBytesPassthrough = %q, want a base64 JSON string", got)
+	}
+	var b []byte
+	if err := d.Read("fish", "nemo", &b); err != nil || string(b) != `{"name":"nemo"}` {
+		t.Errorf("Read = %q, %v", b, err)
+	}
+}
+
+func TestStrictDecode(t *testing.T) {
+	d := newTestDriver(t, &Options{StrictDecode: true})
+	mustWrite(t, d, "fish", "nemo", map[string]interface{}{"name": "nemo", "fins": 2})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	var f fish
+	if err := d.Read("fish", "nemo", &f); err == nil || !strings.Contains(err.Error(), "fins") {
+		t.Errorf("Read with an unknown field = %v, want an error naming it", err)
+	}
+	if err := d.Read("fish", "dory", &f); err != nil || f.Name != "dory" {
+		t.Errorf("Read of a matching record = %+v, %v", f, err)
+	}
+	if _, err := NewTypedDriver[fish](d, "fish").Get("nemo"); err == nil {
+		t.Error("typed Get with an unknown field succeeded")
+	}
+
+	// Maps take any field.
+	if m, err := d.ReadMap("fish", "nemo"); err != nil || m["fins"] != json.Number("2") {
+		t.Errorf("ReadMap = %v, %v", m, err)
+	}
+}
+
+func TestStrictDecodeOff(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", map[string]interface{}{"name": "nemo", "fins": 2})
+
+	var f fish
+	if err := d.Read("fish", "nemo", &f); err != nil || f.Name != "nemo" {
+		t.Errorf("Read with an unknown field = %+v, %v, want it ignored", f, err)
+	}
+}
+
+func TestStrictDecodeWithUnmarshalFunc(t *testing.T) {
+	_, err := New(t.TempDir(), &Options{StrictDecode: true, UnmarshalFunc: json.Unmarshal, Logger: discardLogger()})
+	if err == nil {
+		t.Error("New accepted StrictDecode with UnmarshalFunc")
+	}
+}
+
+func TestReadAllSkipsSubCollections(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish/reef", "marlin", fish{Name: "marlin"})
+	if err := os.MkdirAll(filepath.Join(d.dir, "fish", "dory.json"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Directories are left out, even one named like a record file.
+	records, err := d.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"nemo"}) {
+		t.Errorf("ReadAll = %v, want [nemo]", got)
+	}
+
+	records, err = d.ReadAll("fish/reef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"marlin"}) {
+		t.Errorf("ReadAll of the sub-collection = %v, want [marlin]", got)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StartMaintenance runs maintenance every interval in a background goroutine
+// until stop is called. Each run removes temp files left behind by
+// interrupted writes, compacts the log collections in Options.CompactLogs,
+// purges soft-deleted records older than Options.TrashRetention and drops
+// the history of records that no longer exist. Every step takes the locks
+// the regular operations use. Errors are logged, not returned. stop waits
+// for a run in progress to finish and may be called more than once.
+func (d *Driver) StartMaintenance(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		d.log.Warnf("Maintenance interval must be positive, got %v; not starting", interval)
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := d.maintain(); err != nil {
+					d.log.Warnf("Maintenance of %s: %v", d.dir, err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
+
+// maintain runs one round of the maintenance done by StartMaintenance.
+func (d *Driver) maintain() error {
+	var errs []error
+
+	if err := d.removeTempFiles(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := d.compactLogCollections(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if d.trashRetention > 0 {
+		if err := d.purgeTrashBefore(time.Now().Add(-d.trashRetention)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := d.pruneHistory(); err != nil {
+		errs = append(errs, err)
+	}
+
+	d.log.Debugf("Maintained %s", d.dir)
+	return errors.Join(errs...)
+}
+
+// tempFiles tracks the temp files of writes in progress in Options.TempDir.
+// A temp file there can't be traced back to its collection, so the
+// collection locks don't tell maintenance whether it is still in use.
+type tempFiles struct {
+	mutex  sync.Mutex
+	active map[string]bool
+}
+
+func (t *tempFiles) add(path string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.active == nil {
+		t.active = make(map[string]bool)
+	}
+	t.active[path] = true
+}
+
+func (t *tempFiles) done(path string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.active, path)
+}
+
+func (t *tempFiles) inUse(path string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.active[path]
+}
+
+// removeTempFiles deletes the temp files of interrupted writes from every
+// collection directory and from Options.TempDir. Each collection directory
+// is handled under its collection's write lock, so no write in progress
+// owns the files removed; in TempDir the files of writes in progress are
+// skipped.
+func (d *Driver) removeTempFiles() error {
+	for _, root := range d.roots() {
+		collections, err := collectionDirs(root)
+		if err != nil {
+			return err
+		}
+
+		for _, collection := range collections {
+			if err := d.removeTempFilesIn(root, collection); err != nil {
+				return err
+			}
+		}
+	}
+
+	if d.tempDir != "" {
+		return d.removeStagedTempFiles()
+	}
+
+	return nil
+}
+
+// removeStagedTempFiles deletes the temp files in Options.TempDir that no
+// write in progress owns.
+func (d *Driver) removeStagedTempFiles() error {
+	entries, err := os.ReadDir(d.tempDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(d.tempDir, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tmp") || d.temps.inUse(path) {
+			continue
+		}
+
+		if d.dryRun {
+			d.dryRunf("remove temp file %s", path)
+			continue
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		d.log.Debugf("Removed temp file %s", path)
+	}
+
+	return nil
+}
+
+// compactLogCollections runs CompactLog on every collection in
+// Options.CompactLogs that exists.
+func (d *Driver) compactLogCollections() error {
+	collections := make([]string, 0, len(d.compactLogs))
+	for collection := range d.compactLogs {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		err := d.CompactLog(collection, d.compactLogs[collection])
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) removeTempFilesIn(root, collection string) error {
+	unlock, err := d.acquire(d.collectionOf(collection), false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := os.ReadDir(filepath.Join(root, collection))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+
+		if d.dryRun {
+			d.dryRunf("remove temp file %s", filepath.Join(collection, entry.Name()))
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(root, collection, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		d.log.Debugf("Removed temp file %s", filepath.Join(collection, entry.Name()))
+	}
+
+	return nil
+}
+
+// pruneHistory drops the history of records that exist neither in their
+// collection nor in the trash.
+func (d *Driver) pruneHistory() error {
+	if d.singleFile {
+		return nil
+	}
+
+	base := filepath.Join(d.dir, historyDir)
+
+	var records []string
+	err := filepath.WalkDir(base, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == base {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path == base {
+			return nil
+		}
+
+		// Versions are stored as <collection>/<resource>/<n>.json.
+		rel, err := filepath.Rel(base, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 || records[len(records)-1] != rel {
+			records = append(records, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range records {
+		if err := d.pruneRecordHistory(rel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) pruneRecordHistory(rel string) error {
+	collection, resource := filepath.Dir(rel), filepath.Base(rel)
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if isFile(d.recordFile(collection, resource)) {
+		return nil
+	}
+	if _, src, _ := d.trashedRecord(collection, resource); src != "" {
+		return nil
+	}
+
+	if d.dryRun {
+		d.dryRunf("remove history of %s", rel)
+		return nil
+	}
+
+	if err := os.RemoveAll(filepath.Join(d.dir, historyDir, rel)); err != nil {
+		return err
+	}
+
+	d.log.Debugf("Removed history of deleted record %s", rel)
+	return nil
+}
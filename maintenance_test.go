@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintainRemovesTempFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	d := newTestDriver(t, &Options{TempDir: tempDir})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	stale := []string{
+		filepath.Join(d.dir, "fish", "nemo.json.tmp"),
+		filepath.Join(tempDir, "dory.json.123.tmp"),
+	}
+	inUse := filepath.Join(tempDir, "marlin.json.456.tmp")
+	for _, path := range append(stale, inUse) {
+		if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.temps.add(inUse)
+
+	if err := d.maintain(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range stale {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("temp file %s wasn't removed: %v", path, err)
+		}
+	}
+	if !isFile(inUse) {
+		t.Error("the temp file of a write in progress was removed")
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Errorf("maintenance broke a record: %v", err)
+	}
+}
+
+func TestMaintainPurgesOldTrash(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true, TrashRetention: time.Hour})
+	for _, name := range []string{"old", "new"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		if err := d.Delete("fish", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	long := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(d.dir, trashDir, "fish", "old.json"), long, long); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.maintain(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Restore("fish", "old"); err == nil {
+		t.Error("a record trashed before the retention period is still in the trash")
+	}
+	if err := d.Restore("fish", "new"); err != nil {
+		t.Errorf("a recently trashed record was purged: %v", err)
+	}
+}
+
+func TestMaintainKeepsTrashWithoutRetention(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	long := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(filepath.Join(d.dir, trashDir, "fish", "nemo.json"), long, long); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.maintain(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Restore("fish", "nemo"); err != nil {
+		t.Errorf("maintenance without TrashRetention purged the trash: %v", err)
+	}
+}
+
+func TestMaintainPrunesHistoryOfDeletedRecords(t *testing.T) {
+	d := newTestDriver(t, &Options{KeepHistory: 2})
+	for _, name := range []string{"nemo", "dory"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: 1})
+	}
+	if err := d.Delete("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.maintain(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(d.dir, historyDir, "fish", "dory")); !os.IsNotExist(err) {
+		t.Errorf("history of a deleted record wasn't pruned: %v", err)
+	}
+	if history, err := d.History("fish", "nemo"); err != nil || len(history) != 1 {
+		t.Errorf("history of a live record = %v, %v", history, err)
+	}
+}
+
+func TestMaintainCompactsLogs(t *testing.T) {
+	byName := func(b []byte) string {
+		var f fish
+		json.Unmarshal(b, &f)
+		return f.Name
+	}
+	d := newTestDriver(t, &Options{CompactLogs: map[string]func([]byte) string{"events": byName, "missing": byName}})
+	for age, name := range []string{"nemo", "dory", "nemo"} {
+		if _, err := d.Append("events", fish{Name: name, Age: age}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.maintain(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAllOrdered("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("log after compaction = %v, want 2 records", records)
+	}
+}
+
+func TestStartMaintenance(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	tmp := filepath.Join(d.dir, "fish", "dory.json.tmp")
+	if err := os.WriteFile(tmp, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := d.StartMaintenance(time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for isFile(tmp) {
+		if time.Now().After(deadline) {
+			t.Fatal("maintenance didn't remove the temp file")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stop()
+	stop()
+}
+
+func TestStartMaintenanceInvalidInterval(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	stop := d.StartMaintenance(0)
+	stop()
+}
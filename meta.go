@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metaExt is the extension of the metadata sidecar stored next to a record
+// as <resource>.meta.json. ReadAll and ListResources don't treat it as a
+// record, so resource names can't end in ".meta".
+const metaExt = ".meta.json"
+
+// SetRecordMeta attaches metadata, such as tags or an owner, to an existing
+// record without changing the record itself. It replaces any metadata set
+// before; empty metadata removes it. Delete removes the metadata together
+// with the record. Not available in single-file mode.
+func (d *Driver) SetRecordMeta(collection, resource string, meta map[string]string) (err error) {
+	defer wrapOp("SetRecordMeta", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	if d.singleFile {
+		return fmt.Errorf("record metadata isn't supported with SingleFilePerCollection")
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	record := d.recordFile(collection, resource)
+	if !isFile(record) {
+		return fmt.Errorf("record %s/%s: %w", collection, resource, ErrNotFound)
+	}
+
+	if d.dryRun {
+		d.dryRunf("set metadata of %s/%s", collection, resource)
+		return nil
+	}
+
+	path := metaPath(record)
+
+	if len(meta) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	b, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeFileAtomic(path, append(b, byte('\n'))); err != nil {
+		return err
+	}
+
+	d.log.Debugf("Successfully set metadata of %s/%s", collection, resource)
+	return nil
+}
+
+// GetRecordMeta returns the metadata attached to a record with
+// SetRecordMeta, empty if there is none.
+func (d *Driver) GetRecordMeta(collection, resource string) (_ map[string]string, err error) {
+	defer wrapOp("GetRecordMeta", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read metadata!")
+	}
+
+	if resource == "" {
+		return nil, fmt.Errorf("Missing resource - unable to read metadata (no name)!")
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta := make(map[string]string)
+	if d.singleFile {
+		return meta, nil
+	}
+
+	record := d.recordFile(collection, resource)
+	if !isFile(record) {
+		return nil, fmt.Errorf("record %s/%s: %w", collection, resource, ErrNotFound)
+	}
+
+	b, err := os.ReadFile(metaPath(record))
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("metadata of %s/%s: %v: %w", collection, resource, err, ErrCorruptRecord)
+	}
+
+	return meta, nil
+}
+
+// metaPath returns the sidecar holding the metadata of the record stored in
+// the file record.
+func metaPath(record string) string {
+	return strings.TrimSuffix(record, ".json") + metaExt
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRecordMeta(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	before := rawRecord(t, d, "fish", "nemo")
+
+	if meta, err := d.GetRecordMeta("fish", "nemo"); err != nil || len(meta) != 0 {
+		t.Errorf("GetRecordMeta without metadata = %v, %v, want empty", meta, err)
+	}
+
+	tags := map[string]string{"owner": "marlin", "reef": "great barrier"}
+	if err := d.SetRecordMeta("fish", "nemo", tags); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := d.GetRecordMeta("fish", "nemo"); err != nil || !maps.Equal(meta, tags) {
+		t.Errorf("GetRecordMeta = %v, %v, want %v", meta, err, tags)
+	}
+	if got := rawRecord(t, d, "fish", "nemo"); got != before {
+		t.Errorf("SetRecordMeta changed the record to %s", got)
+	}
+
+	// The sidecar isn't a record.
+	if resources, _ := d.ListResources("fish"); !slices.Equal(resources, []string{"nemo"}) {
+		t.Errorf("ListResources = %v, want [nemo]", resources)
+	}
+	if records, _ := d.ReadAll("fish"); len(records) != 1 {
+		t.Errorf("ReadAll returned %d records, want 1", len(records))
+	}
+
+	// New metadata replaces the old, and empty metadata removes it.
+	if err := d.SetRecordMeta("fish", "nemo", map[string]string{"owner": "dory"}); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := d.GetRecordMeta("fish", "nemo"); !maps.Equal(meta, map[string]string{"owner": "dory"}) {
+		t.Errorf("GetRecordMeta after replacing = %v", meta)
+	}
+	if err := d.SetRecordMeta("fish", "nemo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "fish", "nemo"+metaExt)); !os.IsNotExist(err) {
+		t.Errorf("sidecar left after clearing the metadata: %v", err)
+	}
+}
+
+func TestRecordMetaFollowsRecord(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	tags := map[string]string{"owner": "marlin"}
+	if err := d.SetRecordMeta("fish", "nemo", tags); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "fish", "nemo"+metaExt)); !os.IsNotExist(err) {
+		t.Errorf("sidecar left after Delete: %v", err)
+	}
+
+	if err := d.Restore("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := d.GetRecordMeta("fish", "nemo"); err != nil || !maps.Equal(meta, tags) {
+		t.Errorf("GetRecordMeta after Restore = %v, %v, want %v", meta, err, tags)
+	}
+}
+
+func TestRecordMetaErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.SetRecordMeta("fish", "nemo", map[string]string{"owner": "marlin"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetRecordMeta of a missing record = %v, want ErrNotFound", err)
+	}
+	if _, err := d.GetRecordMeta("fish", "nemo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRecordMeta of a missing record = %v, want ErrNotFound", err)
+	}
+	if err := d.Write("fish", "nemo.meta", fish{Name: "nemo"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write of a resource ending in .meta = %v, want ErrInvalidName", err)
+	}
+
+	single := newTestDriver(t, &Options{SingleFilePerCollection: true})
+	mustWrite(t, single, "fish", "nemo", fish{Name: "nemo"})
+	if err := single.SetRecordMeta("fish", "nemo", map[string]string{"owner": "marlin"}); err == nil {
+		t.Error("SetRecordMeta succeeded in single-file mode")
+	}
+}
+
+func TestRebalanceMovesRecordMeta(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	a, b := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	d := openTestDriver(t, dir, &Options{DataDirs: []string{a}})
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		if err := d.SetRecordMeta("fish", name, map[string]string{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	d = openTestDriver(t, dir, &Options{DataDirs: []string{a, b}})
+	if _, err := d.Rebalance(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		if meta, err := d.GetRecordMeta("fish", name); err != nil || meta["name"] != name {
+			t.Errorf("GetRecordMeta %s after Rebalance = %v, %v", name, meta, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// namesFile maps the resources of a collection to the file names
+// Options.NameFunc gave them. It lives in the collection directory and has
+// no .json extension, so it is never mistaken for a record.
+const namesFile = ".names"
+
+// nameCache holds the decoded namesFile of each collection, so looking up
+// the file name of a record doesn't read the file every time. writeNames
+// replaces an entry; operations moving or removing whole collections, and
+// so their namesFile, drop theirs.
+type nameCache struct {
+	mutex sync.Mutex
+	of    map[string]map[string]string
+}
+
+func (c *nameCache) get(collection string) (map[string]string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	names, ok := c.of[collection]
+	return names, ok
+}
+
+func (c *nameCache) set(collection string, names map[string]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.of == nil {
+		c.of = make(map[string]map[string]string)
+	}
+	c.of[collection] = names
+}
+
+// forget drops a collection and the collections nested in it.
+func (c *nameCache) forget(collection string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for name := range c.of {
+		if name == collection || strings.HasPrefix(name, collection+string(filepath.Separator)) {
+			delete(c.of, name)
+		}
+	}
+}
+
+// readNames returns the resource to file name mapping of a collection, empty
+// if NameFunc isn't set or named none of its records. The mapping is shared
+// with the cache: callers changing it must change a copy. The caller must
+// hold the collection mutex.
+func (d *Driver) readNames(collection string) (map[string]string, error) {
+	if d.nameFunc == nil {
+		return map[string]string{}, nil
+	}
+
+	if names, ok := d.names.get(collection); ok {
+		return names, nil
+	}
+
+	names := make(map[string]string)
+
+	b, err := os.ReadFile(filepath.Join(d.dir, collection, namesFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(b, &names); err != nil {
+			return nil, fmt.Errorf("%s/%s: %v: %w", collection, namesFile, err, ErrCorruptRecord)
+		}
+	}
+
+	d.names.set(collection, names)
+	return names, nil
+}
+
+func (d *Driver) writeNames(collection string, names map[string]string) error {
+	b, err := json.MarshalIndent(names, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeFileAtomic(filepath.Join(d.dir, collection, namesFile), append(b, byte('\n'))); err != nil {
+		d.names.forget(collection)
+		return err
+	}
+
+	d.names.set(collection, names)
+	return nil
+}
+
+// storedName returns the file name, without extension, a resource is stored
+// under: the one NameFunc gave it, or the resource itself.
+func (d *Driver) storedName(collection, resource string) string {
+	if d.nameFunc == nil {
+		return resource
+	}
+
+	names, err := d.readNames(collection)
+	if err != nil {
+		d.log.Warnf("Reading file names of %s: %v", collection, err)
+		return resource
+	}
+
+	if name, ok := names[resource]; ok {
+		return name
+	}
+	return resource
+}
+
+// assignName asks NameFunc for the file name of a resource written for the
+// first time and records it. Later writes keep the name, so NameFunc may
+// embed things like the creation time. The caller must hold the collection
+// write lock.
+func (d *Driver) assignName(collection, resource string) error {
+	if d.nameFunc == nil {
+		return nil
+	}
+
+	names, err := d.readNames(collection)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := names[resource]; ok {
+		return nil
+	}
+
+	// A record written before NameFunc was set keeps its resource name,
+	// unless that file name was since given to another resource.
+	if isFile(filepath.Join(d.dir, collection, resource+".json")) && !slices.Contains(slices.Collect(maps.Values(names)), resource) {
+		return nil
+	}
+
+	name, err := d.callNameFunc(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	name = strings.TrimSuffix(name, ".json")
+	if err := checkName(name); err != nil {
+		return fmt.Errorf("file name for %s/%s: %w", collection, resource, err)
+	}
+
+	for other, taken := range names {
+		if taken == name {
+			return fmt.Errorf("file name %s for %s/%s is already used by %s: %w", name, collection, resource, other, ErrAlreadyExists)
+		}
+	}
+
+	if name != resource && isFile(filepath.Join(d.dir, collection, name+".json")) {
+		return fmt.Errorf("file name %s for %s/%s is already used: %w", name, collection, resource, ErrAlreadyExists)
+	}
+
+	if err := os.MkdirAll(filepath.Join(d.dir, collection), 0755); err != nil {
+		return err
+	}
+
+	names = maps.Clone(names)
+	names[resource] = name
+	return d.writeNames(collection, names)
+}
+
+func (d *Driver) callNameFunc(collection, resource string) (name string, err error) {
+	defer recoverHook("NameFunc", &err)
+	return d.nameFunc(collection, resource), nil
+}
+
+// forgetName drops the file name of a deleted resource. The caller must hold
+// the collection write lock.
+func (d *Driver) forgetName(collection, resource string) error {
+	names, err := d.readNames(collection)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := names[resource]; !ok {
+		return nil
+	}
+
+	names = maps.Clone(names)
+	delete(names, resource)
+	return d.writeNames(collection, names)
+}
+
+// resourceNames maps file names found in a collection directory back to
+// the resources they hold.
+func (d *Driver) resourceNames(collection string, files []string) ([]string, error) {
+	names, err := d.readNames(collection)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return files, nil
+	}
+
+	resources := make(map[string]string, len(names))
+	for resource, name := range names {
+		resources[name] = resource
+	}
+
+	for i, file := range files {
+		if resource, ok := resources[file]; ok {
+			files[i] = resource
+		}
+	}
+
+	return files, nil
+}
+
+// checkName rejects file names from NameFunc that would leave the collection
+// directory or clash with the driver's own files.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, ".") ||
+		strings.ContainsAny(name, `/\`) || internalFile(name) || internalFile(name+".json") {
+		return fmt.Errorf("%q: %w", name, ErrInvalidName)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// numbered returns a NameFunc prefixing resources with a counter, so every
+// call gives a new name.
+func numbered() func(collection, resource string) string {
+	n := 0
+	return func(collection, resource string) string {
+		n++
+		return fmt.Sprintf("%03d-%s", n, resource)
+	}
+}
+
+func TestNameFunc(t *testing.T) {
+	d := newTestDriver(t, &Options{NameFunc: numbered()})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	if !isFile(filepath.Join(d.dir, "fish", "001-nemo.json")) {
+		t.Error("fish/nemo isn't stored as 001-nemo.json")
+	}
+
+	// Later writes keep the name NameFunc gave the record.
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+	if isFile(filepath.Join(d.dir, "fish", "003-nemo.json")) {
+		t.Error("rewriting fish/nemo gave it a new name")
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read fish/nemo = %+v, %v", got, err)
+	}
+	resources, err := d.ListResources("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Listings follow the file names, so a NameFunc can order them.
+	if want := []string{"nemo", "dory"}; !slices.Equal(resources, want) {
+		t.Errorf("ListResources = %v, want %v", resources, want)
+	}
+
+	// A deleted record is named again when it comes back.
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if isFile(filepath.Join(d.dir, "fish", "001-nemo.json")) {
+		t.Error("Delete left 001-nemo.json behind")
+	}
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if !isFile(filepath.Join(d.dir, "fish", "003-nemo.json")) {
+		t.Error("fish/nemo isn't stored as 003-nemo.json after being deleted")
+	}
+}
+
+func TestNameFuncKeepsExistingRecords(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	mustWrite(t, openTestDriver(t, dir, nil), "fish", "nemo", fish{Name: "nemo"})
+
+	d := openTestDriver(t, dir, &Options{NameFunc: numbered()})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	if !isFile(filepath.Join(d.dir, "fish", "nemo.json")) || isFile(filepath.Join(d.dir, "fish", "001-nemo.json")) {
+		t.Error("record written before NameFunc was set was renamed")
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read fish/nemo = %+v, %v", got, err)
+	}
+}
+
+func TestNameFuncInvalidNames(t *testing.T) {
+	for _, name := range []string{"", ".hidden", "../escape", "a/b", namesFile} {
+		d := newTestDriver(t, &Options{NameFunc: func(collection, resource string) string { return name }})
+		if err := d.Write("fish", "nemo", fish{Name: "nemo"}); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Write with file name %q = %v, want ErrInvalidName", name, err)
+		}
+	}
+
+	d := newTestDriver(t, &Options{NameFunc: func(collection, resource string) string { return "same" }})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.Write("fish", "dory", fish{Name: "dory"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Write reusing a file name = %v, want ErrAlreadyExists", err)
+	}
+}
+
+func TestNameFuncOptions(t *testing.T) {
+	_, err := New(t.TempDir(), &Options{NameFunc: numbered(), SoftDelete: true, Logger: discardLogger()})
+	if err == nil {
+		t.Error("New accepted NameFunc with SoftDelete")
+	}
+}
+
+func TestNameFuncCollectionMoves(t *testing.T) {
+	d := newTestDriver(t, &Options{NameFunc: numbered()})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	// The names of a renamed collection go with it: nothing of the old
+	// collection is remembered for a new one of the same name.
+	if err := d.RenameCollection("fish", "reef"); err != nil {
+		t.Fatal(err)
+	}
+	var got fish
+	if err := d.Read("reef", "nemo", &got); err != nil {
+		t.Errorf("Read reef/nemo after rename: %v", err)
+	}
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if !isFile(filepath.Join(d.dir, "fish", "002-nemo.json")) {
+		t.Error("new fish/nemo reused the name of the renamed record")
+	}
+
+	if err := d.ArchiveCollection("fish"); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	if resources, _ := d.ListResources("fish"); !slices.Equal(resources, []string{"dory"}) {
+		t.Errorf("fish after archiving = %v, want [dory]", resources)
+	}
+	if err := d.Delete("fish", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UnarchiveCollection("fish"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Errorf("Read fish/nemo after unarchiving: %v", err)
+	}
+
+	if err := d.ReplaceCollection("reef", map[string]interface{}{"marlin": fish{Name: "marlin"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("reef", "marlin", &got); err != nil || got.Name != "marlin" {
+		t.Errorf("Read reef/marlin after replacing = %+v, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "reef", "001-nemo.json")); !os.IsNotExist(err) {
+		t.Errorf("replaced record is still on disk: %v", err)
+	}
+}
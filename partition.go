@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partitionCache remembers which partition of a collection each record was
+// last seen in, so lookups don't have to scan the partition directories.
+type partitionCache struct {
+	mutex sync.Mutex
+	of    map[string]map[string]string
+}
+
+func (c *partitionCache) get(collection, resource string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	p, ok := c.of[collection][resource]
+	return p, ok
+}
+
+func (c *partitionCache) set(collection, resource, partition string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.of == nil {
+		c.of = make(map[string]map[string]string)
+	}
+	if c.of[collection] == nil {
+		c.of[collection] = make(map[string]string)
+	}
+	c.of[collection][resource] = partition
+}
+
+func (c *partitionCache) forget(collection, resource string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if resource == "" {
+		delete(c.of, collection)
+		return
+	}
+	delete(c.of[collection], resource)
+}
+
+// partitioned reports whether records of collection are stored by partition.
+func (d *Driver) partitioned(collection string) bool {
+	return d.partitionBy[collection] != nil
+}
+
+// recordDir returns the directory, relative to a data directory root, that
+// holds a record: the collection, or the record's partition of it.
+func (d *Driver) recordDir(collection, resource string) string {
+	if p := d.partitionOf(collection, resource); p != "" {
+		return filepath.Join(collection, p)
+	}
+
+	return collection
+}
+
+// collectionOf returns the collection a directory, relative to a data
+// directory root, holds records of: the parent of a partition directory,
+// the directory itself otherwise.
+func (d *Driver) collectionOf(dir string) string {
+	if parent := filepath.Dir(dir); parent != "." && d.partitioned(parent) {
+		return parent
+	}
+
+	return dir
+}
+
+// partitionOf returns the partition a record of a partitioned collection is
+// stored in, or "" if it isn't stored in one.
+func (d *Driver) partitionOf(collection, resource string) string {
+	if !d.partitioned(collection) {
+		return ""
+	}
+
+	if p, ok := d.partitions.get(collection, resource); ok {
+		return p
+	}
+
+	for _, root := range d.roots() {
+		for _, p := range d.partitionDirs(root, collection) {
+			if isFile(filepath.Join(root, collection, p, resource+".json")) {
+				d.partitions.set(collection, resource, p)
+				return p
+			}
+		}
+	}
+
+	return ""
+}
+
+// partitionDirs returns the partitions of a collection in one data
+// directory.
+func (d *Driver) partitionDirs(root, collection string) []string {
+	entries, err := os.ReadDir(filepath.Join(root, collection))
+	if err != nil {
+		return nil
+	}
+
+	var partitions []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			partitions = append(partitions, entry.Name())
+		}
+	}
+
+	return partitions
+}
+
+// checkPartition validates a partition name returned by a PartitionBy
+// function. Partitions are single directory names.
+func checkPartition(collection, partition string) error {
+	if partition != filepath.Base(partition) || strings.HasPrefix(partition, ".") || strings.ContainsAny(partition, `/\`) {
+		return fmt.Errorf("partition %q of %s: %w", partition, collection, ErrInvalidName)
+	}
+
+	return nil
+}
+
+func (d *Driver) callPartitionBy(collection string, v interface{}) (partition string, err error) {
+	defer recoverHook("PartitionBy", &err)
+	return d.partitionBy[collection](v), nil
+}
+
+// partitionFor returns the partition PartitionBy stores v in.
+func (d *Driver) partitionFor(collection string, v interface{}) (string, error) {
+	partition, err := d.callPartitionBy(collection, v)
+	if err != nil {
+		return "", err
+	}
+
+	if partition != "" {
+		if err := checkPartition(collection, partition); err != nil {
+			return "", err
+		}
+	}
+
+	return partition, nil
+}
+
+// writeValue is writeLocked for the content r of the value v passed to
+// Write, storing a record of a partitioned collection in the partition of
+// v. The caller must hold the collection mutex.
+func (d *Driver) writeValue(collection, resource string, v interface{}, r io.Reader, deadline time.Time) error {
+	if !d.partitioned(collection) {
+		return d.writeLocked(collection, resource, r, deadline)
+	}
+
+	partition, err := d.partitionFor(collection, v)
+	if err != nil {
+		return err
+	}
+
+	return d.writeIntoPartition(collection, resource, partition, r, deadline)
+}
+
+// writePartitioned is Write for a record of a partitioned collection. A
+// record whose partition changed is moved out of the old one.
+func (d *Driver) writePartitioned(collection, resource string, v interface{}, b []byte) error {
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	partition, err := d.partitionFor(collection, v)
+	if err != nil {
+		return err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquireRecord(collection, resource, deadline)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err := d.resolve(collection, resource, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	return d.writeIntoPartition(collection, resource, partition, r, deadline)
+}
+
+// writeIntoPartition is writeLocked for a record of a partitioned
+// collection, storing it in partition and removing it from the one it was
+// in before. The caller must hold the collection mutex.
+func (d *Driver) writeIntoPartition(collection, resource, partition string, r io.Reader, deadline time.Time) error {
+	r, err := d.limitRecord(collection, resource, r)
+	if err != nil {
+		return err
+	}
+
+	old := d.recordFile(collection, resource)
+
+	// writeLocked keeps the version it replaces in history, but only looks
+	// for it where the record will be. A record changing partitions is
+	// stashed from where it is now.
+	if d.partitionOf(collection, resource) != partition && !d.dryRun {
+		if err := d.stashHistory(collection, resource); err != nil {
+			return err
+		}
+		d.uncache(collection, resource)
+	}
+
+	// The cache has to point at the new partition for the write to land
+	// there. If nothing was written, it's dropped again so the next lookup
+	// finds the record where it really is.
+	d.partitions.set(collection, resource, partition)
+	if err := d.writeLocked(collection, resource, r, deadline); err != nil {
+		d.partitions.forget(collection, resource)
+		return err
+	}
+
+	if d.dryRun {
+		d.partitions.forget(collection, resource)
+		return nil
+	}
+
+	if old != d.recordFile(collection, resource) {
+		if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partitionResources is ListResources for a partitioned collection: records
+// stored in the collection itself or in any of its partitions.
+func (d *Driver) partitionResources(collection string) ([]string, error) {
+	var (
+		resources []string
+		seen      = make(map[string]bool)
+		found     = false
+		lastErr   error
+	)
+
+	for _, root := range d.roots() {
+		dirs := []string{collection}
+		for _, p := range d.partitionDirs(root, collection) {
+			dirs = append(dirs, filepath.Join(collection, p))
+		}
+
+		for _, dir := range dirs {
+			files, err := os.ReadDir(filepath.Join(root, dir))
+			if os.IsNotExist(err) {
+				lastErr = err
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			found = true
+
+			for _, file := range files {
+				if resource, ok := d.recordName(file); ok && !seen[resource] {
+					seen[resource] = true
+					resources = append(resources, resource)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, lastErr
+	}
+
+	return resources, nil
+}
+
+// ReadAllPartition returns the records stored in one partition of a
+// partitioned collection.
+func (d *Driver) ReadAllPartition(collection, partition string) (_ []string, err error) {
+	defer wrapOp("ReadAllPartition", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if !d.partitioned(collection) {
+		return nil, fmt.Errorf("collection %s is not partitioned", collection)
+	}
+
+	if err := checkPartition(collection, partition); err != nil {
+		return nil, err
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var (
+		records []string
+		found   = false
+		lastErr error
+	)
+
+	dir := filepath.Join(collection, partition)
+	for _, root := range d.roots() {
+		files, err := os.ReadDir(filepath.Join(root, dir))
+		if os.IsNotExist(err) {
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+
+		for _, file := range files {
+			resource, ok := d.recordName(file)
+			if !ok {
+				continue
+			}
+
+			b, err := os.ReadFile(filepath.Join(root, dir, file.Name()))
+			if err == nil && len(b) == 0 {
+				err = d.emptyRecord(collection, resource, filepath.Join(root, dir, file.Name()))
+			}
+			if err == nil {
+				b, err = d.decodeFile(file.Name(), b)
+			}
+			if err == nil {
+				err = d.checkJSON(collection, resource, b)
+			}
+			if noContent(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, string(b))
+		}
+	}
+
+	if !found {
+		return nil, lastErr
+	}
+
+	d.log.Debugf("Successfully read all records from %s", dir)
+	return records, nil
+}
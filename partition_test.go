@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// byAge partitions fish by age, leaving fish without one in the collection
+// itself.
+func byAge(v interface{}) string {
+	f, ok := v.(fish)
+	if !ok || f.Age == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("age-%d", f.Age)
+}
+
+func newPartitionedDriver(t *testing.T, opts Options) *Driver {
+	t.Helper()
+
+	opts.PartitionBy = map[string]func(v interface{}) string{"fish": byAge}
+	return newTestDriver(t, &opts)
+}
+
+func TestPartitionBy(t *testing.T) {
+	d := newPartitionedDriver(t, Options{})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory", Age: 2})
+	mustWrite(t, d, "fish", "marlin", fish{Name: "marlin"})
+
+	for _, path := range []string{"fish/age-1/nemo.json", "fish/age-2/dory.json", "fish/marlin.json"} {
+		if !isFile(filepath.Join(d.dir, path)) {
+			t.Errorf("%s wasn't written", path)
+		}
+	}
+
+	var got fish
+	if err := d.Read("fish", "dory", &got); err != nil || got.Name != "dory" {
+		t.Errorf("Read of a partitioned record = %+v, %v", got, err)
+	}
+
+	names, err := d.ListResources("fish")
+	slices.Sort(names)
+	if err != nil || !slices.Equal(names, []string{"dory", "marlin", "nemo"}) {
+		t.Errorf("ListResources = %v, %v", names, err)
+	}
+
+	records, err := d.ReadAllPartition("fish", "age-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"nemo"}) {
+		t.Errorf("ReadAllPartition = %v, want [nemo]", got)
+	}
+
+	if err := d.Delete("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "dory", &got); !os.IsNotExist(err) {
+		t.Errorf("Read after Delete = %v, want not exist", err)
+	}
+}
+
+func TestPartitionByMovesRecords(t *testing.T) {
+	d := newPartitionedDriver(t, Options{})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	if isFile(filepath.Join(d.dir, "fish", "age-1", "nemo.json")) {
+		t.Error("the record was left in its old partition")
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read after moving partitions = %+v, %v", got, err)
+	}
+
+	// A reopened driver finds records without the partition cache.
+	reopened := openTestDriver(t, d.dir, &Options{PartitionBy: map[string]func(v interface{}) string{"fish": byAge}})
+	if err := reopened.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("Read from a new driver = %+v, %v", got, err)
+	}
+}
+
+func TestPartitionByFailedWrite(t *testing.T) {
+	d := newPartitionedDriver(t, Options{})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+
+	// A file where the new partition's directory should go fails the write.
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "age-2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Write("fish", "nemo", fish{Name: "nemo", Age: 2}); err == nil {
+		t.Fatal("Write into a blocked partition succeeded")
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 1 {
+		t.Errorf("Read after the failed write = %+v, %v, want the original record", got, err)
+	}
+}
+
+func TestPartitionByDryRun(t *testing.T) {
+	d := newPartitionedDriver(t, Options{})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+
+	dry := openTestDriver(t, d.dir, &Options{DryRun: true, PartitionBy: map[string]func(v interface{}) string{"fish": byAge}})
+	if err := dry.Write("fish", "nemo", fish{Name: "nemo", Age: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := dry.Read("fish", "nemo", &got); err != nil || got.Age != 1 {
+		t.Errorf("Read after a dry-run write = %+v, %v, want the original record", got, err)
+	}
+}
+
+func TestPartitionByInvalidPartition(t *testing.T) {
+	d := newTestDriver(t, &Options{PartitionBy: map[string]func(v interface{}) string{
+		"fish": func(v interface{}) string { return "../escape" },
+	}})
+
+	if err := d.Write("fish", "nemo", fish{Name: "nemo"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write into an invalid partition = %v, want ErrInvalidName", err)
+	}
+	if _, err := d.ReadAllPartition("fish", ".hidden"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("ReadAllPartition of an invalid partition = %v, want ErrInvalidName", err)
+	}
+	if _, err := d.ReadAllPartition("sharks", "x"); err == nil {
+		t.Error("ReadAllPartition of an unpartitioned collection succeeded")
+	}
+}
+
+func TestPartitionByRestore(t *testing.T) {
+	d := newPartitionedDriver(t, Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Restore("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(d.dir, "fish", "age-1", "nemo.json")) {
+		t.Error("Restore didn't put the record back in its partition")
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 1 {
+		t.Errorf("Read after Restore = %+v, %v", got, err)
+	}
+}
+
+func TestPartitionByTypedDriver(t *testing.T) {
+	d := newPartitionedDriver(t, Options{})
+
+	if err := NewTypedDriver[fish](d, "fish").Put("nemo", fish{Name: "nemo", Age: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(d.dir, "fish", "age-3", "nemo.json")) {
+		t.Error("TypedDriver.Put ignored PartitionBy")
+	}
+}
+
+func TestPartitionByMaintenance(t *testing.T) {
+	d := newPartitionedDriver(t, Options{})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	tmp := filepath.Join(d.dir, "fish", "age-1", "dory.json.tmp")
+	if err := os.WriteFile(tmp, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.TempFiles, []string{tmp}) {
+		t.Errorf("Fsck temp files = %v, want %s", report.TempFiles, tmp)
+	}
+
+	if err := d.maintain(); err != nil {
+		t.Fatal(err)
+	}
+	if isFile(tmp) {
+		t.Error("maintenance left a temp file in a partition")
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// MapReduce decodes every record of a collection into T, maps it with mapFn
+// and folds the results into init with reduceFn.
+func MapReduce[T any, R any](d *Driver, collection string, mapFn func(T) R, reduceFn func(acc, r R) R, init R) (_ R, err error) {
+	defer wrapOp("MapReduce", collection, "", &err)
+
+	records, err := d.ReadAll(collection)
+	if err != nil {
+		return init, err
+	}
+
+	acc := init
+	for _, record := range records {
+		var v T
+		if err := d.unmarshal([]byte(record), &v); err != nil {
+			return init, err
+		}
+		acc = reduceFn(acc, mapFn(v))
+	}
+
+	return acc, nil
+}
+
+// ReadAllTypedMap decodes every record of a collection into a T, keyed by
+// resource name. A record that doesn't decode fails the call with an error
+// naming it.
+func ReadAllTypedMap[T any](d *Driver, collection string) (_ map[string]T, err error) {
+	defer wrapOp("ReadAllTypedMap", collection, "", &err)
+
+	records, err := d.ReadAllMap(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]T, len(records))
+	for resource, record := range records {
+		var v T
+		if err := d.unmarshal([]byte(record), &v); err != nil {
+			return nil, fmt.Errorf("decoding %s/%s: %w", collection, resource, err)
+		}
+		out[resource] = v
+	}
+
+	return out, nil
+}
+
+// DeleteWhere deletes every record of a collection that decodes into a T
+// matching pred and returns how many were deleted. The collection stays
+// locked for the whole scan, so writers can't slip in between the check and
+// the delete.
+func DeleteWhere[T any](d *Driver, collection string, pred func(T) bool) (_ int, err error) {
+	defer wrapOp("DeleteWhere", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if err := d.checkPath(collection); err != nil {
+		return 0, err
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, resource := range resources {
+		b, err := d.readRecord(collection, resource)
+		if noContent(err) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		var v T
+		if err := d.unmarshal(b, &v); err != nil {
+			return deleted, err
+		}
+
+		if !pred(v) {
+			continue
+		}
+
+		if err := d.delete(collection, resource); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	d.log.Debugf("Deleted %d records from %s", deleted, collection)
+	return deleted, nil
+}
+
+// CountWhere returns how many records of a collection decode into a T
+// matching pred. Records are decoded one at a time, so memory use doesn't
+// grow with the collection.
+func CountWhere[T any](d *Driver, collection string, pred func(T) bool) (_ int, err error) {
+	defer wrapOp("CountWhere", collection, "", &err)
+
+	count := 0
+	err = d.eachRecord(collection, func(resource string, b []byte) (bool, error) {
+		var v T
+		if err := d.unmarshal(b, &v); err != nil {
+			return false, err
+		}
+
+		if pred(v) {
+			count++
+		}
+		return true, nil
+	})
+
+	return count, err
+}
+
+// FindOne returns the first record of a collection, in resource order, that
+// decodes into a T matching pred. The scan stops at the first match; found
+// is false if no record matches.
+func FindOne[T any](d *Driver, collection string, pred func(T) bool) (match T, found bool, err error) {
+	defer wrapOp("FindOne", collection, "", &err)
+
+	err = d.eachRecord(collection, func(resource string, b []byte) (bool, error) {
+		var v T
+		if err := d.unmarshal(b, &v); err != nil {
+			return false, err
+		}
+
+		if pred(v) {
+			match, found = v, true
+			return false, nil
+		}
+		return true, nil
+	})
+
+	return match, found, err
+}
+
+// QueryOptions selects and orders the records returned by QueryPage.
+type QueryOptions[T any] struct {
+	// Filter keeps the records it returns true for. Nil keeps all.
+	Filter func(T) bool
+
+	// Less orders the records. Records it considers equal, and all records
+	// when it is nil, are ordered by resource name.
+	Less func(a, b T) bool
+
+	// PageSize is the most records a page holds. Zero or less returns all
+	// remaining records in one page.
+	PageSize int
+
+	// Cursor is the next-page cursor returned by the previous call, or
+	// empty for the first page.
+	Cursor string
+}
+
+// queryCursor is what a QueryPage cursor encodes: the last record of the
+// page. The next page starts after it in sort order, so records added or
+// removed between calls don't shift the pages.
+type queryCursor struct {
+	Resource string `json:"r"`
+	Value    []byte `json:"v"`
+}
+
+// QueryPage returns one page of the records of a collection that decode
+// into a T matching opts.Filter, in opts.Less order, and the cursor of the
+// next page, which is empty after the last page. Every call scans the
+// whole collection.
+func QueryPage[T any](d *Driver, collection string, opts QueryOptions[T]) (_ []T, _ string, err error) {
+	defer wrapOp("QueryPage", collection, "", &err)
+
+	type match struct {
+		resource string
+		value    T
+		raw      []byte
+	}
+
+	var matches []match
+	err = d.eachRecord(collection, func(resource string, b []byte) (bool, error) {
+		var v T
+		if err := d.unmarshal(b, &v); err != nil {
+			return false, fmt.Errorf("decoding %s/%s: %w", collection, resource, err)
+		}
+
+		if opts.Filter == nil || opts.Filter(v) {
+			matches = append(matches, match{resource, v, b})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	before := func(aResource string, a T, bResource string, b T) bool {
+		if opts.Less != nil {
+			if opts.Less(a, b) {
+				return true
+			}
+			if opts.Less(b, a) {
+				return false
+			}
+		}
+		return aResource < bResource
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return before(matches[i].resource, matches[i].value, matches[j].resource, matches[j].value)
+	})
+
+	start := 0
+	if opts.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+
+		var cursor queryCursor
+		if err := json.Unmarshal(b, &cursor); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+
+		var last T
+		if err := d.unmarshal(cursor.Value, &last); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+
+		start = sort.Search(len(matches), func(i int) bool {
+			return before(cursor.Resource, last, matches[i].resource, matches[i].value)
+		})
+	}
+
+	end := len(matches)
+	if opts.PageSize > 0 && start+opts.PageSize < end {
+		end = start + opts.PageSize
+	}
+
+	page := make([]T, 0, end-start)
+	for _, m := range matches[start:end] {
+		page = append(page, m.value)
+	}
+
+	if end == len(matches) {
+		return page, "", nil
+	}
+
+	last := matches[end-1]
+	b, err := json.Marshal(queryCursor{Resource: last.resource, Value: compactJSON(last.raw)})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return page, base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// compactJSON returns b without insignificant whitespace, or b itself if it
+// isn't JSON, e.g. with a custom MarshalFunc.
+func compactJSON(b []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return b
+	}
+	return buf.Bytes()
+}
+
+// eachRecord calls fn with the records of a collection in resource order
+// while holding its read lock, until fn returns false or an error. Records
+// deleted since the listing and reservations are skipped.
+func (d *Driver) eachRecord(collection string, fn func(resource string, b []byte) (bool, error)) error {
+	collection = d.key(collection)
+
+	if err := d.checkPath(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return err
+	}
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		b, err := d.readRecord(collection, resource)
+		if noContent(err) {
+			continue
+		}
+		if err == nil {
+			err = d.checkJSON(collection, resource, b)
+		}
+		if err != nil {
+			return err
+		}
+
+		if more, err := fn(resource, b); err != nil || !more {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TransformAll replaces every record of a collection that decodes into a T
+// with fn's result and returns how many records changed. The collection
+// stays locked throughout. All records are transformed before any is
+// written, so an error from fn leaves the collection untouched.
+func TransformAll[T any](d *Driver, collection string, fn func(T) (T, error)) (_ int, err error) {
+	defer wrapOp("TransformAll", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if err := d.checkPath(collection); err != nil {
+		return 0, err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquire(collection, false, deadline)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(resources)
+
+	changed := make(map[string][]byte)
+	for _, resource := range resources {
+		b, err := d.readRecord(collection, resource)
+		if noContent(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var v T
+		if err := d.unmarshal(b, &v); err != nil {
+			return 0, err
+		}
+
+		v, err = fn(v)
+		if err != nil {
+			return 0, fmt.Errorf("transforming %s/%s: %w", collection, resource, err)
+		}
+
+		out, err := d.marshal(v)
+		if err != nil {
+			return 0, err
+		}
+
+		if !sameJSON(b, out) {
+			changed[resource] = out
+		}
+	}
+
+	n := 0
+	for _, resource := range resources {
+		out, ok := changed[resource]
+		if !ok {
+			continue
+		}
+		if err := d.writeLocked(collection, resource, bytes.NewReader(out), deadline); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	d.log.Debugf("Transformed %d records in %s", n, collection)
+	return n, nil
+}
+
+// WriteAndRead writes v and decodes the stored record back into a T while
+// still holding the collection lock, so the result is exactly what was
+// persisted, with no other write in between.
+func WriteAndRead[T any](d *Driver, collection, resource string, v interface{}) (_ T, err error) {
+	defer wrapOp("WriteAndRead", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	var out T
+
+	b, err := d.marshal(v)
+	if err != nil {
+		return out, err
+	}
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return out, err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquireRecord(collection, resource, deadline)
+	if err != nil {
+		return out, err
+	}
+	defer unlock()
+
+	r, err := d.resolve(collection, resource, bytes.NewReader(b))
+	if err != nil {
+		return out, err
+	}
+
+	if err := d.writeValue(collection, resource, v, r, deadline); err != nil {
+		return out, err
+	}
+
+	stored, err := d.readRecord(collection, resource)
+	if err != nil {
+		return out, err
+	}
+
+	return out, d.unmarshal(stored, &out)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMapReduce(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for i, name := range []string{"nemo", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: i + 1})
+	}
+
+	total, err := MapReduce(d, "fish",
+		func(f fish) int { return f.Age },
+		func(acc, age int) int { return acc + age },
+		0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 6 {
+		t.Errorf("MapReduce = %d, want 6", total)
+	}
+
+	if got, err := MapReduce(d, "birds", func(f fish) int { return f.Age }, func(acc, age int) int { return acc + age }, 42); !os.IsNotExist(err) || got != 42 {
+		t.Errorf("MapReduce of a missing collection = %d, %v, want init and not exist", got, err)
+	}
+}
+
+func TestMapReduceUsers(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeUsers(t, d)
+
+	total, err := MapReduce(d, "users",
+		func(u User) int64 { age, _ := u.Age.Int64(); return age },
+		func(acc, age int64) int64 { return acc + age },
+		0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 89 {
+		t.Errorf("MapReduce of the ages = %d, want 89", total)
+	}
+
+	names, err := MapReduce(d, "users",
+		func(u User) string { return u.Name },
+		func(acc, name string) string { return acc + name + " " },
+		"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ReadAll doesn't promise an order, so compare the names sorted.
+	got := strings.Fields(names)
+	slices.Sort(got)
+	if want := []string{"Benn", "Sabo", "Smoker", "Zoro"}; !slices.Equal(got, want) {
+		t.Errorf("MapReduce of the names = %q, want %v in any order", names, want)
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for i, name := range []string{"nemo", "dory", "marlin", "bruce"} {
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: i})
+	}
+
+	n, err := DeleteWhere(d, "fish", func(f fish) bool { return f.Age%2 == 1 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteWhere deleted %d records, want 2", n)
+	}
+
+	records, err := d.ReadAllOrdered("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"marlin", "nemo"}) {
+		t.Errorf("records left = %v, want [marlin nemo]", got)
+	}
+}
+
+func TestDeleteWhereUsers(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeUsers(t, d)
+
+	n, err := DeleteWhere(d, "users", func(u User) bool { return u.Age == "23" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteWhere deleted %d users, want 2", n)
+	}
+
+	for _, user := range demoUsers {
+		var got User
+		err := d.Read("users", user.Name, &got)
+		if user.Age == "23" {
+			if !os.IsNotExist(err) {
+				t.Errorf("Read of deleted user %s = %v, want not exist", user.Name, err)
+			}
+		} else if err != nil || got != user {
+			t.Errorf("surviving user %s = %+v, %v, want %+v", user.Name, got, err, user)
+		}
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	got, err := WriteAndRead[fish](d, "fish", "nemo", map[string]interface{}{"name": "nemo", "age": 3, "color": "orange"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (fish{Name: "nemo", Age: 3}) {
+		t.Errorf("WriteAndRead = %+v", got)
+	}
+}
+
+func TestWriteAndReadReturnsResolvedRecord(t *testing.T) {
+	// Keep whatever was stored first, so the result differs from the value
+	// given.
+	d := newTestDriver(t, &Options{ConflictResolver: func(existing, incoming []byte) ([]byte, error) {
+		return existing, nil
+	}})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+
+	got, err := WriteAndRead[fish](d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Age != 1 {
+		t.Errorf("WriteAndRead = %+v, want the stored record", got)
+	}
+}
+
+func TestWriteAndReadCreatedAt(t *testing.T) {
+	// Stamp every record with _createdAt when it's written, and keep the
+	// stamp of the stored record when it's written again.
+	now := 0
+	d := newTestDriver(t, &Options{
+		MarshalFunc: func(v interface{}) ([]byte, error) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(b, &doc); err != nil {
+				return nil, err
+			}
+			now++
+			doc["_createdAt"] = fmt.Sprintf("t%d", now)
+			return json.Marshal(doc)
+		},
+		ConflictResolver: func(existing, incoming []byte) ([]byte, error) {
+			var old, doc map[string]interface{}
+			if err := json.Unmarshal(existing, &old); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(incoming, &doc); err != nil {
+				return nil, err
+			}
+			doc["_createdAt"] = old["_createdAt"]
+			return json.Marshal(doc)
+		},
+	})
+
+	type stamped struct {
+		Name      string
+		Company   string
+		CreatedAt string `json:"_createdAt"`
+	}
+
+	got, err := WriteAndRead[stamped](d, "users", "Zoro", User{Name: "Zoro", Company: "Straw Hats"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CreatedAt != "t1" || got.Company != "Straw Hats" {
+		t.Errorf("first WriteAndRead = %+v, want the injected _createdAt t1", got)
+	}
+
+	got, err = WriteAndRead[stamped](d, "users", "Zoro", User{Name: "Zoro", Company: "Marines"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CreatedAt != "t1" || got.Company != "Marines" {
+		t.Errorf("second WriteAndRead = %+v, want the new company with _createdAt kept at t1", got)
+	}
+}
+
+func TestWriteAndReadPartitioned(t *testing.T) {
+	d := newPartitionedDriver(t, Options{})
+
+	got, err := WriteAndRead[fish](d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	if err != nil || got.Age != 1 {
+		t.Fatalf("WriteAndRead = %+v, %v", got, err)
+	}
+	if !isFile(filepath.Join(d.dir, "fish", "age-1", "nemo.json")) {
+		t.Error("WriteAndRead ignored PartitionBy")
+	}
+
+	// A new partition moves the record like Write does.
+	if got, err = WriteAndRead[fish](d, "fish", "nemo", fish{Name: "nemo", Age: 2}); err != nil || got.Age != 2 {
+		t.Fatalf("WriteAndRead into a new partition = %+v, %v", got, err)
+	}
+	if isFile(filepath.Join(d.dir, "fish", "age-1", "nemo.json")) || !isFile(filepath.Join(d.dir, "fish", "age-2", "nemo.json")) {
+		t.Error("WriteAndRead didn't move the record to its new partition")
+	}
+}
+
+func TestCountWhere(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for i, name := range []string{"nemo", "dory", "marlin", "bruce"} {
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: i})
+	}
+
+	n, err := CountWhere(d, "fish", func(f fish) bool { return f.Age >= 2 })
+	if err != nil || n != 2 {
+		t.Errorf("CountWhere = %d, %v, want 2", n, err)
+	}
+
+	if _, err := CountWhere(d, "birds", func(f fish) bool { return true }); !os.IsNotExist(err) {
+		t.Errorf("CountWhere of a missing collection = %v, want not exist", err)
+	}
+}
+
+func TestCountWhereUsers(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeUsers(t, d)
+
+	for company, want := range map[string]int{"Asura Tech": 2, "Surya Tech": 1, "Marine Tech": 0} {
+		n, err := CountWhere(d, "users", func(u User) bool { return u.Company == company })
+		if err != nil || n != want {
+			t.Errorf("CountWhere Company == %q = %d, %v, want %d", company, n, err, want)
+		}
+	}
+}
+
+func TestFindOne(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for i, name := range []string{"nemo", "dory", "marlin", "bruce"} {
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: i})
+	}
+
+	calls := 0
+	match, found, err := FindOne(d, "fish", func(f fish) bool {
+		calls++
+		return f.Age >= 1
+	})
+	if err != nil || !found {
+		t.Fatalf("FindOne = %+v, %v, %v", match, found, err)
+	}
+	// Records are scanned in resource order: bruce, dory, ...
+	if match.Name != "bruce" || calls != 1 {
+		t.Errorf("FindOne = %+v after %d calls, want bruce after 1", match, calls)
+	}
+
+	_, found, err = FindOne(d, "fish", func(f fish) bool { return f.Age > 10 })
+	if err != nil || found {
+		t.Errorf("FindOne without a match = %v, %v, want not found", found, err)
+	}
+}
+
+func TestTransformAll(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for i, name := range []string{"nemo", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: i})
+	}
+
+	n, err := TransformAll(d, "fish", func(f fish) (fish, error) {
+		if f.Age > 0 {
+			f.Age *= 10
+		}
+		return f, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("TransformAll changed %d records, want 2", n)
+	}
+
+	var got fish
+	if err := d.Read("fish", "marlin", &got); err != nil || got.Age != 20 {
+		t.Errorf("transformed record = %+v, %v", got, err)
+	}
+}
+
+func TestTransformAllErrorLeavesCollectionUntouched(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for i, name := range []string{"a", "b", "c"} {
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: i})
+	}
+
+	boom := errors.New("boom")
+	_, err := TransformAll(d, "fish", func(f fish) (fish, error) {
+		if f.Name == "c" {
+			return f, boom
+		}
+		f.Age = 99
+		return f, nil
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("TransformAll = %v, want the callback's error", err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "b", &got); err != nil || got.Age != 1 {
+		t.Errorf("record after a failed TransformAll = %+v, %v", got, err)
+	}
+}
+
+func TestReadAllTypedMap(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory", Age: 2})
+
+	got, err := ReadAllTypedMap[fish](d, "fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["nemo"].Age != 1 || got["dory"].Name != "dory" {
+		t.Errorf("ReadAllTypedMap = %+v", got)
+	}
+
+	mustWrite(t, d, "fish", "marlin", map[string]string{"age": "old"})
+	if _, err := ReadAllTypedMap[fish](d, "fish"); err == nil || !strings.Contains(err.Error(), "fish/marlin") {
+		t.Errorf("ReadAllTypedMap with an undecodable record = %v, want an error naming it", err)
+	}
+}
+
+func TestReadAllTypedMapUsers(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeUsers(t, d)
+
+	got, err := ReadAllTypedMap[User](d, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(demoUsers) {
+		t.Errorf("ReadAllTypedMap returned %d users, want %d", len(got), len(demoUsers))
+	}
+	for _, want := range demoUsers {
+		if user, ok := got[want.Name]; !ok || user != want {
+			t.Errorf("ReadAllTypedMap[%q] = %+v, %v, want %+v", want.Name, user, ok, want)
+		}
+	}
+}
+
+func TestQueryPage(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for name, age := range map[string]int{"nemo": 1, "dory": 3, "marlin": 3, "bruce": 5, "squirt": 2, "egg": 0} {
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: age})
+	}
+
+	opts := QueryOptions[fish]{
+		Filter:   func(f fish) bool { return f.Age > 0 },
+		Less:     func(a, b fish) bool { return a.Age > b.Age },
+		PageSize: 2,
+	}
+
+	var pages [][]string
+	for {
+		page, cursor, err := QueryPage(d, "fish", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, f := range page {
+			names = append(names, f.Name)
+		}
+		pages = append(pages, names)
+
+		if cursor == "" {
+			break
+		}
+		opts.Cursor = cursor
+
+		// A record sorting before the cursor doesn't shift later pages.
+		mustWrite(t, d, "fish", "anchor", fish{Name: "anchor", Age: 9})
+	}
+
+	// Equal ages are ordered by resource name.
+	want := [][]string{{"bruce", "dory"}, {"marlin", "squirt"}, {"nemo"}}
+	if !slices.EqualFunc(pages, want, slices.Equal[[]string]) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+}
+
+func TestQueryPageAll(t *testing.T) {
+	d := newTestDriver(t, nil)
+	for _, name := range []string{"nemo", "dory", "marlin"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+
+	page, cursor, err := QueryPage(d, "fish", QueryOptions[fish]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range page {
+		names = append(names, f.Name)
+	}
+	if want := []string{"dory", "marlin", "nemo"}; !slices.Equal(names, want) || cursor != "" {
+		t.Errorf("QueryPage = %v, %q, want %v and no cursor", names, cursor, want)
+	}
+
+	if _, _, err := QueryPage(d, "fish", QueryOptions[fish]{Cursor: "not a cursor"}); err == nil {
+		t.Error("QueryPage with an invalid cursor succeeded")
+	}
+}
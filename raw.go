@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// WriteRaw stores the content of r as a record without marshaling it. The
+// content is streamed to a temp file and renamed into place, like Write.
+func (d *Driver) WriteRaw(collection, resource string, r io.Reader) error {
+	return opError("WriteRaw", collection, resource, d.writeRecord(collection, resource, r, d.deadline()))
+}
+
+// ReadRaw opens a record for reading without decoding it. The caller must
+// close the returned reader.
+func (d *Driver) ReadRaw(collection, resource string) (io.ReadCloser, error) {
+	f, err := d.readRaw(collection, resource)
+	if err != nil {
+		return nil, opError("ReadRaw", collection, resource, err)
+	}
+
+	return f, nil
+}
+
+func (d *Driver) readRaw(collection, resource string) (io.ReadCloser, error) {
+	collection, resource = d.key(collection), d.key(resource)
+
+	if collection == "" {
+		return nil, fmt.Errorf("Missing collection - unable to read")
+	}
+
+	if isReserved(collection) {
+		return nil, fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if resource == "" {
+		return nil, fmt.Errorf("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return nil, err
+	}
+
+	done, err := d.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return d.openRecord(collection, resource)
+}
+
+// openRecord is ReadRaw for callers that already validated the names and
+// registered with Close.
+func (d *Driver) openRecord(collection, resource string) (io.ReadCloser, error) {
+	if d.singleFile || len(d.codecs) > 0 {
+		b, err := d.readRecord(collection, resource)
+		if err != nil {
+			return nil, err
+		}
+		d.touch(collection, resource)
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	path := d.recordFile(collection, resource)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+		f.Close()
+		return nil, d.emptyRecord(collection, resource, path)
+	}
+
+	d.touch(collection, resource)
+	return f, nil
+}
+
+// ReadAllReaders opens every record of a collection for reading, keyed by
+// resource name, without loading them into memory. The caller must close
+// every returned reader; each holds a file descriptor, so very large
+// collections are better read with ReadRaw one record at a time. The
+// collection is only locked while the files are opened; on Unix a record
+// replaced or deleted afterwards stays readable in the version that was
+// opened.
+func (d *Driver) ReadAllReaders(collection string) (_ map[string]io.ReadCloser, err error) {
+	defer wrapOp("ReadAllReaders", collection, "", &err)
+
+	collection = d.key(collection)
+
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make(map[string]io.ReadCloser, len(resources))
+	for _, resource := range resources {
+		r, err := d.openRecord(collection, resource)
+		if noContent(err) {
+			continue
+		}
+		if err != nil {
+			for _, r := range readers {
+				r.Close()
+			}
+			return nil, err
+		}
+		readers[resource] = r
+	}
+
+	return readers, nil
+}
+
+// ReadBytes appends the content of a record to buf and returns the extended
+// slice, growing it only if it lacks capacity. Passing buf[:0] from a
+// previous call lets hot loops read records without allocating.
+func (d *Driver) ReadBytes(collection, resource string, buf []byte) (_ []byte, err error) {
+	defer wrapOp("ReadBytes", collection, resource, &err)
+
+	f, err := d.ReadRaw(collection, resource)
+	if err != nil {
+		return buf, err
+	}
+	defer f.Close()
+
+	start := len(buf)
+
+	if file, ok := f.(*os.File); ok {
+		if fi, err := file.Stat(); err == nil {
+			// One extra byte so the read that reports io.EOF doesn't need to grow.
+			buf = slices.Grow(buf, int(fi.Size())+1)
+		}
+	}
+
+	for {
+		if len(buf) == cap(buf) {
+			buf = slices.Grow(buf, 512)
+		}
+
+		n, err := f.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, d.checkJSON(collection, resource, buf[start:])
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRawAndReadRaw(t *testing.T) {
+	d := newTestDriver(t, nil)
+	content := `{"name":"nemo",  "age":1}`
+
+	if err := d.WriteRaw("fish", "nemo", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := d.ReadRaw("fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Errorf("ReadRaw = %q, want the bytes written, %q", b, content)
+	}
+
+	if _, err := d.ReadRaw("fish", "dory"); !os.IsNotExist(err) {
+		t.Errorf("ReadRaw of a missing record = %v, want not exist", err)
+	}
+}
+
+func TestReadAllReaders(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	want := map[string]string{
+		"nemo": rawRecord(t, d, "fish", "nemo"),
+		"dory": rawRecord(t, d, "fish", "dory"),
+	}
+
+	readers, err := d.ReadAllReaders("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readers) != len(want) {
+		t.Errorf("ReadAllReaders opened %d records, want %d", len(readers), len(want))
+	}
+
+	// A record replaced after being opened reads as it was.
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	for resource, r := range readers {
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want[resource] {
+			t.Errorf("reader for %s = %s, want %s", resource, b, want[resource])
+		}
+	}
+
+	if _, err := d.ReadAllReaders("sharks"); !os.IsNotExist(err) {
+		t.Errorf("ReadAllReaders of a missing collection = %v, want a not-exist error", err)
+	}
+}
+
+func TestReadBytesAppendsToBuffer(t *testing.T) {
+	d := newTestDriver(t, nil)
+	content := `{"name":"nemo"}`
+	if err := d.WriteRaw("fish", "nemo", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := d.ReadBytes("fish", "nemo", []byte("prefix:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "prefix:"+content {
+		t.Errorf("ReadBytes = %q, want the record appended to the buffer", buf)
+	}
+
+	// A buffer with enough room is reused as it is.
+	big := make([]byte, 0, 1024)
+	buf, err = d.ReadBytes("fish", "nemo", big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &buf[0] != &big[:1][0] {
+		t.Error("ReadBytes grew a buffer that had enough capacity")
+	}
+	if string(buf) != content {
+		t.Errorf("ReadBytes = %q, want %q", buf, content)
+	}
+
+	if _, err := d.ReadBytes("fish", "dory", nil); !os.IsNotExist(err) {
+		t.Errorf("ReadBytes of a missing record = %v, want not exist", err)
+	}
+}
+
+func BenchmarkReadBytes(b *testing.B) {
+	d := newTestDriver(b, nil)
+	mustWrite(b, d, "fish", "nemo", fish{Name: strings.Repeat("nemo", 256), Age: 1})
+
+	b.Run("Reused", func(b *testing.B) {
+		b.ReportAllocs()
+		var buf []byte
+		for i := 0; i < b.N; i++ {
+			var err error
+			if buf, err = d.ReadBytes("fish", "nemo", buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := d.ReadBytes("fish", "nemo", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("os.ReadFile", func(b *testing.B) {
+		b.ReportAllocs()
+		path := filepath.Join(d.dir, "fish", "nemo.json")
+		for i := 0; i < b.N; i++ {
+			if _, err := os.ReadFile(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Read", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var got fish
+			if err := d.Read("fish", "nemo", &got); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
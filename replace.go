@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReplaceCollection replaces the whole content of a collection with records.
+// The new records are written to a staging directory next to the collection
+// first and then renamed into place under the collection's write lock, so
+// readers see either the old or the new set, never a mix. A crash between
+// the two renames of the swap can leave the collection missing, with the new
+// content still in its hidden staging directory. Sub-collections are kept.
+// Events reports a deletion for every old record that isn't replaced and a
+// write for every new one.
+func (d *Driver) ReplaceCollection(collection string, records map[string]interface{}) (err error) {
+	defer wrapOp("ReplaceCollection", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to replace!")
+	}
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	data := make(map[string][]byte, len(records))
+	for resource, v := range records {
+		resource = d.key(resource)
+		if err := d.checkRecord(collection, resource); err != nil {
+			return err
+		}
+		if _, ok := data[resource]; ok {
+			return fmt.Errorf("resource %s/%s: %w", collection, resource, ErrAlreadyExists)
+		}
+
+		b, err := d.marshal(v)
+		if err != nil {
+			return err
+		}
+		data[resource] = b
+	}
+
+	if d.dryRun {
+		d.dryRunf("replace collection %s with %d records", collection, len(data))
+		return nil
+	}
+
+	if err := d.checkDatabase(); err != nil {
+		return err
+	}
+
+	if d.singleFile {
+		packed := make(map[string]json.RawMessage, len(data))
+		for resource, b := range data {
+			if !json.Valid(b) {
+				return fmt.Errorf("record %s/%s is not valid JSON, as single-file mode requires", collection, resource)
+			}
+			packed[resource] = b
+		}
+
+		unlock, err := d.acquire(collection, false, d.deadline())
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		old, err := d.listResources(collection)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := d.writePacked(collection, packed); err != nil {
+			return err
+		}
+
+		return d.replaced(collection, old, data)
+	}
+
+	staging := make(map[string]string, len(d.roots()))
+	defer func() {
+		for _, dir := range staging {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	for _, root := range d.roots() {
+		dst := filepath.Join(root, collection)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+
+		dir, err := os.MkdirTemp(filepath.Dir(dst), ".replace-"+filepath.Base(dst)+"-")
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(dir, 0755); err != nil {
+			return err
+		}
+		staging[root] = dir
+	}
+
+	for resource, b := range data {
+		path := filepath.Join(staging[d.rootFor(resource)], resource+".json")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := d.writeFileAtomic(path, b); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	old, err := d.listResources(collection)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Partition directories hold old records; other directories are
+	// sub-collections and stay.
+	keep := func(name string) bool {
+		return !d.partitioned(collection) && !strings.HasPrefix(name, ".")
+	}
+
+	for _, root := range d.roots() {
+		if err := swapDir(staging[root], filepath.Join(root, collection), keep); err != nil {
+			return err
+		}
+		delete(staging, root)
+	}
+
+	return d.replaced(collection, old, data)
+}
+
+// replaced updates the caches and indexes of a collection after
+// ReplaceCollection swapped in data for the records old, and reports the
+// change to Events. The caller must hold the collection mutex.
+func (d *Driver) replaced(collection string, old []string, data map[string][]byte) error {
+	d.unindex(collection, "")
+	d.access.forget(collection, "")
+	d.partitions.forget(collection, "")
+	d.names.forget(collection)
+	d.forgetDirs(collection)
+	d.uncache(collection, "")
+
+	sort.Strings(old)
+	for _, resource := range old {
+		if _, ok := data[resource]; !ok {
+			d.emit(ChangeDelete, collection, resource)
+		}
+	}
+
+	resources := make([]string, 0, len(data))
+	for resource := range data {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		if err := d.reindexRecord(collection, resource); err != nil {
+			return err
+		}
+		d.emit(ChangeWrite, collection, resource)
+	}
+
+	d.log.Debugf("Replaced collection %s with %d records", collection, len(data))
+	return nil
+}
+
+// swapDir replaces the directory dst with src. The old dst is first moved
+// aside to src+".old" so the new content can be renamed into place, then
+// removed, except for its sub-directories keep accepts, which are moved
+// into the new dst.
+func swapDir(src, dst string, keep func(name string) bool) error {
+	old := src + ".old"
+	if err := os.Rename(dst, old); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		old = ""
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		if old != "" {
+			os.Rename(old, dst)
+		}
+		return err
+	}
+
+	if old == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(old)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !keep(entry.Name()) {
+			continue
+		}
+		if err := moveInto(filepath.Join(old, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(old)
+}
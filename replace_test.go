@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestReplaceCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish/reef", "bruce", fish{Name: "bruce"})
+	if err := d.CreateIndex("fish", "name", func(data []byte) (string, bool) { return string(data), true }); err != nil {
+		t.Fatal(err)
+	}
+	events := d.Events()
+
+	err := d.ReplaceCollection("fish", map[string]interface{}{
+		"nemo":   fish{Name: "nemo", Age: 1},
+		"marlin": fish{Name: "marlin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAllOrdered("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"marlin", "nemo"}) {
+		t.Errorf("records after ReplaceCollection = %v, want [marlin nemo]", got)
+	}
+
+	var got fish
+	if err := d.Read("fish/reef", "bruce", &got); err != nil {
+		t.Errorf("sub-collection lost by ReplaceCollection: %v", err)
+	}
+
+	if resources, err := d.Lookup("fish", "name", rawRecord(t, d, "fish", "marlin")); err != nil || !slices.Equal(resources, []string{"marlin"}) {
+		t.Errorf("index after ReplaceCollection = %v, %v", resources, err)
+	}
+
+	want := []string{"delete fish/dory", "write fish/marlin", "write fish/nemo"}
+	if got := drainEvents(events); !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestReplaceCollectionCreatesCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.ReplaceCollection("fish", map[string]interface{}{"nemo": fish{Name: "nemo"}}); err != nil {
+		t.Fatal(err)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Errorf("Read after replacing a missing collection = %v", err)
+	}
+
+	if err := d.ReplaceCollection("fish", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Errorf("Read after replacing with nothing = %v, want not exist", err)
+	}
+}
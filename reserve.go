@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Reserve claims a resource name before its content is known by creating
+// an empty record file, which a later Write fills. It fails with
+// ErrAlreadyExists if the record exists or is already reserved. The file is
+// created exclusively, so of several drivers or processes reserving the
+// same name only one succeeds.
+//
+// Until it is written, a reserved record reads as ErrEmptyRecord, or as
+// missing with EmptyAsMissing. It is part of ListResources and
+// CollectionStats, since the name is taken, but left out of ReadAll and the
+// other reads of whole collections, having no content. Delete releases a
+// reservation. Single-file collections can't hold reservations.
+func (d *Driver) Reserve(collection, resource string) (err error) {
+	defer wrapOp("Reserve", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	if d.singleFile {
+		return fmt.Errorf("unable to reserve %s/%s in a single-file collection", collection, resource)
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Catches records stored in another format, or in another partition,
+	// which the exclusive create below can't see.
+	_, err = d.readRecord(collection, resource)
+	if err == nil || errors.Is(err, ErrEmptyRecord) {
+		return fmt.Errorf("record %s/%s: %w", collection, resource, ErrAlreadyExists)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	if d.dryRun {
+		d.dryRunf("reserve %s/%s", collection, resource)
+		return nil
+	}
+
+	if err := d.checkDatabase(); err != nil {
+		return err
+	}
+
+	if err := d.assignName(collection, resource); err != nil {
+		return err
+	}
+
+	path := d.homeFile(collection, resource)
+	if err := d.ensureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("record %s/%s: %w", collection, resource, ErrAlreadyExists)
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	d.emit(ChangeWrite, collection, resource)
+	d.log.Debugf("Reserved %s/%s", collection, resource)
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestReserve(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	if err := d.Reserve("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dory", "nemo"} {
+		if err := d.Reserve("fish", name); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("Reserve of taken %s = %v, want ErrAlreadyExists", name, err)
+		}
+	}
+
+	// The name is taken but has no content yet.
+	if err := d.Read("fish", "dory", &fish{}); !errors.Is(err, ErrEmptyRecord) {
+		t.Errorf("Read of a reservation = %v, want ErrEmptyRecord", err)
+	}
+	if resources, _ := d.ListResources("fish"); !slices.Equal(resources, []string{"dory", "nemo"}) {
+		t.Errorf("ListResources = %v, want [dory nemo]", resources)
+	}
+	if stats, _ := d.CollectionStats(); stats["fish"] != 2 {
+		t.Errorf("CollectionStats = %v, want 2 fish", stats)
+	}
+
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	var got fish
+	if err := d.Read("fish", "dory", &got); err != nil || got.Name != "dory" {
+		t.Errorf("Read after filling the reservation = %+v, %v", got, err)
+	}
+
+	// Delete releases a reservation.
+	if err := d.Reserve("fish", "marlin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("fish", "marlin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reserve("fish", "marlin"); err != nil {
+		t.Errorf("Reserve after Delete = %v", err)
+	}
+}
+
+func TestReserveOnlyOneWins(t *testing.T) {
+	dir := newTestDriver(t, nil).dir
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		d := openTestDriver(t, dir, nil)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = d.Reserve("fish", "nemo")
+		}()
+	}
+	wg.Wait()
+
+	won := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrAlreadyExists):
+			t.Errorf("losing Reserve = %v, want ErrAlreadyExists", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d drivers reserved fish/nemo, want 1", won)
+	}
+}
+
+func TestReserveSkippedByCollectionReads(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.Reserve("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+
+	reads := map[string]func() (int, error){
+		"ReadAll":        func() (int, error) { r, err := d.ReadAll("fish"); return len(r), err },
+		"ReadAllOrdered": func() (int, error) { r, err := d.ReadAllOrdered("fish"); return len(r), err },
+		"ReadAllMap":     func() (int, error) { r, err := d.ReadAllMap("fish"); return len(r), err },
+		"ReadAllParallel": func() (int, error) {
+			r, err := d.ReadAllParallel("fish", 4)
+			return len(r), err
+		},
+		"ReadAllReaders": func() (int, error) {
+			r, err := d.ReadAllReaders("fish")
+			for _, rc := range r {
+				rc.Close()
+			}
+			return len(r), err
+		},
+		"ReadAllTypedMap": func() (int, error) { r, err := ReadAllTypedMap[fish](d, "fish"); return len(r), err },
+		"TypedDriver.All": func() (int, error) { r, err := NewTypedDriver[fish](d, "fish").All(); return len(r), err },
+		"CountWhere":      func() (int, error) { return CountWhere(d, "fish", func(fish) bool { return true }) },
+		"MapReduce": func() (int, error) {
+			return MapReduce(d, "fish", func(fish) int { return 1 }, func(acc, n int) int { return acc + n }, 0)
+		},
+		"TransformAll": func() (int, error) {
+			return TransformAll(d, "fish", func(f fish) (fish, error) { f.Age++; return f, nil })
+		},
+		"WalkAll": func() (int, error) {
+			n := 0
+			err := d.WalkAll(func(collection, resource string, data []byte) error { n++; return nil })
+			return n, err
+		},
+		"Dump": func() (int, error) { dump, err := d.Dump(); return len(dump["fish"]), err },
+		"ExportJSONL": func() (int, error) {
+			var buf bytes.Buffer
+			err := d.ExportJSONL("fish", &buf)
+			return bytes.Count(buf.Bytes(), []byte("\n")), err
+		},
+	}
+
+	for name, read := range reads {
+		if n, err := read(); err != nil || n != 1 {
+			t.Errorf("%s = %d records, %v, want 1", name, n, err)
+		}
+	}
+
+	// DeleteWhere doesn't see the reservation, so it stays.
+	if _, err := DeleteWhere(d, "fish", func(fish) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	if resources, _ := d.ListResources("fish"); !slices.Equal(resources, []string{"dory"}) {
+		t.Errorf("fish after DeleteWhere = %v, want the reservation", resources)
+	}
+}
+
+func TestReservePartitioned(t *testing.T) {
+	d := newTestDriver(t, &Options{PartitionBy: map[string]func(v interface{}) string{"fish": byAge}})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	if err := d.Reserve("fish", "dory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reserve("fish", "nemo"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Reserve of a partitioned record = %v, want ErrAlreadyExists", err)
+	}
+
+	records, err := d.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"nemo"}) {
+		t.Errorf("ReadAll of the partitioned collection = %v, want [nemo]", got)
+	}
+
+	// An empty file inside a partition is skipped the same way.
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "age-1", "marlin.json"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err = d.ReadAllPartition("fish", "age-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"nemo"}) {
+		t.Errorf("ReadAllPartition = %v, want [nemo]", got)
+	}
+}
+
+func TestReserveSingleFile(t *testing.T) {
+	d := newTestDriver(t, &Options{SingleFilePerCollection: true})
+
+	if err := d.Reserve("fish", "nemo"); err == nil {
+		t.Error("Reserve succeeded in single-file mode")
+	}
+}
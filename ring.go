@@ -0,0 +1,301 @@
+package main
+
+import (
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ringReplicas is the number of points each data directory gets on the
+// hash ring. More points spread keys more evenly between directories.
+const ringReplicas = 128
+
+// hashRing assigns resource keys to data directories by consistent hashing,
+// so adding a directory only moves the keys that now land on its points
+// instead of reshuffling everything.
+type hashRing struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+func newHashRing(dirs []string) *hashRing {
+	r := &hashRing{owners: make(map[uint64]string, len(dirs)*ringReplicas)}
+
+	for _, dir := range dirs {
+		for i := 0; i < ringReplicas; i++ {
+			p := hashKey(dir + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[p]; taken {
+				continue
+			}
+			r.owners[p] = dir
+			r.points = append(r.points, p)
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the directory responsible for key: the first point on the
+// ring at or after the key's hash.
+func (r *hashRing) owner(key string) string {
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]]
+}
+
+// hashKey hashes key with FNV-1a followed by the murmur3 finalizer, since
+// plain FNV barely spreads keys that only differ in their last bytes.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// roots returns every directory that can hold records, d.dir first.
+func (d *Driver) roots() []string {
+	if d.ring == nil {
+		return []string{d.dir}
+	}
+
+	return d.dataDirs
+}
+
+// rootFor returns the directory a record belongs in.
+func (d *Driver) rootFor(resource string) string {
+	if d.ring == nil {
+		return d.dir
+	}
+
+	return d.ring.owner(resource)
+}
+
+// homeFile returns the path a record is written to.
+func (d *Driver) homeFile(collection, resource string) string {
+	return filepath.Join(d.rootFor(resource), d.recordDir(collection, resource), d.storedName(collection, resource)+".json")
+}
+
+// recordFile returns the path a record is read from. Records written before
+// a data directory was added may still sit in their previous directory until
+// Rebalance moves them, so the other directories are checked when the owner
+// doesn't have the record.
+func (d *Driver) recordFile(collection, resource string) string {
+	home := d.homeFile(collection, resource)
+	if d.ring == nil {
+		return home
+	}
+
+	dir := d.recordDir(collection, resource)
+
+	if _, err := os.Stat(home); err == nil {
+		return home
+	}
+
+	for _, root := range d.dataDirs {
+		path := filepath.Join(root, dir, resource+".json")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return home
+}
+
+// removeStale deletes copies of a record outside its home directory, left
+// over from before the set of data directories changed. Their blobs and
+// metadata are moved home, next to the record just written. The caller must
+// hold the collection mutex.
+func (d *Driver) removeStale(collection, resource string) error {
+	if d.ring == nil {
+		return nil
+	}
+
+	home := d.homeFile(collection, resource)
+	dir := d.recordDir(collection, resource)
+	for _, root := range d.dataDirs {
+		path := filepath.Join(root, dir, resource+".json")
+		if path == home {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := d.moveSidecars(filepath.Dir(path), filepath.Dir(home), resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rebalance moves every record that isn't in the data directory the hash
+// ring assigns it to, e.g. after a directory was added to DataDirs, going
+// through partitions and sub-collections too. It returns the number of
+// records moved.
+func (d *Driver) Rebalance() (_ int, err error) {
+	defer wrapOp("Rebalance", "", "", &err)
+
+	if d.ring == nil {
+		return 0, nil
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for len(collections) > 0 {
+		collection := collections[0]
+		collections = collections[1:]
+
+		n, subCollections, err := d.rebalanceCollection(collection)
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+		collections = append(collections, subCollections...)
+	}
+
+	d.log.Debugf("Rebalanced %d records across %d data directories", moved, len(d.dataDirs))
+	return moved, nil
+}
+
+// rebalanceCollection moves the records of a collection, including those in
+// its partitions, to the data directories they belong in. It returns the
+// number of records moved and the sub-collections found, which Rebalance
+// moves the records of next.
+func (d *Driver) rebalanceCollection(collection string) (int, []string, error) {
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+
+	var subCollections []string
+	moved := 0
+	for _, root := range d.dataDirs {
+		entries, err := os.ReadDir(filepath.Join(root, collection))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return moved, nil, err
+		}
+
+		dirs := []string{collection}
+		for _, entry := range entries {
+			if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			// Directories in a partitioned collection are its partitions.
+			dir := filepath.Join(collection, entry.Name())
+			if d.partitioned(collection) {
+				dirs = append(dirs, dir)
+			} else if !slices.Contains(subCollections, dir) {
+				subCollections = append(subCollections, dir)
+			}
+		}
+
+		for _, dir := range dirs {
+			n, err := d.rebalanceDir(root, dir)
+			moved += n
+			if err != nil {
+				return moved, nil, err
+			}
+		}
+	}
+
+	return moved, subCollections, nil
+}
+
+// rebalanceDir moves the records in dir, relative to the data directory
+// root, that belong in another data directory to the same place there. The
+// caller must hold the collection mutex.
+func (d *Driver) rebalanceDir(root, dir string) (int, error) {
+	files, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, file := range files {
+		resource, ok := recordName(file)
+		if !ok || d.rootFor(resource) == root {
+			continue
+		}
+
+		if d.dryRun {
+			d.dryRunf("move %s/%s from %s to %s", dir, resource, root, d.rootFor(resource))
+			continue
+		}
+
+		dst := filepath.Join(d.rootFor(resource), dir, file.Name())
+		if err := d.moveRecord(filepath.Join(root, dir, file.Name()), dst); err != nil {
+			return moved, err
+		}
+		if err := d.moveSidecars(filepath.Join(root, dir), filepath.Dir(dst), resource); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+
+	return moved, nil
+}
+
+// moveRecord moves a record file to dst. Data directories usually live on
+// different filesystems, so it copies and removes rather than renaming.
+func (d *Driver) moveRecord(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err := d.copyFileAtomic(dst, f); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// moveSidecars moves the blobs and metadata of a record from srcDir to
+// dstDir, replacing any there, so they stay next to the record.
+func (d *Driver) moveSidecars(srcDir, dstDir, resource string) error {
+	if srcDir == dstDir {
+		return nil
+	}
+
+	names, err := sidecarFiles(srcDir, resource)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := d.moveRecord(filepath.Join(srcDir, name), filepath.Join(dstDir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// countRecords returns how many record files of collection each root holds.
+func countRecords(t *testing.T, roots []string, collection string) []int {
+	t.Helper()
+
+	counts := make([]int, len(roots))
+	for i, root := range roots {
+		entries, err := os.ReadDir(filepath.Join(root, collection))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if _, ok := recordName(entry); ok {
+				counts[i]++
+			}
+		}
+	}
+
+	return counts
+}
+
+func TestDataDirsSpreadRecords(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	extra := []string{filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")}
+	d := openTestDriver(t, dir, &Options{DataDirs: extra})
+
+	var want []string
+	for i := 0; i < 60; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		want = append(want, name)
+	}
+
+	for i, n := range countRecords(t, append([]string{dir}, extra...), "fish") {
+		if n == 0 {
+			t.Errorf("data directory %d holds no records", i)
+		}
+	}
+
+	records, err := d.ReadAllOrdered("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, want) {
+		t.Errorf("ReadAllOrdered = %v, want %v", got, want)
+	}
+}
+
+func TestRebalanceAfterAddingDataDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	a, b := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	d := openTestDriver(t, dir, &Options{DataDirs: []string{a}})
+	for i := 0; i < 40; i++ {
+		mustWrite(t, d, "fish", fmt.Sprintf("fish-%02d", i), fish{Name: "nemo", Age: i})
+	}
+	d.Close()
+
+	d = openTestDriver(t, dir, &Options{DataDirs: []string{a, b}})
+
+	// Records are still found before they are moved.
+	for i := 0; i < 40; i++ {
+		var got fish
+		if err := d.Read("fish", fmt.Sprintf("fish-%02d", i), &got); err != nil || got.Age != i {
+			t.Fatalf("Read before Rebalance = %+v, %v", got, err)
+		}
+	}
+
+	moved, err := d.Rebalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := countRecords(t, []string{dir, a, b}, "fish"); moved == 0 || counts[2] != moved {
+		t.Errorf("Rebalance moved %d records, new directory holds %d", moved, counts[2])
+	}
+
+	if moved, err := d.Rebalance(); err != nil || moved != 0 {
+		t.Errorf("second Rebalance = %d, %v, want nothing to move", moved, err)
+	}
+
+	records, err := d.ReadAll("fish")
+	if err != nil || len(records) != 40 {
+		t.Errorf("ReadAll after Rebalance = %d records, %v", len(records), err)
+	}
+}
+
+func TestRebalancePartitionsAndSubCollections(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	a, b := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	opts := Options{
+		DataDirs:    []string{a},
+		PartitionBy: map[string]func(v interface{}) string{"fish": byAge},
+	}
+	d := openTestDriver(t, dir, &opts)
+	for i := 0; i < 90; i++ {
+		mustWrite(t, d, "fish", fmt.Sprintf("fish-%02d", i), fish{Name: "nemo", Age: i % 3})
+		mustWrite(t, d, "sea/reef", fmt.Sprintf("fish-%02d", i), fish{Name: "dory", Age: i})
+	}
+	d.Close()
+
+	opts.DataDirs = []string{a, b}
+	d = openTestDriver(t, dir, &opts)
+
+	moved, err := d.Rebalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Moved records land at the same place in the new directory.
+	inB := 0
+	for _, collection := range []string{"fish", "fish/age-1", "fish/age-2", "sea/reef"} {
+		inB += countRecords(t, []string{b}, collection)[0]
+	}
+	if moved == 0 || inB != moved {
+		t.Errorf("Rebalance moved %d records, new directory holds %d", moved, inB)
+	}
+	for _, collection := range []string{"fish/age-1", "sea/reef"} {
+		if countRecords(t, []string{b}, collection)[0] == 0 {
+			t.Errorf("Rebalance moved nothing from %s", collection)
+		}
+	}
+
+	if moved, err := d.Rebalance(); err != nil || moved != 0 {
+		t.Errorf("second Rebalance = %d, %v, want nothing to move", moved, err)
+	}
+
+	for i := 0; i < 90; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		var got fish
+		if err := d.Read("fish", name, &got); err != nil || got.Age != i%3 {
+			t.Errorf("Read fish/%s after Rebalance = %+v, %v", name, got, err)
+		}
+		if err := d.Read("sea/reef", name, &got); err != nil || got.Age != i {
+			t.Errorf("Read sea/reef/%s after Rebalance = %+v, %v", name, got, err)
+		}
+	}
+}
+
+func TestWriteRemovesStaleCopies(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	a, b := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	d := openTestDriver(t, dir, &Options{DataDirs: []string{a}})
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		mustWrite(t, d, "fish", name, fish{Name: name})
+		if err := d.WriteBlob("fish", name, "photo", []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	d = openTestDriver(t, dir, &Options{DataDirs: []string{a, b}})
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("fish-%02d", i)
+		mustWrite(t, d, "fish", name, fish{Name: name, Age: 1})
+
+		blob, err := d.ReadBlob("fish", name, "photo")
+		if err != nil || string(blob) != name {
+			t.Errorf("blob of %s after the rewrite = %q, %v", name, blob, err)
+		}
+		if home := filepath.Dir(d.homeFile("fish", name)); !isFile(filepath.Join(home, name+".photo"+blobExt)) {
+			t.Errorf("blob of %s wasn't moved next to the record", name)
+		}
+	}
+
+	if counts := countRecords(t, []string{dir, a, b}, "fish"); counts[0]+counts[1]+counts[2] != 40 {
+		t.Errorf("record files = %v, want one copy of each record", counts)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// In single-file mode (Options.SingleFilePerCollection) a collection is one
+// JSON object, <collection>.json at the root of the database, mapping
+// resource names to records. Every write or delete rewrites the whole file,
+// so the mode suits small collections on inode-limited filesystems.
+
+// packedFile returns the file holding a collection in single-file mode.
+func (d *Driver) packedFile(collection string) string {
+	return filepath.Join(d.dir, collection+".json")
+}
+
+// readPacked returns the records of a collection in single-file mode. A
+// missing collection is reported as a not-exist error, like ReadDir does for
+// collection directories.
+func (d *Driver) readPacked(collection string) (map[string]json.RawMessage, error) {
+	b, err := os.ReadFile(d.packedFile(collection))
+	if err != nil {
+		return nil, err
+	}
+
+	var records map[string]json.RawMessage
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("collection %s: %w", collection, err)
+	}
+
+	return records, nil
+}
+
+// writePacked atomically replaces the file of a collection in single-file
+// mode. The caller must hold the collection mutex.
+func (d *Driver) writePacked(collection string, records map[string]json.RawMessage) error {
+	var (
+		b   []byte
+		err error
+	)
+	if d.indent {
+		b, err = json.MarshalIndent(records, "", "\t")
+	} else {
+		b, err = json.Marshal(records)
+	}
+	if err != nil {
+		return err
+	}
+
+	path := d.packedFile(collection)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if d.trailingNewline {
+		b = append(b, '\n')
+	}
+
+	return d.writeFileAtomic(path, b)
+}
+
+// emptyRecord is the error for the zero-byte record file at path, e.g. left
+// behind by a crash or a careless tool: ErrEmptyRecord, or a not-exist
+// error with EmptyAsMissing.
+func (d *Driver) emptyRecord(collection, resource, path string) error {
+	if d.emptyAsMissing {
+		return &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return fmt.Errorf("%s/%s: %w", collection, resource, ErrEmptyRecord)
+}
+
+// noContent reports whether err, from reading a record, means there is no
+// content to read rather than a failure: the record doesn't exist, e.g.
+// because it was deleted after a listing, or its file is empty, e.g.
+// because Reserve claimed it. Operations going over whole collections skip
+// such records.
+func noContent(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, ErrEmptyRecord)
+}
+
+// loadRecord reads the content of a record from disk, from its own file or
+// from the collection file in single-file mode, converted to JSON if it is
+// in the format of a registered codec. The caller must hold the collection
+// mutex.
+func (d *Driver) loadRecord(collection, resource string) ([]byte, error) {
+	if !d.singleFile {
+		path := d.recordFile(collection, resource)
+
+		b, err := os.ReadFile(path)
+		if err == nil && len(b) == 0 {
+			return nil, d.emptyRecord(collection, resource, path)
+		}
+		if len(d.codecs) == 0 {
+			return b, err
+		}
+		if os.IsNotExist(err) {
+			return d.readEncoded(collection, resource)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeFile(path, b)
+	}
+
+	records, err := d.readPacked(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := records[resource]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: filepath.Join(collection, resource), Err: fs.ErrNotExist}
+	}
+
+	return b, nil
+}
+
+// writePackedRecord is writeLocked for single-file mode.
+func (d *Driver) writePackedRecord(collection, resource string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if !json.Valid(b) {
+		return fmt.Errorf("record %s/%s is not valid JSON, as single-file mode requires", collection, resource)
+	}
+
+	records, err := d.readPacked(collection)
+	if os.IsNotExist(err) {
+		records = make(map[string]json.RawMessage)
+	} else if err != nil {
+		return err
+	}
+
+	records[resource] = b
+	return d.writePacked(collection, records)
+}
+
+// deletePacked is delete for single-file mode.
+func (d *Driver) deletePacked(collection, resource string) error {
+	path := filepath.Join(collection, resource)
+
+	records, err := d.readPacked(collection)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("unable to find file or directory named %v: %w", path, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, ok := records[resource]; resource != "" && !ok {
+		return fmt.Errorf("unable to find file or directory named %v: %w", path, ErrNotFound)
+	}
+
+	if d.dryRun {
+		d.dryRunf("delete %s", path)
+		return nil
+	}
+
+	if resource == "" {
+		if err := os.Remove(d.packedFile(collection)); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(filepath.Join(d.dir, collection)); err != nil {
+			return err
+		}
+		d.forgetDirs(collection)
+	} else {
+		delete(records, resource)
+		if err := d.writePacked(collection, records); err != nil {
+			return err
+		}
+
+		dir := filepath.Dir(filepath.Join(d.dir, path))
+		blobs, err := sidecarFiles(dir, filepath.Base(resource))
+		if err != nil {
+			return err
+		}
+		for _, name := range blobs {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.unindex(collection, resource)
+	d.access.forget(collection, resource)
+	return nil
+}
+
+// packedResources is ListResources for single-file mode.
+func (d *Driver) packedResources(collection string) ([]string, error) {
+	records, err := d.readPacked(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]string, 0, len(records))
+	for resource := range records {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	return resources, nil
+}
+
+// packedCollections returns the collections stored as files at the root
+// in single-file mode.
+func (d *Driver) packedCollections() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var collections []string
+	for _, entry := range entries {
+		if name, ok := recordName(entry); ok && !strings.HasPrefix(name, ".") {
+			collections = append(collections, name)
+		}
+	}
+
+	return collections, nil
+}
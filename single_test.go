@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSingleFilePerCollection(t *testing.T) {
+	d := newTestDriver(t, &Options{SingleFilePerCollection: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+
+	b, err := os.ReadFile(filepath.Join(d.dir, "fish.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packed map[string]fish
+	if err := json.Unmarshal(b, &packed); err != nil {
+		t.Fatal(err)
+	}
+	if len(packed) != 2 || packed["dory"].Name != "dory" {
+		t.Errorf("collection file holds %v", packed)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "fish")); !os.IsNotExist(err) {
+		t.Errorf("single-file mode created a collection directory: %v", err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Errorf("Read = %+v, %v", got, err)
+	}
+
+	names, err := d.ListResources("fish")
+	slices.Sort(names)
+	if err != nil || !slices.Equal(names, []string{"dory", "nemo"}) {
+		t.Errorf("ListResources = %v, %v", names, err)
+	}
+
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := d.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fishNames(t, records); !slices.Equal(got, []string{"dory"}) {
+		t.Errorf("ReadAll after Delete = %v", got)
+	}
+
+	collections, err := d.Collections()
+	if err != nil || !slices.Equal(collections, []string{"fish"}) {
+		t.Errorf("Collections = %v, %v", collections, err)
+	}
+}
+
+func TestSingleFileTrailingNewline(t *testing.T) {
+	for _, newline := range []bool{true, false} {
+		d := newTestDriver(t, &Options{SingleFilePerCollection: true, TrailingNewline: boolPtr(newline)})
+		mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+		b, err := os.ReadFile(filepath.Join(d.dir, "fish.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.HasSuffix(string(b), "\n"); got != newline {
+			t.Errorf("TrailingNewline %v: collection file %q ends in a newline = %v", newline, b, got)
+		}
+	}
+}
+
+func TestSingleFileRejectsInvalidJSON(t *testing.T) {
+	d := newTestDriver(t, &Options{SingleFilePerCollection: true})
+
+	if err := d.WriteRaw("fish", "nemo", strings.NewReader("not json")); err == nil {
+		t.Error("WriteRaw of invalid JSON in single-file mode succeeded")
+	}
+}
+
+func TestSingleFileMissingCollection(t *testing.T) {
+	d := newTestDriver(t, &Options{SingleFilePerCollection: true})
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Errorf("Read from a missing collection = %v, want not exist", err)
+	}
+	if _, err := d.ReadAll("fish"); !os.IsNotExist(err) {
+		t.Errorf("ReadAll of a missing collection = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+)
+
+// KeyedRecord is a record to write, named by its resource key.
+type KeyedRecord struct {
+	Key   string
+	Value interface{}
+}
+
+// WriteStream writes the records received from in to a collection, one at
+// a time, until in is closed or ctx is done, and returns how many were
+// written. Each write finishes before the next record is received, so a
+// slow disk slows down the sender instead of queueing records in memory.
+// The first failed write stops the stream.
+func (d *Driver) WriteStream(ctx context.Context, collection string, in <-chan KeyedRecord) (_ int, err error) {
+	defer wrapOp("WriteStream", collection, "", &err)
+
+	n := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+
+		case record, ok := <-in:
+			if !ok {
+				d.log.Debugf("Streamed %d records into %s", n, collection)
+				return n, nil
+			}
+
+			if err := d.Write(collection, record.Key, record.Value); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+}
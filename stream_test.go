@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteStream(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	in := make(chan KeyedRecord)
+	go func() {
+		defer close(in)
+		for _, name := range []string{"nemo", "dory", "marlin"} {
+			in <- KeyedRecord{Key: name, Value: fish{Name: name}}
+		}
+	}()
+
+	n, err := d.WriteStream(context.Background(), "fish", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("WriteStream wrote %d records, want 3", n)
+	}
+
+	records, err := d.ReadAll("fish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fishNames(t, records), []string{"dory", "marlin", "nemo"}; !slices.Equal(got, want) {
+		t.Errorf("streamed records = %v, want %v", got, want)
+	}
+}
+
+func TestWriteStreamStopsOnError(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	in := make(chan KeyedRecord, 3)
+	in <- KeyedRecord{Key: "nemo", Value: fish{Name: "nemo"}}
+	in <- KeyedRecord{Key: "bubbles", Value: make(chan int)}
+	in <- KeyedRecord{Key: "dory", Value: fish{Name: "dory"}}
+	close(in)
+
+	n, err := d.WriteStream(context.Background(), "fish", in)
+	if err == nil {
+		t.Fatal("WriteStream of an unmarshalable record succeeded")
+	}
+	if n != 1 {
+		t.Errorf("WriteStream wrote %d records before failing, want 1", n)
+	}
+	if resources, _ := d.ListResources("fish"); !slices.Equal(resources, []string{"nemo"}) {
+		t.Errorf("fish holds %v, want [nemo]", resources)
+	}
+}
+
+func TestWriteStreamCanceled(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan KeyedRecord, 1)
+	in <- KeyedRecord{Key: "nemo", Value: fish{Name: "nemo"}}
+
+	// The stream stays open, so only canceling ctx ends it.
+	done := make(chan error, 1)
+	var n int
+	go func() {
+		var err error
+		n, err = d.WriteStream(ctx, "fish", in)
+		done <- err
+	}()
+
+	for {
+		if resources, _ := d.ListResources("fish"); len(resources) == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteStream after cancel = %v, want context.Canceled", err)
+	}
+	if n != 1 {
+		t.Errorf("WriteStream wrote %d records, want 1", n)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StressConfig configures a StressTest run.
+type StressConfig struct {
+	// Collection is the collection the workers use. Existing records in
+	// it may be overwritten or deleted.
+	Collection string
+
+	// Readers, Writers and Deleters are the number of goroutines doing
+	// each kind of operation.
+	Readers  int
+	Writers  int
+	Deleters int
+
+	// Keys is the number of distinct resources the workers pick from,
+	// 16 if zero. Fewer keys mean more contention.
+	Keys int
+
+	// Duration is how long the run lasts.
+	Duration time.Duration
+}
+
+// StressReport is the outcome of a StressTest run.
+type StressReport struct {
+	Reads   int64
+	Writes  int64
+	Deletes int64
+
+	// Torn counts reads that returned a record no writer wrote, e.g. a
+	// mix of two versions.
+	Torn int64
+
+	// Errors holds the first errors observed, up to maxStressErrors, and
+	// ErrorCount how many there were in total. Reading or deleting a
+	// record that another worker deleted first isn't an error.
+	Errors     []error
+	ErrorCount int64
+
+	Elapsed time.Duration
+}
+
+// maxStressErrors caps StressReport.Errors.
+const maxStressErrors = 10
+
+// OpsPerSecond returns the throughput of the run over all operations.
+func (r StressReport) OpsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(r.Reads+r.Writes+r.Deletes) / r.Elapsed.Seconds()
+}
+
+// stressRecord is what StressTest writers store. Check lets readers spot a
+// record that wasn't written in one piece.
+type stressRecord struct {
+	Key   int
+	Seq   int64
+	Check int64
+	Pad   string
+}
+
+func (r stressRecord) valid() bool {
+	return r.Check == int64(r.Key)*31+r.Seq && len(r.Pad) == int(r.Seq%64)
+}
+
+// StressTest runs concurrent readers, writers and deleters against a
+// collection of d for cfg.Duration and reports the throughput and any
+// errors or torn reads observed. It is meant for checking a setup under
+// load, not as a benchmark.
+func StressTest(d *Driver, cfg StressConfig) (_ StressReport, err error) {
+	defer wrapOp("StressTest", cfg.Collection, "", &err)
+
+	if d == nil {
+		return StressReport{}, fmt.Errorf("Missing driver - nothing to stress!")
+	}
+
+	if cfg.Collection == "" {
+		return StressReport{}, fmt.Errorf("Missing collection - nothing to stress!")
+	}
+
+	if cfg.Readers < 0 || cfg.Writers < 0 || cfg.Deleters < 0 || cfg.Readers+cfg.Writers+cfg.Deleters == 0 {
+		return StressReport{}, fmt.Errorf("stress test needs at least one worker and no negative counts")
+	}
+
+	if cfg.Duration <= 0 {
+		return StressReport{}, fmt.Errorf("stress test duration must be positive, got %v", cfg.Duration)
+	}
+
+	keys := cfg.Keys
+	if keys <= 0 {
+		keys = 16
+	}
+
+	var (
+		report   StressReport
+		errMutex sync.Mutex
+		seq      atomic.Int64
+		wg       sync.WaitGroup
+		stop     = make(chan struct{})
+	)
+
+	fail := func(err error) {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+
+		report.ErrorCount++
+		if len(report.Errors) < maxStressErrors {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+
+	run := func(n int, op func(i int64)) {
+		for w := 0; w < n; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := int64(w); ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+						op(i)
+					}
+				}
+			}()
+		}
+	}
+
+	resource := func(i int64) string {
+		return "stress-" + strconv.Itoa(int(i%int64(keys)))
+	}
+
+	start := time.Now()
+
+	run(cfg.Writers, func(i int64) {
+		n := seq.Add(1)
+		key := int(i % int64(keys))
+		r := stressRecord{Key: key, Seq: n, Check: int64(key)*31 + n, Pad: strings.Repeat("x", int(n%64))}
+		if err := d.Write(cfg.Collection, resource(i), r); err != nil {
+			fail(err)
+			return
+		}
+		atomic.AddInt64(&report.Writes, 1)
+	})
+
+	run(cfg.Readers, func(i int64) {
+		var r stressRecord
+		err := d.Read(cfg.Collection, resource(i), &r)
+		if errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		if !r.valid() {
+			atomic.AddInt64(&report.Torn, 1)
+			fail(fmt.Errorf("torn read of %s/%s: %+v", cfg.Collection, resource(i), r))
+			return
+		}
+		atomic.AddInt64(&report.Reads, 1)
+	})
+
+	run(cfg.Deleters, func(i int64) {
+		err := d.Delete(cfg.Collection, resource(i))
+		if errors.Is(err, ErrNotFound) {
+			return
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		atomic.AddInt64(&report.Deletes, 1)
+	})
+
+	time.Sleep(cfg.Duration)
+	close(stop)
+	wg.Wait()
+
+	report.Elapsed = time.Since(start)
+	d.log.Debugf("Stress test on %s: %d reads, %d writes, %d deletes, %d errors",
+		cfg.Collection, report.Reads, report.Writes, report.Deletes, report.ErrorCount)
+	return report, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStressTest(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	// Seed every key so readers have something to find even when the
+	// writers are slow, as they are under the race detector.
+	for key := 0; key < 4; key++ {
+		mustWrite(t, d, "stress", "stress-"+strconv.Itoa(key), stressRecord{Key: key, Check: int64(key) * 31})
+	}
+
+	report, err := StressTest(d, StressConfig{
+		Collection: "stress",
+		Readers:    4,
+		Writers:    2,
+		Deleters:   1,
+		Keys:       4,
+		Duration:   200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reads == 0 || report.Writes == 0 || report.Deletes == 0 {
+		t.Errorf("report = %+v, want every kind of operation", report)
+	}
+	if report.Torn != 0 || report.ErrorCount != 0 {
+		t.Errorf("report = %+v, want no torn reads or errors: %v", report, report.Errors)
+	}
+	if report.OpsPerSecond() <= 0 {
+		t.Errorf("OpsPerSecond = %v", report.OpsPerSecond())
+	}
+}
+
+func TestStressTestConfig(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for name, cfg := range map[string]StressConfig{
+		"no collection":  {Readers: 1, Duration: time.Millisecond},
+		"no workers":     {Collection: "stress", Duration: time.Millisecond},
+		"negative count": {Collection: "stress", Readers: 2, Writers: -1, Duration: time.Millisecond},
+		"no duration":    {Collection: "stress", Readers: 1},
+	} {
+		if _, err := StressTest(d, cfg); err == nil {
+			t.Errorf("%s: StressTest succeeded", name)
+		}
+	}
+
+	if _, err := StressTest(nil, StressConfig{Collection: "stress", Readers: 1, Duration: time.Millisecond}); err == nil {
+		t.Error("StressTest without a driver succeeded")
+	}
+}
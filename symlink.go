@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy controls how the driver treats symlinks found in collection
+// and resource paths.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollowWithin follows symlinks as long as they resolve to a
+	// location inside the database directory.
+	SymlinkFollowWithin SymlinkPolicy = iota
+
+	// SymlinkReject refuses any path that goes through a symlink.
+	SymlinkReject
+)
+
+// checkPath verifies that rel, a path relative to d.dir naming a collection
+// or record, stays inside d.dir and only goes through symlinks allowed by the
+// configured policy. The last element is also checked with the record
+// extension, since that's the file actually opened. Names starting with a
+// dot are rejected: they are the driver's own, and Collections and WalkAll
+// skip them.
+func (d *Driver) checkPath(rel string) error {
+	rel = filepath.Clean(rel)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s escapes the database directory: %w", rel, ErrInvalidName)
+	}
+
+	if isReserved(rel) {
+		return fmt.Errorf("%s: %w", rel, ErrReservedName)
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	path := d.dir
+
+	for i, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			return fmt.Errorf("%s: names starting with a dot are hidden: %w", rel, ErrInvalidName)
+		}
+
+		path = filepath.Join(path, part)
+
+		candidates := []string{path}
+		if i == len(parts)-1 {
+			candidates = append(candidates, path+".json")
+		}
+
+		for _, candidate := range candidates {
+			fi, err := os.Lstat(candidate)
+			if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+
+			if err := d.checkSymlink(candidate); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) checkSymlink(path string) error {
+	if d.symlinks == SymlinkReject {
+		return fmt.Errorf("%s is a symlink: %w", path, ErrInvalidName)
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.EvalSymlinks(d.dir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s points outside the database directory: %w", path, ErrInvalidName)
+	}
+
+	return nil
+}
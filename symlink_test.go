@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathsEscapingDatabase(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("fish", "../../escaped", fish{Name: "nemo"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write outside the database = %v, want ErrInvalidName", err)
+	}
+	if err := d.Write("../fish", "nemo", fish{Name: "nemo"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write to a collection outside the database = %v, want ErrInvalidName", err)
+	}
+}
+
+func TestSymlinkOutsideDatabase(t *testing.T) {
+	d := newTestDriver(t, nil)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.json"), []byte(`{"name":"secret"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(d.dir, "fish")); err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "secret", &got); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Read through a symlink leaving the database = %v, want ErrInvalidName", err)
+	}
+	if err := d.Write("fish", "nemo", fish{Name: "nemo"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write through a symlink leaving the database = %v, want ErrInvalidName", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "nemo.json")); !os.IsNotExist(err) {
+		t.Errorf("Write created a file outside the database: %v", err)
+	}
+}
+
+func TestSymlinkWithinDatabase(t *testing.T) {
+	for _, tt := range []struct {
+		policy SymlinkPolicy
+		ok     bool
+	}{
+		{SymlinkFollowWithin, true},
+		{SymlinkReject, false},
+	} {
+		d := newTestDriver(t, &Options{Symlinks: tt.policy})
+		mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+		if err := os.Symlink(filepath.Join(d.dir, "fish", "nemo.json"), filepath.Join(d.dir, "fish", "clownfish.json")); err != nil {
+			t.Fatal(err)
+		}
+
+		var got fish
+		err := d.Read("fish", "clownfish", &got)
+		if tt.ok && (err != nil || got.Name != "nemo") {
+			t.Errorf("policy %d: Read through a symlink = %+v, %v", tt.policy, got, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidName) {
+			t.Errorf("policy %d: Read through a symlink = %v, want ErrInvalidName", tt.policy, err)
+		}
+	}
+}
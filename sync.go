@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Sync flushes everything written so far to stable storage. The driver
+// doesn't buffer writes itself, so this fsyncs every record and directory
+// in the data directories, making renames done by Write durable as well.
+func (d *Driver) Sync() (err error) {
+	defer wrapOp("Sync", "", "", &err)
+
+	done, err := d.begin()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	for _, root := range d.roots() {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			return syncPath(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	d.log.Debugf("Synced %s", d.dir)
+	return nil
+}
+
+// syncPath fsyncs a single file or directory. Paths removed by a concurrent
+// Delete are skipped.
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
+
+// mkdirAll is os.MkdirAll that, with Options.Sync, also fsyncs every
+// directory it created and the existing parent of the topmost one, so the
+// new directories survive a crash.
+func (d *Driver) mkdirAll(path string) error {
+	if !d.syncDirs {
+		return os.MkdirAll(path, 0755)
+	}
+
+	path = filepath.Clean(path)
+
+	// Find the deepest ancestor that already exists.
+	created := []string{}
+	existing := path
+	for {
+		if _, err := os.Stat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		created = append(created, existing)
+		existing = parent
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	for _, dir := range append(created, existing) {
+		if err := d.syncDir(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
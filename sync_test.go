@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	d := newTestDriver(t, &Options{DataDirs: []string{filepath.Join(t.TempDir(), "data")}})
+	for _, name := range []string{"nemo", "dory", "marlin", "bruce"} {
+		mustWrite(t, d, "fish", name, fish{Name: name})
+	}
+
+	if err := d.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncPathSkipsRemovedFiles(t *testing.T) {
+	if err := syncPath(filepath.Join(t.TempDir(), "gone.json")); err != nil {
+		t.Errorf("syncPath of a removed file = %v, want nil", err)
+	}
+}
+
+func TestSyncOptionSyncsNewDirectories(t *testing.T) {
+	d := newTestDriver(t, &Options{Sync: true})
+	var synced []string
+	d.syncDir = func(path string) error {
+		synced = append(synced, path)
+		return nil
+	}
+
+	// Every created directory is synced, deepest first, then the parent
+	// that already existed.
+	mustWrite(t, d, "sea/fish", "nemo", fish{Name: "nemo"})
+	want := []string{
+		filepath.Join(d.dir, "sea", "fish"),
+		filepath.Join(d.dir, "sea"),
+		d.dir,
+	}
+	if !reflect.DeepEqual(synced, want) {
+		t.Errorf("synced %v, want %v", synced, want)
+	}
+
+	// Directories that exist already aren't synced again.
+	synced = nil
+	mustWrite(t, d, "sea/fish", "dory", fish{Name: "dory"})
+	if len(synced) != 0 {
+		t.Errorf("synced %v for an existing collection, want nothing", synced)
+	}
+}
+
+func TestSyncOptionOff(t *testing.T) {
+	d := newTestDriver(t, nil)
+	d.syncDir = func(path string) error {
+		t.Errorf("synced %s without Options.Sync", path)
+		return nil
+	}
+
+	mustWrite(t, d, "sea/fish", "nemo", fish{Name: "nemo"})
+}
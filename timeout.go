@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when an operation runs past its deadline,
+	// such as Options.OperationTimeout. It wraps context.DeadlineExceeded.
+	ErrTimeout = fmt.Errorf("operation timed out: %w", context.DeadlineExceeded)
+
+	// ErrLockTimeout is the ErrTimeout returned when the deadline passed
+	// while waiting for a lock.
+	ErrLockTimeout = fmt.Errorf("waiting for lock: %w", ErrTimeout)
+)
+
+// TryWrite is like Write but waits at most timeout for the collection lock,
+// returning ErrLockTimeout if another writer holds it for longer.
+func (d *Driver) TryWrite(collection, resource string, v interface{}, timeout time.Duration) (err error) {
+	defer wrapOp("TryWrite", collection, resource, &err)
+
+	b, err := d.marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return d.writeRecord(collection, resource, bytes.NewReader(b), d.deadlineWithin(timeout))
+}
+
+// TryDelete is like Delete but waits at most timeout for the collection
+// lock, returning ErrLockTimeout if another writer holds it for longer.
+func (d *Driver) TryDelete(collection, resource string, timeout time.Duration) (err error) {
+	defer wrapOp("TryDelete", collection, resource, &err)
+
+	return d.deleteBefore(collection, resource, d.deadlineWithin(timeout))
+}
+
+// deadline returns the time by which an operation starting now must finish,
+// or the zero time when no OperationTimeout is set.
+func (d *Driver) deadline() time.Time {
+	if d.opTimeout <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(d.opTimeout)
+}
+
+// deadlineWithin is like deadline but never later than timeout from now.
+func (d *Driver) deadlineWithin(timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if opDeadline := d.deadline(); !opDeadline.IsZero() && opDeadline.Before(deadline) {
+		return opDeadline
+	}
+
+	return deadline
+}
+
+// acquire locks a collection, shared for readers or exclusively for writers,
+// giving up with ErrLockTimeout once deadline passes. The operation counts
+// as in flight for Close until unlock is called; once the driver is closed
+// acquire fails with ErrClosed.
+func (d *Driver) acquire(collection string, shared bool, deadline time.Time) (unlock func(), err error) {
+	done, err := d.begin()
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+
+	if !lockBefore(mutex, shared, deadline) {
+		done()
+		return nil, fmt.Errorf("locking %s: %w", collection, ErrLockTimeout)
+	}
+
+	if shared {
+		return func() { mutex.RUnlock(); done() }, nil
+	}
+	return func() { mutex.Unlock(); done() }, nil
+}
+
+// acquireRecord takes the lock of a single record and then the collection's
+// write lock, for writes and read-modify-write updates that must not
+// interleave with a LockResource holder. Record locks are always taken first, so the two
+// can't deadlock each other. An empty resource takes the collection lock
+// only.
+func (d *Driver) acquireRecord(collection, resource string, deadline time.Time) (unlock func(), err error) {
+	if resource == "" {
+		return d.acquire(collection, false, deadline)
+	}
+
+	unlockRecord, err := d.lockRecord(collection, resource, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockCollection, err := d.acquire(collection, false, deadline)
+	if err != nil {
+		unlockRecord()
+		return nil, err
+	}
+
+	return func() { unlockCollection(); unlockRecord() }, nil
+}
+
+// recordLock is the lock of a single record. Entries are dropped from
+// Driver.recordLocks when nobody holds or waits for them.
+type recordLock struct {
+	mutex sync.RWMutex
+	refs  int
+}
+
+// lockRecord takes the lock of a single record, giving up with
+// ErrLockTimeout once deadline passes.
+func (d *Driver) lockRecord(collection, resource string, deadline time.Time) (unlock func(), err error) {
+	key := collection + "\x00" + resource
+
+	d.mutex.Lock()
+	if d.recordLocks == nil {
+		d.recordLocks = make(map[string]*recordLock)
+	}
+	l, ok := d.recordLocks[key]
+	if !ok {
+		l = &recordLock{}
+		d.recordLocks[key] = l
+	}
+	l.refs++
+	d.mutex.Unlock()
+
+	release := func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		if l.refs--; l.refs == 0 {
+			delete(d.recordLocks, key)
+		}
+	}
+
+	if !lockBefore(&l.mutex, false, deadline) {
+		release()
+		return nil, fmt.Errorf("locking %s/%s: %w", collection, resource, ErrLockTimeout)
+	}
+
+	return func() { l.mutex.Unlock(); release() }, nil
+}
+
+// lockBefore acquires mutex, polling TryLock so the wait can be bounded by
+// deadline. A zero deadline waits as long as it takes.
+func lockBefore(mutex *sync.RWMutex, shared bool, deadline time.Time) bool {
+	if deadline.IsZero() {
+		if shared {
+			mutex.RLock()
+		} else {
+			mutex.Lock()
+		}
+		return true
+	}
+
+	backoff := 50 * time.Microsecond
+	for {
+		if shared && mutex.TryRLock() || !shared && mutex.TryLock() {
+			return true
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+
+		time.Sleep(min(backoff, remaining))
+		backoff = min(backoff*2, 10*time.Millisecond)
+	}
+}
+
+// expired reports whether deadline is set and has passed.
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
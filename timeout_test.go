@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOperationTimeout(t *testing.T) {
+	d := newTestDriver(t, &Options{OperationTimeout: 20 * time.Millisecond})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	unlock := d.LockCollection("fish")
+
+	var got fish
+	ops := map[string]func() error{
+		"Write":  func() error { return d.Write("fish", "dory", fish{Name: "dory"}) },
+		"Read":   func() error { return d.Read("fish", "nemo", &got) },
+		"Delete": func() error { return d.Delete("fish", "nemo") },
+		"ReadAll": func() error {
+			_, err := d.ReadAll("fish")
+			return err
+		},
+		"History": func() error {
+			_, err := d.History("fish", "nemo")
+			return err
+		},
+	}
+	for name, op := range ops {
+		start := time.Now()
+		err := op()
+		if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s behind a held lock = %v, want ErrTimeout", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s took %v to time out", name, elapsed)
+		}
+	}
+
+	unlock()
+
+	if err := d.Read("fish", "nemo", &got); err != nil {
+		t.Errorf("Read after the lock was released = %v", err)
+	}
+}
+
+func TestOperationTimeoutMetadata(t *testing.T) {
+	d := newTestDriver(t, &Options{OperationTimeout: 20 * time.Millisecond})
+
+	unlock := d.LockCollection(metaFile)
+	defer unlock()
+
+	if _, err := d.Meta(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Meta behind a held lock = %v, want ErrTimeout", err)
+	}
+	if _, err := d.DBVersion(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("DBVersion behind a held lock = %v, want ErrTimeout", err)
+	}
+}
+
+func TestTryWriteAndTryDelete(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	unlock := d.LockCollection("fish")
+	if err := d.TryWrite("fish", "nemo", fish{Name: "nemo", Age: 1}, 10*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("TryWrite behind a held lock = %v, want ErrLockTimeout", err)
+	}
+	if err := d.TryDelete("fish", "nemo", 10*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("TryDelete behind a held lock = %v, want ErrLockTimeout", err)
+	}
+	unlock()
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 0 {
+		t.Fatalf("record after timed out writes = %+v, %v", got, err)
+	}
+
+	if err := d.TryWrite("fish", "nemo", fish{Name: "nemo", Age: 1}, time.Second); err != nil {
+		t.Fatalf("TryWrite = %v", err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 1 {
+		t.Errorf("record after TryWrite = %+v, %v", got, err)
+	}
+	if err := d.TryDelete("fish", "nemo", time.Second); err != nil {
+		t.Fatalf("TryDelete = %v", err)
+	}
+	if err := d.Read("fish", "nemo", &got); err == nil {
+		t.Error("record still exists after TryDelete")
+	}
+}
+
+func TestTryWriteWaitsForShortHolders(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	unlock := d.LockCollection("fish")
+	time.AfterFunc(10*time.Millisecond, unlock)
+
+	if err := d.TryWrite("fish", "nemo", fish{Name: "nemo"}, 5*time.Second); err != nil {
+		t.Errorf("TryWrite after the holder released the lock = %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// trashDir holds soft-deleted records, laid out the same way as the live
+// collections: .trash/<collection>/<resource>.json.
+const trashDir = ".trash"
+
+// Restore moves a soft-deleted record out of the trash and back into its
+// collection. It refuses to overwrite a record that has since been
+// rewritten, failing with ErrAlreadyExists, and fails with ErrNotFound if
+// the trash doesn't hold the record.
+func (d *Driver) Restore(collection, resource string) (err error) {
+	defer wrapOp("Restore", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to restore record!")
+	}
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("Missing resource - unable to restore record (no name)!")
+	}
+
+	if err := d.checkPath(filepath.Join(collection, resource)); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	trashMutex := d.getOrCreateMutex(trashDir)
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+
+	if _, err := os.Stat(d.recordFile(collection, resource)); err == nil {
+		return fmt.Errorf("unable to restore %s/%s: %w", collection, resource, ErrAlreadyExists)
+	}
+
+	root, src, partition := d.trashedRecord(collection, resource)
+	if src == "" {
+		return fmt.Errorf("unable to find %s/%s in trash: %w", collection, resource, ErrNotFound)
+	}
+	dst := filepath.Join(root, collection, partition, resource+".json")
+
+	if d.dryRun {
+		d.dryRunf("restore %s/%s from trash", collection, resource)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+
+	blobs, err := sidecarFiles(filepath.Dir(src), filepath.Base(resource))
+	if err != nil {
+		return err
+	}
+	for _, name := range blobs {
+		if err := os.Rename(filepath.Join(filepath.Dir(src), name), filepath.Join(filepath.Dir(dst), name)); err != nil {
+			return err
+		}
+	}
+
+	if partition != "" {
+		d.partitions.set(collection, resource, partition)
+	}
+
+	if err := d.reindexRecord(collection, resource); err != nil {
+		return err
+	}
+
+	d.log.Debugf("Restored %s/%s from trash", collection, resource)
+	return nil
+}
+
+// trashedRecord finds a soft-deleted record in the trash of any data
+// directory, looking in the partitions of a partitioned collection too. It
+// returns the data directory, the file and the partition the record was
+// deleted from, or an empty file if the trash doesn't hold the record.
+func (d *Driver) trashedRecord(collection, resource string) (root, path, partition string) {
+	for _, root := range d.roots() {
+		trash := filepath.Join(root, trashDir)
+
+		partitions := []string{""}
+		if d.partitioned(collection) {
+			partitions = append(partitions, d.partitionDirs(trash, collection)...)
+		}
+
+		for _, p := range partitions {
+			path := filepath.Join(trash, collection, p, resource+".json")
+			if isFile(path) {
+				return root, path, p
+			}
+		}
+	}
+
+	return "", "", ""
+}
+
+// PurgeTrash permanently removes every soft-deleted record.
+func (d *Driver) PurgeTrash() (err error) {
+	defer wrapOp("PurgeTrash", "", "", &err)
+
+	unlock, err := d.acquire(trashDir, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if d.dryRun {
+		d.dryRunf("purge trash in %s", d.dir)
+		return nil
+	}
+
+	for _, root := range d.roots() {
+		if err := os.RemoveAll(filepath.Join(root, trashDir)); err != nil {
+			return err
+		}
+	}
+
+	d.log.Debugf("Purged trash in %s", d.dir)
+	return nil
+}
+
+// purgeTrashBefore permanently removes the soft-deleted records deleted
+// before cutoff, along with their blobs and metadata, and the directories
+// that leaves empty.
+func (d *Driver) purgeTrashBefore(cutoff time.Time) error {
+	unlock, err := d.acquire(trashDir, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, root := range d.roots() {
+		base := filepath.Join(root, trashDir)
+
+		var dirs []string
+		err := filepath.WalkDir(base, func(path string, entry fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) && path == base {
+				return filepath.SkipAll
+			}
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				dirs = append(dirs, path)
+				return nil
+			}
+
+			fi, err := entry.Info()
+			if err != nil || !fi.ModTime().Before(cutoff) {
+				return err
+			}
+
+			if d.dryRun {
+				d.dryRunf("purge %s from trash", path)
+				return nil
+			}
+			return os.Remove(path)
+		})
+		if err != nil {
+			return err
+		}
+
+		// Deepest first, so parents emptied by their children go too.
+		for i := len(dirs) - 1; i >= 0 && !d.dryRun; i-- {
+			if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+				if err := os.Remove(dirs[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	d.log.Debugf("Purged trash older than %v in %s", cutoff, d.dir)
+	return nil
+}
+
+// moveToTrash moves path, relative to the data directory root, to the same
+// place under root's trash. Each data directory has its own trash so that
+// soft-deletes stay renames on one filesystem. The files moved get the
+// current time as their modification time, which TrashRetention counts
+// from. The caller must hold the collection mutex.
+func (d *Driver) moveToTrash(root, path string) error {
+	mutex := d.getOrCreateMutex(trashDir)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	src, dst := filepath.Join(root, path), filepath.Join(root, trashDir, path)
+
+	var files []string
+	err := filepath.WalkDir(src, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		files = append(files, rel)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := moveInto(src, dst); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, rel := range files {
+		if err := os.Chtimes(filepath.Join(dst, rel), now, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveInto renames src to dst. If both are directories the contents of src
+// are merged into dst, replacing files that already exist there.
+func moveInto(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if dfi, err := os.Stat(dst); err != nil || !fi.IsDir() || !dfi.IsDir() {
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return os.Rename(src, dst)
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := moveInto(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(src)
+}
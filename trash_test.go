@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); !os.IsNotExist(err) {
+		t.Fatalf("Read after soft delete = %v, want not exist", err)
+	}
+	if !isFile(filepath.Join(d.dir, trashDir, "fish", "nemo.json")) {
+		t.Fatal("soft-deleted record is not in the trash")
+	}
+
+	if err := d.Restore("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Name != "nemo" {
+		t.Fatalf("Read after Restore = %+v, %v", got, err)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+
+	if err := d.Restore("fish", "dory"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore of an untrashed record = %v, want ErrNotFound", err)
+	}
+
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 2})
+
+	if err := d.Restore("fish", "nemo"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Restore over a rewritten record = %v, want ErrAlreadyExists", err)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 2 {
+		t.Errorf("rewritten record = %+v, %v", got, err)
+	}
+}
+
+func TestRestoreEscape(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "users", "Zoro", fish{Name: "Zoro"})
+
+	// The trash path of ../users/Zoro is the live record itself.
+	if err := d.Restore("..", "users/Zoro"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Restore out of the database = %v, want ErrInvalidName", err)
+	}
+	if err := d.Restore("users", "../../Zoro"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Restore of an escaping resource = %v, want ErrInvalidName", err)
+	}
+	if err := d.Restore(trashDir, "Zoro"); !errors.Is(err, ErrReservedName) {
+		t.Errorf("Restore into the trash = %v, want ErrReservedName", err)
+	}
+
+	var got fish
+	if err := d.Read("users", "Zoro", &got); err != nil || got.Name != "Zoro" {
+		t.Errorf("live record after the rejected Restore = %+v, %v", got, err)
+	}
+	if isFile(filepath.Join(filepath.Dir(d.dir), "users", "Zoro.json")) {
+		t.Error("Restore moved the record out of the database directory")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.PurgeTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, trashDir)); !os.IsNotExist(err) {
+		t.Errorf("trash still exists: %v", err)
+	}
+	if err := d.Restore("fish", "nemo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore after PurgeTrash = %v, want ErrNotFound", err)
+	}
+}
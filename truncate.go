@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Truncate deletes every record of a collection, with its blobs and
+// metadata, and the temp files of interrupted writes, but keeps the
+// collection itself and its sub-collections. Records go to the trash with
+// SoftDelete, like with Delete. The collection stays locked throughout.
+func (d *Driver) Truncate(collection string) (err error) {
+	defer wrapOp("Truncate", collection, "", &err)
+
+	collection = d.key(collection)
+
+	if collection == "" {
+		return fmt.Errorf("Missing collection - unable to truncate!")
+	}
+
+	if isReserved(collection) {
+		return fmt.Errorf("collection %s: %w", collection, ErrReservedName)
+	}
+
+	if err := d.checkPath(collection); err != nil {
+		return err
+	}
+
+	unlock, err := d.acquire(collection, false, d.deadline())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	resources, err := d.listResources(collection)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("collection %s: %w", collection, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		d.dryRunf("truncate %s, deleting %d records", collection, len(resources))
+		return nil
+	}
+
+	if d.singleFile {
+		// One rewrite of the collection file rather than one per record.
+		if err := d.writePacked(collection, map[string]json.RawMessage{}); err != nil {
+			return err
+		}
+
+		for _, resource := range resources {
+			sidecars, err := sidecarFiles(filepath.Join(d.dir, collection), resource)
+			if err != nil {
+				return err
+			}
+			for _, name := range sidecars {
+				if err := os.Remove(filepath.Join(d.dir, collection, name)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+
+		d.unindex(collection, "")
+		d.access.forget(collection, "")
+		d.uncache(collection, "")
+
+		for _, resource := range resources {
+			d.emit(ChangeDelete, collection, resource)
+		}
+	} else {
+		for _, resource := range resources {
+			if err := d.delete(collection, resource); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, root := range d.roots() {
+		entries, err := os.ReadDir(filepath.Join(root, collection))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tmp") {
+				continue
+			}
+			if err := os.Remove(filepath.Join(root, collection, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	d.log.Debugf("Truncated %s, deleted %d records", collection, len(resources))
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish/reef", "marlin", fish{Name: "marlin"})
+	if err := d.WriteBlob("fish", "nemo", "photo", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(d.dir, "fish", "dory.json.1234.tmp")
+	if err := os.WriteFile(tmp, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Truncate("fish"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the sub-collection is left in the collection directory.
+	entries, err := os.ReadDir(filepath.Join(d.dir, "fish"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "reef" {
+		t.Errorf("collection directory holds %v after Truncate, want reef", entries)
+	}
+	if resources, err := d.ListResources("fish/reef"); err != nil || !slices.Equal(resources, []string{"marlin"}) {
+		t.Errorf("sub-collection after Truncate = %v, %v", resources, err)
+	}
+}
+
+func TestTruncateSoftDelete(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	if err := d.Truncate("fish"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Restore("fish", "nemo"); err != nil {
+		t.Errorf("Restore after Truncate = %v", err)
+	}
+}
+
+func TestTruncateSingleFile(t *testing.T) {
+	d := newTestDriver(t, &Options{SingleFilePerCollection: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	events := d.Events()
+
+	if err := d.Truncate("fish"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resources, err := d.ListResources("fish"); err != nil || len(resources) != 0 {
+		t.Errorf("ListResources after Truncate = %v, %v, want none", resources, err)
+	}
+	if got, want := drainEvents(events), []string{"delete fish/dory", "delete fish/nemo"}; !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestTruncateErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Truncate("fish"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Truncate of a missing collection = %v, want ErrNotFound", err)
+	}
+	if err := d.Truncate(trashDir); !errors.Is(err, ErrReservedName) {
+		t.Errorf("Truncate of the trash = %v, want ErrReservedName", err)
+	}
+	if err := d.Truncate(""); err == nil {
+		t.Error("Truncate with no collection succeeded")
+	}
+}
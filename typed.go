@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// TypedDriver stores records of a single type T in one collection. The
+// encoder and decoder for T are worked out once per type and cached, so hot
+// paths working with one record type don't go through an interface{} and a
+// reflection lookup on every call. Types with generated JSON code, i.e.
+// MarshalJSON and UnmarshalJSON methods, have those called directly without
+// encoding/json's reflection; other types use encoding/json.
+type TypedDriver[T any] struct {
+	d          *Driver
+	collection string
+	codec      *typedCodec[T]
+}
+
+// NewTypedDriver returns a TypedDriver for collection backed by d.
+func NewTypedDriver[T any](d *Driver, collection string) *TypedDriver[T] {
+	return &TypedDriver[T]{d: d, collection: collection, codec: codecFor[T]()}
+}
+
+// typedCodec is the cached encoder and decoder of a record type.
+type typedCodec[T any] struct {
+	encode func(T) ([]byte, error)
+	decode func([]byte, *T) error
+}
+
+// typedCodecs caches a *typedCodec[T] per record type.
+var typedCodecs sync.Map
+
+func codecFor[T any]() *typedCodec[T] {
+	typ := reflect.TypeFor[T]()
+	if c, ok := typedCodecs.Load(typ); ok {
+		return c.(*typedCodec[T])
+	}
+
+	c := &typedCodec[T]{
+		encode: func(v T) ([]byte, error) { return json.Marshal(v) },
+		decode: func(b []byte, v *T) error { return json.Unmarshal(b, v) },
+	}
+
+	if typ.Implements(reflect.TypeFor[json.Marshaler]()) {
+		c.encode = func(v T) ([]byte, error) { return any(v).(json.Marshaler).MarshalJSON() }
+	}
+	if reflect.PointerTo(typ).Implements(reflect.TypeFor[json.Unmarshaler]()) {
+		c.decode = func(b []byte, v *T) error { return any(v).(json.Unmarshaler).UnmarshalJSON(b) }
+	}
+
+	actual, _ := typedCodecs.LoadOrStore(typ, c)
+	return actual.(*typedCodec[T])
+}
+
+// Get decodes the record named resource. The record is read into a fresh
+// buffer: an UnmarshalFunc or the type's UnmarshalJSON may keep slices of
+// it in v.
+func (t *TypedDriver[T]) Get(resource string) (_ T, err error) {
+	defer wrapOp("Get", t.collection, resource, &err)
+
+	var v T
+
+	b, err := t.d.ReadBytes(t.collection, resource, nil)
+	if err != nil {
+		return v, err
+	}
+
+	return v, t.decode(b, &v)
+}
+
+// decode is Driver.unmarshal using the cached decoder for T.
+func (t *TypedDriver[T]) decode(b []byte, v *T) error {
+	if t.d.unmarshalFunc != nil || t.d.strictDecode {
+		return t.d.unmarshal(b, v)
+	}
+
+	return t.codec.decode(b, v)
+}
+
+// Put stores v as the record named resource, encoded like Write would.
+func (t *TypedDriver[T]) Put(resource string, v T) error {
+	b, err := marshalRecord(t.d, v, t.codec.encode)
+	if err != nil {
+		return opError("Put", t.collection, resource, err)
+	}
+
+	if t.d.partitioned(t.d.key(t.collection)) {
+		return opError("Put", t.collection, resource, t.d.writePartitioned(t.collection, resource, v, b))
+	}
+
+	return opError("Put", t.collection, resource, t.d.writeRecord(t.collection, resource, bytes.NewReader(b), t.d.deadline()))
+}
+
+// Delete removes the record named resource.
+func (t *TypedDriver[T]) Delete(resource string) error {
+	return t.d.Delete(t.collection, resource)
+}
+
+// All decodes every record in the collection.
+func (t *TypedDriver[T]) All() (_ []T, err error) {
+	defer wrapOp("All", t.collection, "", &err)
+
+	records, err := t.d.ReadAll(t.collection)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]T, 0, len(records))
+	for _, record := range records {
+		var v T
+		if err := t.decode([]byte(record), &v); err != nil {
+			return nil, err
+		}
+		all = append(all, v)
+	}
+
+	return all, nil
+}
+
+// KeyedStore is a TypedDriver that names each record after its value, so a
+// record can't be stored under a key that doesn't match its content.
+type KeyedStore[T any] struct {
+	typed *TypedDriver[T]
+	keyFn func(T) string
+}
+
+// NewKeyed returns a KeyedStore for collection backed by d, naming records
+// with keyFn, e.g. func(u User) string { return u.Name }.
+func NewKeyed[T any](d *Driver, collection string, keyFn func(T) string) *KeyedStore[T] {
+	return &KeyedStore[T]{typed: NewTypedDriver[T](d, collection), keyFn: keyFn}
+}
+
+// Put stores v under the key keyFn gives it.
+func (k *KeyedStore[T]) Put(v T) (err error) {
+	defer wrapOp("Put", k.typed.collection, "", &err)
+
+	key, err := k.key(v)
+	if err != nil {
+		return err
+	}
+
+	return k.typed.Put(key, v)
+}
+
+func (k *KeyedStore[T]) key(v T) (key string, err error) {
+	defer recoverHook("keyFn", &err)
+	return k.keyFn(v), nil
+}
+
+// Get decodes the record stored under key.
+func (k *KeyedStore[T]) Get(key string) (T, error) {
+	return k.typed.Get(key)
+}
+
+// Delete removes the record stored under key.
+func (k *KeyedStore[T]) Delete(key string) error {
+	return k.typed.Delete(key)
+}
+
+// All decodes every record in the collection.
+func (k *KeyedStore[T]) All() ([]T, error) {
+	return k.typed.All()
+}
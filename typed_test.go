@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestTypedDriver(t *testing.T) {
+	d := newTestDriver(t, nil)
+	fishes := NewTypedDriver[fish](d, "fish")
+
+	for i, name := range []string{"nemo", "dory"} {
+		if err := fishes.Put(name, fish{Name: name, Age: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := fishes.Get("dory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (fish{Name: "dory", Age: 1}) {
+		t.Errorf("Get = %+v", got)
+	}
+
+	all, err := fishes.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	if len(all) != 2 || all[0].Name != "dory" || all[1].Name != "nemo" {
+		t.Errorf("All = %+v", all)
+	}
+
+	if err := fishes.Delete("nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fishes.Get("nemo"); !os.IsNotExist(err) {
+		t.Errorf("Get after Delete = %v, want not exist", err)
+	}
+}
+
+func TestTypedDriverPutMatchesWrite(t *testing.T) {
+	for _, opts := range []Options{
+		{},
+		{Indent: boolPtr(false)},
+		{TrailingNewline: boolPtr(false)},
+	} {
+		d := newTestDriver(t, &opts)
+		mustWrite(t, d, "fish", "written", fish{Name: "nemo"})
+		if err := NewTypedDriver[fish](d, "fish").Put("put", fish{Name: "nemo"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if put, written := rawRecord(t, d, "fish", "put"), rawRecord(t, d, "fish", "written"); put != written {
+			t.Errorf("Put stored %q, Write stored %q", put, written)
+		}
+	}
+}
+
+func TestTypedDriverUser(t *testing.T) {
+	d := newTestDriver(t, nil)
+	users := NewTypedDriver[User](d, "users")
+	zoro := User{Name: "Zoro", Age: "21", Contact: "23344333", Company: "Straw Hats", Address: Address{City: "Shimotsuki", Country: "East Blue"}}
+
+	if err := users.Put(zoro.Name, zoro); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := users.Get("Zoro"); err != nil || got != zoro {
+		t.Errorf("Get = %+v, %v, want %+v", got, err, zoro)
+	}
+
+	var read User
+	if err := d.Read("users", "Zoro", &read); err != nil || read != zoro {
+		t.Errorf("Read of a Put record = %+v, %v", read, err)
+	}
+}
+
+func TestTypedDriverPutMatchesWriteForUser(t *testing.T) {
+	zoro := User{Name: "Zoro", Age: "21", Address: Address{City: "Shimotsuki"}}
+
+	for name, opts := range map[string]Options{
+		"defaults":           {},
+		"compact":            {Indent: boolPtr(false)},
+		"no trailing":        {TrailingNewline: boolPtr(false)},
+		"compact no newline": {Indent: boolPtr(false), TrailingNewline: boolPtr(false)},
+		"MarshalFunc": {MarshalFunc: func(v interface{}) ([]byte, error) {
+			return json.Marshal(map[string]interface{}{"user": v})
+		}},
+	} {
+		d := newTestDriver(t, &opts)
+		mustWrite(t, d, "users", "written", zoro)
+		if err := NewTypedDriver[User](d, "users").Put("put", zoro); err != nil {
+			t.Fatal(err)
+		}
+
+		if put, written := rawRecord(t, d, "users", "put"), rawRecord(t, d, "users", "written"); put != written {
+			t.Errorf("%s: Put stored %q, Write stored %q", name, put, written)
+		}
+	}
+}
+
+// generatedUser stands in for a record type with code from a JSON code
+// generator. It counts the calls to tell that TypedDriver uses the methods.
+type generatedUser struct {
+	Name string
+	Age  int
+}
+
+var generatedCalls int
+
+func (u generatedUser) MarshalJSON() ([]byte, error) {
+	generatedCalls++
+	return fmt.Appendf(nil, `{"Name":%q,"Age":%d}`, u.Name, u.Age), nil
+}
+
+func (u *generatedUser) UnmarshalJSON(b []byte) error {
+	generatedCalls++
+	type plain generatedUser
+	return json.Unmarshal(b, (*plain)(u))
+}
+
+func TestTypedDriverGeneratedCode(t *testing.T) {
+	d := newTestDriver(t, nil)
+	users := NewTypedDriver[generatedUser](d, "users")
+	generatedCalls = 0
+
+	if err := users.Put("Zoro", generatedUser{Name: "Zoro", Age: 21}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := users.Get("Zoro")
+	if err != nil || got != (generatedUser{Name: "Zoro", Age: 21}) {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+	if generatedCalls != 2 {
+		t.Errorf("generated methods called %d times, want once each", generatedCalls)
+	}
+
+	// The generated output is stored like any other record.
+	mustWrite(t, d, "users", "written", generatedUser{Name: "Zoro", Age: 21})
+	if put, written := rawRecord(t, d, "users", "Zoro"), rawRecord(t, d, "users", "written"); put != written {
+		t.Errorf("Put stored %q, Write stored %q", put, written)
+	}
+}
+
+func TestTypedDriverCodecCache(t *testing.T) {
+	a := NewTypedDriver[User](newTestDriver(t, nil), "users")
+	b := NewTypedDriver[User](newTestDriver(t, nil), "people")
+
+	if a.codec != b.codec {
+		t.Error("TypedDrivers of the same type don't share the cached codec")
+	}
+	if any(NewTypedDriver[fish](newTestDriver(t, nil), "fish").codec) == any(a.codec) {
+		t.Error("TypedDrivers of different types share a codec")
+	}
+}
+
+type rawFish struct {
+	Name json.RawMessage `json:"name"`
+}
+
+func TestTypedDriverGetDoesNotShareBuffers(t *testing.T) {
+	// json.Unmarshal copies RawMessage values, so keep the slice as an
+	// UnmarshalFunc decoding in place would.
+	d := newTestDriver(t, &Options{UnmarshalFunc: func(data []byte, v interface{}) error {
+		v.(*rawFish).Name = data
+		return nil
+	}})
+	fishes := NewTypedDriver[rawFish](d, "fish")
+	mustWrite(t, d, "fish", "nemo", map[string]string{"name": "nemo"})
+	mustWrite(t, d, "fish", "dory", map[string]string{"name": "dory"})
+
+	nemo, err := fishes.Get("nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := string(nemo.Name)
+	if _, err := fishes.Get("dory"); err != nil {
+		t.Fatal(err)
+	}
+	if string(nemo.Name) != want {
+		t.Errorf("a later Get changed an earlier result to %q", nemo.Name)
+	}
+}
+
+func BenchmarkTypedDriver(b *testing.B) {
+	d := newTestDriver(b, nil)
+	zoro := User{Name: "Zoro", Age: "21", Contact: "23344333", Company: "Straw Hats", Address: Address{City: "Shimotsuki", Country: "East Blue"}}
+	mustWrite(b, d, "users", "Zoro", zoro)
+
+	users := NewTypedDriver[User](d, "users")
+	generated := NewTypedDriver[generatedUser](d, "generated")
+	if err := generated.Put("Zoro", generatedUser{Name: "Zoro", Age: 21}); err != nil {
+		b.Fatal(err)
+	}
+
+	// Driver is the generic path through interface{} values for comparison.
+	b.Run("Driver/Read", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var u User
+			if err := d.Read("users", "Zoro", &u); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("TypedDriver/Get", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := users.Get("Zoro"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("TypedDriver/Get/generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := generated.Get("Zoro"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Driver/Write", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := d.Write("users", "Zoro", zoro); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("TypedDriver/Put", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := users.Put("Zoro", zoro); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("TypedDriver/Put/generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := generated.Put("Zoro", generatedUser{Name: "Zoro", Age: 21}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestKeyedStore(t *testing.T) {
+	d := newTestDriver(t, nil)
+	fishes := NewKeyed(d, "fish", func(f fish) string { return f.Name })
+
+	for _, name := range []string{"nemo", "dory"} {
+		if err := fishes.Put(fish{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Records are named after their value.
+	if resources, _ := d.ListResources("fish"); !slices.Equal(resources, []string{"dory", "nemo"}) {
+		t.Errorf("ListResources = %v, want [dory nemo]", resources)
+	}
+	if got, err := fishes.Get("nemo"); err != nil || got.Name != "nemo" {
+		t.Errorf("Get nemo = %+v, %v", got, err)
+	}
+	if all, err := fishes.All(); err != nil || len(all) != 2 {
+		t.Errorf("All = %v, %v, want 2 fish", all, err)
+	}
+
+	if err := fishes.Delete("nemo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fishes.Get("nemo"); !os.IsNotExist(err) {
+		t.Errorf("Get after Delete = %v, want a not-exist error", err)
+	}
+}
+
+func TestKeyedStoreKeyErrors(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := NewKeyed(d, "fish", func(f fish) string { return f.Name }).Put(fish{}); err == nil {
+		t.Error("Put with an empty key succeeded")
+	}
+
+	panicky := NewKeyed(d, "fish", func(f fish) string { panic("no key") })
+	if err := panicky.Put(fish{Name: "nemo"}); !errors.Is(err, ErrHookPanic) {
+		t.Errorf("Put with a panicking keyFn = %v, want ErrHookPanic", err)
+	}
+}
+
+func TestKeyedStoreUsers(t *testing.T) {
+	d := newTestDriver(t, nil)
+	users := NewKeyed(d, "users", func(u User) string { return u.Name })
+
+	for _, user := range demoUsers {
+		if err := users.Put(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Put names every record after User.Name, like main does by hand.
+	for _, want := range demoUsers {
+		var written User
+		if err := d.Read("users", want.Name, &written); err != nil || written != want {
+			t.Errorf("Read users/%s = %+v, %v, want %+v", want.Name, written, err, want)
+		}
+		if got, err := users.Get(want.Name); err != nil || got != want {
+			t.Errorf("Get %s = %+v, %v, want %+v", want.Name, got, err, want)
+		}
+	}
+
+	if all, err := users.All(); err != nil || len(all) != len(demoUsers) {
+		t.Errorf("All = %v, %v, want %d users", all, err, len(demoUsers))
+	}
+
+	if err := users.Delete("Zoro"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Get("Zoro"); !os.IsNotExist(err) {
+		t.Errorf("Get after Delete = %v, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Increment adds delta to the numeric top-level field of a record and
+// returns the new value. The read, the addition and the write happen under
+// the collection lock, so concurrent increments don't get lost. A missing
+// field, or record, is created with the value delta. The record is
+// re-encoded with its keys sorted.
+func (d *Driver) Increment(collection, resource, field string, delta float64) (_ float64, err error) {
+	defer wrapOp("Increment", collection, resource, &err)
+
+	var n float64
+
+	err = d.updateRecord(collection, resource, true, func(doc map[string]interface{}) error {
+		if v, ok := doc[field]; ok {
+			num, ok := v.(json.Number)
+			if !ok {
+				return fmt.Errorf("field %s of %s/%s is not a number", field, collection, resource)
+			}
+
+			old, err := num.Float64()
+			if err != nil {
+				return fmt.Errorf("field %s of %s/%s: %w", field, collection, resource, err)
+			}
+			n = old
+		}
+
+		n += delta
+		doc[field] = json.Number(strconv.FormatFloat(n, 'f', -1, 64))
+		return nil
+	})
+
+	return n, err
+}
+
+// ArrayAppend appends values to the array at the dotted path field of a
+// record, under the collection lock. A missing array, and any missing
+// object on the way to it, is created; a missing record is not.
+func (d *Driver) ArrayAppend(collection, resource, field string, values ...interface{}) (err error) {
+	defer wrapOp("ArrayAppend", collection, resource, &err)
+
+	return d.updateRecord(collection, resource, false, func(doc map[string]interface{}) error {
+		parent, key, err := walkPath(doc, field, true)
+		if err != nil {
+			return err
+		}
+
+		var array []interface{}
+		if v, ok := parent[key]; ok {
+			if array, ok = v.([]interface{}); !ok {
+				return fmt.Errorf("field %s of %s/%s is not an array", field, collection, resource)
+			}
+		}
+
+		parent[key] = append(array, values...)
+		return nil
+	})
+}
+
+// ArrayRemove removes every element equal to one of values, compared as
+// JSON, from the array at the dotted path field of a record, under the
+// collection lock. A missing array is left alone.
+func (d *Driver) ArrayRemove(collection, resource, field string, values ...interface{}) (err error) {
+	defer wrapOp("ArrayRemove", collection, resource, &err)
+
+	remove := make([][]byte, 0, len(values))
+	for _, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		remove = append(remove, b)
+	}
+
+	return d.updateRecord(collection, resource, false, func(doc map[string]interface{}) error {
+		parent, key, err := walkPath(doc, field, false)
+		if err != nil || parent == nil {
+			return err
+		}
+
+		v, ok := parent[key]
+		if !ok {
+			return nil
+		}
+		array, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("field %s of %s/%s is not an array", field, collection, resource)
+		}
+
+		kept := array[:0]
+		for _, elem := range array {
+			b, err := json.Marshal(elem)
+			if err != nil {
+				return err
+			}
+
+			if !containsJSON(remove, b) {
+				kept = append(kept, elem)
+			}
+		}
+
+		parent[key] = kept
+		return nil
+	})
+}
+
+// containsJSON reports whether b is the same JSON value as one of values.
+func containsJSON(values [][]byte, b []byte) bool {
+	for _, v := range values {
+		if sameJSON(v, b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpdateFunc replaces a record with fn applied to its decoded value, for
+// updates that compute the new value from the old. fn runs without any
+// lock held, so it may be slow or call back into the driver; the result is
+// only written if the record still holds what fn was given, otherwise fn
+// runs again on the new content, up to maxRetries more times before
+// failing with ErrConflict. A missing record is passed to fn as the zero
+// T and created. fn may run more than once, so it must not have side
+// effects.
+func UpdateFunc[T any](d *Driver, collection, resource string, fn func(T) (T, error), maxRetries int) (err error) {
+	defer wrapOp("UpdateFunc", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		old, err := d.snapshotRecord(collection, resource)
+		if err != nil {
+			return err
+		}
+
+		var v T
+		if old != nil {
+			if err := d.unmarshal(old, &v); err != nil {
+				return fmt.Errorf("decoding %s/%s: %w", collection, resource, err)
+			}
+		}
+
+		v, err = fn(v)
+		if err != nil {
+			return err
+		}
+
+		b, err := d.marshal(v)
+		if err != nil {
+			return err
+		}
+
+		written, err := d.compareAndWrite(collection, resource, old, b)
+		if err != nil || written {
+			return err
+		}
+
+		d.log.Debugf("Retrying update of %s/%s, changed concurrently", collection, resource)
+	}
+
+	return fmt.Errorf("updating %s/%s after %d retries: %w", collection, resource, maxRetries, ErrConflict)
+}
+
+// snapshotRecord returns the content of a record, or nil if it doesn't
+// exist, under the collection's read lock.
+func (d *Driver) snapshotRecord(collection, resource string) ([]byte, error) {
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	b, err := d.readRecord(collection, resource)
+	if noContent(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// compareAndWrite writes b if the record still holds old, nil meaning that
+// it doesn't exist, and reports whether it did.
+func (d *Driver) compareAndWrite(collection, resource string, old, b []byte) (bool, error) {
+	deadline := d.deadline()
+	unlock, err := d.acquireRecord(collection, resource, deadline)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	current, err := d.readRecord(collection, resource)
+	switch {
+	case noContent(err):
+		if old != nil {
+			return false, nil
+		}
+	case err != nil:
+		return false, err
+	case old == nil || !bytes.Equal(current, old):
+		return false, nil
+	}
+
+	// b was computed from the stored record, so the ConflictResolver has
+	// nothing to merge.
+	return true, d.writeLocked(collection, resource, bytes.NewReader(b), deadline)
+}
+
+// walkPath returns the object holding the last element of a dotted path and
+// that element's key. Missing objects on the way are created when create is
+// set; otherwise a nil parent is returned for them.
+func walkPath(doc map[string]interface{}, path string, create bool) (map[string]interface{}, string, error) {
+	if path == "" {
+		return nil, "", fmt.Errorf("Missing field - no path given!")
+	}
+
+	keys := strings.Split(path, ".")
+	for i, key := range keys[:len(keys)-1] {
+		next, ok := doc[key]
+		if !ok {
+			if !create {
+				return nil, "", nil
+			}
+			next = make(map[string]interface{})
+			doc[key] = next
+		}
+
+		obj, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("%s is not an object", strings.Join(keys[:i+1], "."))
+		}
+		doc = obj
+	}
+
+	return doc, keys[len(keys)-1], nil
+}
+
+// updateRecord applies fn to a record decoded as a JSON object and writes
+// the result back, all under the collection lock. Numbers are kept as
+// json.Number so they survive unchanged. If create is set a missing record
+// starts out empty; otherwise it is an error.
+func (d *Driver) updateRecord(collection, resource string, create bool, fn func(doc map[string]interface{}) error) error {
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return err
+	}
+
+	deadline := d.deadline()
+	unlock, err := d.acquireRecord(collection, resource, deadline)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc := make(map[string]interface{})
+
+	b, err := d.readRecord(collection, resource)
+	switch {
+	case noContent(err) && create:
+	case err != nil:
+		return err
+	default:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return fmt.Errorf("record %s/%s is not a JSON object: %w", collection, resource, err)
+		}
+	}
+
+	if err := fn(doc); err != nil {
+		return err
+	}
+
+	out, err := d.marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return d.writeLocked(collection, resource, bytes.NewReader(out), deadline)
+}
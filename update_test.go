@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestIncrement(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	n, err := d.Increment("counters", "hits", "total", 2)
+	if err != nil || n != 2 {
+		t.Fatalf("Increment of a missing record = %v, %v, want 2", n, err)
+	}
+	if n, err = d.Increment("counters", "hits", "total", 0.5); err != nil || n != 2.5 {
+		t.Errorf("Increment = %v, %v, want 2.5", n, err)
+	}
+
+	mustWrite(t, d, "counters", "named", map[string]interface{}{"total": "many"})
+	if _, err := d.Increment("counters", "named", "total", 1); err == nil {
+		t.Error("Increment of a string field succeeded")
+	}
+}
+
+func TestIncrementConcurrent(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.Increment("counters", "hits", "total", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var got struct {
+		Total int `json:"total"`
+	}
+	if err := d.Read("counters", "hits", &got); err != nil || got.Total != 20 {
+		t.Errorf("total after concurrent increments = %+v, %v, want 20", got, err)
+	}
+}
+
+func TestArrayAppendAndRemove(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "users", "zoro", map[string]interface{}{"name": "zoro"})
+
+	if err := d.ArrayAppend("users", "zoro", "crew.swords", "wado", "sandai", "wado"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := d.ReadField("users", "zoro", "crew.swords")
+	if err != nil || compact(t, raw) != `["wado","sandai","wado"]` {
+		t.Fatalf("array after ArrayAppend = %s, %v", raw, err)
+	}
+
+	if err := d.ArrayRemove("users", "zoro", "crew.swords", "wado"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err = d.ReadField("users", "zoro", "crew.swords")
+	if err != nil || compact(t, raw) != `["sandai"]` {
+		t.Errorf("array after ArrayRemove = %s, %v", raw, err)
+	}
+
+	if err := d.ArrayRemove("users", "zoro", "missing", "x"); err != nil {
+		t.Errorf("ArrayRemove from a missing array = %v", err)
+	}
+	if err := d.ArrayAppend("users", "zoro", "name", "x"); err == nil {
+		t.Error("ArrayAppend to a string field succeeded")
+	}
+	if err := d.ArrayAppend("users", "luffy", "crew", "x"); err == nil {
+		t.Error("ArrayAppend to a missing record succeeded")
+	}
+}
+
+func TestUpdateFunc(t *testing.T) {
+	d := newTestDriver(t, nil)
+	grow := func(f fish) (fish, error) {
+		f.Name = "nemo"
+		f.Age++
+		return f, nil
+	}
+
+	// A missing record starts from the zero value.
+	for want := 1; want <= 2; want++ {
+		if err := UpdateFunc(d, "fish", "nemo", grow, 0); err != nil {
+			t.Fatal(err)
+		}
+		var got fish
+		if err := d.Read("fish", "nemo", &got); err != nil || got.Age != want {
+			t.Errorf("after update %d: %+v, %v, want age %d", want, got, err, want)
+		}
+	}
+}
+
+func TestUpdateFuncRetries(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+
+	// The first attempt loses to a concurrent write and is run again on
+	// the new content.
+	calls := 0
+	err := UpdateFunc(d, "fish", "nemo", func(f fish) (fish, error) {
+		calls++
+		if calls == 1 {
+			mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 10})
+		}
+		f.Age++
+		return f, nil
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 11 {
+		t.Errorf("updated record = %+v, %v, want age 11", got, err)
+	}
+}
+
+func TestUpdateFuncConflict(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	calls := 0
+	err := UpdateFunc(d, "fish", "nemo", func(f fish) (fish, error) {
+		calls++
+		mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 100 + calls})
+		f.Age = -1
+		return f, nil
+	}, 2)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdateFunc always losing = %v, want ErrConflict", err)
+	}
+	if calls != 3 {
+		t.Errorf("fn called %d times, want 3", calls)
+	}
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 103 {
+		t.Errorf("record = %+v, %v, want the last concurrent write", got, err)
+	}
+}
+
+func TestUpdateFuncErrors(t *testing.T) {
+	resolved := 0
+	d := newTestDriver(t, &Options{ConflictResolver: func(existing, incoming []byte) ([]byte, error) {
+		resolved++
+		return incoming, nil
+	}})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	before := rawRecord(t, d, "fish", "nemo")
+
+	failure := errors.New("no thanks")
+	err := UpdateFunc(d, "fish", "nemo", func(f fish) (fish, error) { return f, failure }, 3)
+	if !errors.Is(err, failure) {
+		t.Errorf("UpdateFunc = %v, want fn's error", err)
+	}
+	if got := rawRecord(t, d, "fish", "nemo"); got != before {
+		t.Errorf("failed update changed the record to %s", got)
+	}
+
+	// UpdateFunc starts from the stored record, so it doesn't resolve.
+	resolved = 0
+	if err := UpdateFunc(d, "fish", "nemo", func(f fish) (fish, error) { f.Age = 2; return f, nil }, 0); err != nil {
+		t.Fatal(err)
+	}
+	if resolved != 0 {
+		t.Errorf("UpdateFunc called the ConflictResolver %d times", resolved)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// WalkAll calls fn for every record of every collection, in collection and
+// resource order, and stops at the first error fn returns. Temp files,
+// dotfiles and the driver's own storage are skipped. Each record is read
+// under its collection's read lock, like Read, but no lock is held while fn
+// runs, so it may write to the database.
+func (d *Driver) WalkAll(fn func(collection, resource string, data []byte) error) (err error) {
+	defer wrapOp("WalkAll", "", "", &err)
+
+	collections, err := d.Collections()
+	if err != nil {
+		return err
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		if strings.HasPrefix(collection, ".") {
+			continue
+		}
+
+		resources, err := d.ListResources(collection)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sort.Strings(resources)
+
+		for _, resource := range resources {
+			if strings.HasPrefix(resource, ".") {
+				continue
+			}
+
+			b, err := d.walkRecord(collection, resource)
+			if noContent(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := fn(collection, resource, b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkRecord reads a record for WalkAll under the collection's read lock.
+func (d *Driver) walkRecord(collection, resource string) ([]byte, error) {
+	unlock, err := d.acquire(collection, true, d.deadline())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, d.checkJSON(collection, resource, b)
+}
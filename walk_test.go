@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWalkAll(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true, KeepHistory: 1})
+	mustWrite(t, d, "sharks", "bruce", fish{Name: "bruce"})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo", Age: 1})
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish", "gill", fish{Name: "gill"})
+	if err := d.Delete("fish", "gill"); err != nil {
+		t.Fatal(err)
+	}
+
+	var visited []string
+	err := d.WalkAll(func(collection, resource string, data []byte) error {
+		visited = append(visited, collection+"/"+resource)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"fish/dory", "fish/nemo", "sharks/bruce"}; !slices.Equal(visited, want) {
+		t.Errorf("WalkAll visited %v, want %v", visited, want)
+	}
+}
+
+func TestWalkAllStopsOnError(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	stop := errors.New("stop")
+	calls := 0
+	err := d.WalkAll(func(collection, resource string, data []byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("WalkAll = %v after %d calls, want the callback's error after 1", err, calls)
+	}
+}
+
+func TestWalkAllCallbackMayWrite(t *testing.T) {
+	d := newTestDriver(t, nil)
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+
+	err := d.WalkAll(func(collection, resource string, data []byte) error {
+		return d.Write(collection, resource, fish{Name: resource, Age: 9})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got fish
+	if err := d.Read("fish", "nemo", &got); err != nil || got.Age != 9 {
+		t.Errorf("record written from WalkAll = %+v, %v", got, err)
+	}
+}
+
+func TestWalkAllCorruptRecord(t *testing.T) {
+	d := newTestDriver(t, &Options{ValidateOnRead: true})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	if err := os.WriteFile(filepath.Join(d.dir, "fish", "nemo.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := d.WalkAll(func(collection, resource string, data []byte) error { return nil })
+	if !errors.Is(err, ErrCorruptRecord) {
+		t.Errorf("WalkAll over a corrupt record = %v, want ErrCorruptRecord", err)
+	}
+}
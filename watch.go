@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ChangeOp describes what happened to a watched record.
+type ChangeOp string
+
+const (
+	ChangeWrite  ChangeOp = "write"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// ChangeEvent reports a change to a record seen on disk.
+type ChangeEvent struct {
+	Op         ChangeOp
+	Collection string
+	Resource   string
+	Time       time.Time
+}
+
+// WatchResource reports changes to a single record until ctx is cancelled,
+// at which point the returned channel is closed. Temp files and other
+// records in the collection are filtered out. In single-file mode every
+// change to the collection is reported, and deletes look like writes.
+func (d *Driver) WatchResource(ctx context.Context, collection, resource string) (_ <-chan ChangeEvent, err error) {
+	defer wrapOp("WatchResource", collection, resource, &err)
+
+	collection, resource = d.key(collection), d.key(resource)
+
+	if err := d.checkRecord(collection, resource); err != nil {
+		return nil, err
+	}
+
+	target := d.homeFile(collection, resource)
+	if d.singleFile {
+		target = d.packedFile(collection)
+	}
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	events := make(chan ChangeEvent)
+
+	go func() {
+		defer close(events)
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != target {
+					continue
+				}
+
+				op := ChangeWrite
+				switch {
+				case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+					op = ChangeDelete
+				case ev.Has(fsnotify.Create), ev.Has(fsnotify.Write):
+				default:
+					continue
+				}
+
+				select {
+				case events <- ChangeEvent{Op: op, Collection: collection, Resource: resource, Time: time.Now()}:
+				case <-ctx.Done():
+					return
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				d.log.Warnf("Watching %s/%s: %v", collection, resource, err)
+			}
+		}
+	}()
+
+	d.log.Debugf("Watching %s/%s", collection, resource)
+	return events, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// nextChange waits for the next event reporting op on ch, skipping the
+// others, e.g. the several writes a single rename can show up as.
+func nextChange(t *testing.T, ch <-chan ChangeEvent, op ChangeOp) ChangeEvent {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatalf("events closed while waiting for %s", op)
+			}
+			if ev.Op == op {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", op)
+		}
+	}
+}
+
+func TestWatchResource(t *testing.T) {
+	d := newTestDriver(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := d.WatchResource(ctx, "fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	mustWrite(t, d, "fish", "nemo", fish{Name: "nemo"})
+	ev := nextChange(t, events, ChangeWrite)
+	if ev.Collection != "fish" || ev.Resource != "nemo" {
+		t.Errorf("event = %+v, want fish/nemo", ev)
+	}
+
+	if err := d.Delete("fish", "nemo"); err != nil {
+		t.Fatal(err)
+	}
+	nextChange(t, events, ChangeDelete)
+
+	cancel()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("events not closed after cancelling the context")
+		}
+	}
+}
+
+func TestWatchResourceIgnoresOtherRecords(t *testing.T) {
+	d := newTestDriver(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := d.WatchResource(ctx, "fish", "nemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustWrite(t, d, "fish", "dory", fish{Name: "dory"})
+	select {
+	case ev := <-events:
+		t.Errorf("got %+v for another record", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}